@@ -0,0 +1,126 @@
+package main
+
+import (
+	"testing"
+
+	"todo-apps/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// loginAs registers username through the API and makes s act as that user.
+func loginAs(s *responseScanner, username string) models.User {
+	s.t.Helper()
+	const password = "Correct-horse-42"
+	s.expect(fiber.StatusCreated, "POST", "/auth/register", map[string]string{
+		"name": username, "username": username, "password": password,
+	}, nil)
+	var login struct {
+		Token string `json:"token"`
+	}
+	s.expect(fiber.StatusOK, "POST", "/auth/login", map[string]string{
+		"username": username, "password": password,
+	}, &login)
+	s.token = login.Token
+
+	var user models.User
+	if err := s.db.Where("username = ?", username).First(&user).Error; err != nil {
+		s.t.Fatal(err)
+	}
+	return user
+}
+
+// TestNonAdminCannotGrantPositions checks that a regular user can neither
+// assign themselves the admin position, rename a position they hold, nor
+// drop a position to escape its requirements.
+func TestNonAdminCannotGrantPositions(t *testing.T) {
+	s := newResponseScanner(t)
+	mallory := loginAs(s, "mallory")
+
+	admin := models.Position{Name: "Admin"}
+	engineer := models.Position{Name: "Engineer"}
+	for _, position := range []*models.Position{&admin, &engineer} {
+		if err := s.db.Create(position).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	held := models.UserPosition{UserID: mallory.ID, PositionID: engineer.ID}
+	if err := s.db.Create(&held).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	s.expect(fiber.StatusForbidden, "POST", "/api/user-positions", map[string]string{
+		"user_id": mallory.ID.String(), "position_id": admin.ID.String(),
+	}, nil)
+	s.expect(fiber.StatusForbidden, "PUT", "/api/positions/"+engineer.ID.String(), map[string]string{"name": "Admin"}, nil)
+	s.expect(fiber.StatusForbidden, "POST", "/api/positions", map[string]string{"name": "Admin"}, nil)
+	s.expect(fiber.StatusForbidden, "DELETE", "/api/user-positions/"+held.ID.String(), nil, nil)
+	s.expect(fiber.StatusForbidden, "DELETE", "/api/positions/"+engineer.ID.String(), nil, nil)
+
+	var count int64
+	s.db.Model(&models.UserPosition{}).Where("position_id = ?", admin.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("admin position has %d holders, want 0", count)
+	}
+	if err := s.db.First(&models.UserPosition{}, "id = ?", held.ID).Error; err != nil {
+		t.Errorf("held position was removed: %v", err)
+	}
+}
+
+// TestUserWritesNeedAdmin checks that accounts can only be created or edited
+// by admins, and that admins still need their current password to change
+// their own.
+func TestUserWritesNeedAdmin(t *testing.T) {
+	s := newResponseScanner(t)
+	mallory := loginAs(s, "mallory")
+
+	s.expect(fiber.StatusForbidden, "PUT", "/api/users/"+mallory.ID.String(), map[string]string{
+		"username": "root", "password": "Another-horse-42",
+	}, nil)
+	s.expect(fiber.StatusForbidden, "POST", "/api/users", map[string]string{
+		"name": "Eve", "username": "eve", "password": "Another-horse-42",
+	}, nil)
+
+	admin := models.Position{Name: "Admin"}
+	if err := s.db.Create(&admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.Create(&models.UserPosition{UserID: mallory.ID, PositionID: admin.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	s.expect(fiber.StatusUnprocessableEntity, "PUT", "/api/users/"+mallory.ID.String(), map[string]string{
+		"password": "Another-horse-42",
+	}, nil)
+	s.expect(fiber.StatusOK, "PUT", "/api/users/"+mallory.ID.String(), map[string]string{"name": "Mallory M."}, nil)
+}
+
+// TestDeactivationNeedsAdmin checks that only admins can deactivate users
+// and that they cannot deactivate themselves.
+func TestDeactivationNeedsAdmin(t *testing.T) {
+	s := newResponseScanner(t)
+	victim := loginAs(s, "victim")
+	mallory := loginAs(s, "mallory")
+
+	s.expect(fiber.StatusForbidden, "POST", "/api/users/"+victim.ID.String()+"/deactivate", nil, nil)
+	s.expect(fiber.StatusForbidden, "DELETE", "/api/users/"+victim.ID.String(), nil, nil)
+
+	admin := models.Position{Name: "Admin"}
+	if err := s.db.Create(&admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.Create(&models.UserPosition{UserID: mallory.ID, PositionID: admin.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	s.expect(fiber.StatusBadRequest, "POST", "/api/users/"+mallory.ID.String()+"/deactivate", nil, nil)
+	s.expect(fiber.StatusBadRequest, "DELETE", "/api/users/"+mallory.ID.String(), nil, nil)
+
+	var user models.User
+	s.db.First(&user, "id = ?", victim.ID)
+	if user.Status == models.UserStatusDeactivated {
+		t.Error("victim was deactivated by a non-admin")
+	}
+	s.db.First(&user, "id = ?", mallory.ID)
+	if user.Status == models.UserStatusDeactivated {
+		t.Error("admin deactivated their own account")
+	}
+}
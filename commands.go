@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"todo-apps/config"
+	"todo-apps/models"
+	"todo-apps/services"
+	"todo-apps/utils"
+
+	"gorm.io/gorm"
+)
+
+const usage = `usage: todo-apps [command]
+
+Without a command the API server is started.
+
+Commands:
+  import-users [-dry-run] [-actor username] FILE
+        Create users from a .csv or .xlsx file
+  grant-admin USERNAME
+        Give a user the first admin position, creating it if needed
+`
+
+// runCommand runs a one-off command instead of the server and returns the
+// process exit code.
+func runCommand(cfg *config.Config, mongodb *config.MongoDB, args []string) int {
+	switch args[0] {
+	case "import-users":
+		return runImportUsers(cfg, mongodb, args[1:], os.Stdout)
+	case "grant-admin":
+		return runGrantAdmin(cfg, mongodb, args[1:], os.Stdout)
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", args[0], usage)
+		return 2
+	}
+}
+
+// runImportUsers validates an import file, prints a per-row report and,
+// unless -dry-run is given, creates the valid rows. It exits with 1 if any
+// row was invalid.
+func runImportUsers(cfg *config.Config, mongodb *config.MongoDB, args []string, out io.Writer) int {
+	flags := flag.NewFlagSet("import-users", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "validate the file without creating users")
+	actor := flags.String("actor", "", "username recorded as the author in the audit log")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	ctx := context.Background()
+
+	// Audit entries name the admin running the import, or "cli"
+	actorID := "cli"
+	if *actor != "" {
+		var user models.User
+		if err := cfg.Database.Select("id").Where("username = ?", *actor).First(&user).Error; err != nil {
+			fmt.Fprintf(os.Stderr, "unknown actor %q\n", *actor)
+			return 2
+		}
+		actorID = user.ID.String()
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	rows, err := services.ParseImportFile(flags.Arg(0), data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid import file: %v\n", err)
+		return 2
+	}
+
+	utils.SetPasswordHasher(newPasswordHasher(cfg.Password))
+	passwordService, err := services.NewPasswordService(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "initialize password policy: %v\n", err)
+		return 1
+	}
+	notifier, err := services.NewNotifier(cfg.Notifier)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "initialize notifier: %v\n", err)
+		return 1
+	}
+	importService := services.NewImportService(cfg, passwordService, services.NewOnboardingService(cfg, notifier), services.NewAuditService(mongodb, cfg.Audit))
+
+	report, err := importService.Import(ctx, actorID, rows, *dryRun)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "import failed: %v\n", err)
+		return 1
+	}
+
+	for _, row := range report.Rows {
+		switch row.Status {
+		case services.ImportRowInvalid:
+			for _, violation := range row.Errors {
+				fmt.Fprintf(out, "line %d (%s): %s: %s\n", row.Line, row.Username, violation.Field, violation.Message)
+			}
+		case services.ImportRowCreated:
+			note := ""
+			if row.Invited {
+				note = ", invitation sent"
+			}
+			fmt.Fprintf(out, "line %d (%s): created %s%s\n", row.Line, row.Username, row.UserID, note)
+		}
+	}
+	if report.DryRun {
+		fmt.Fprintf(out, "dry run: %d rows, %d valid, %d invalid\n", report.Total, report.Valid, report.Invalid)
+	} else {
+		fmt.Fprintf(out, "%d rows, %d created, %d invalid\n", report.Total, report.Created, report.Invalid)
+	}
+
+	if report.Invalid > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runGrantAdmin assigns the first of ADMIN_POSITIONS to a user. Only admins
+// may assign positions through the API, so this is how the first admin is
+// made.
+func runGrantAdmin(cfg *config.Config, mongodb *config.MongoDB, args []string, out io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	if len(cfg.AdminPositions) == 0 {
+		fmt.Fprintln(os.Stderr, "ADMIN_POSITIONS is empty")
+		return 2
+	}
+	ctx := context.Background()
+	db := cfg.Database.WithContext(ctx)
+
+	var user models.User
+	if err := db.Where("username = ?", args[0]).First(&user).Error; err != nil {
+		fmt.Fprintf(os.Stderr, "unknown user %q\n", args[0])
+		return 2
+	}
+
+	var position models.Position
+	var userPosition models.UserPosition
+	createdPosition, assigned := false, false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("name = ?", cfg.AdminPositions[0]).First(&position).Error
+		if err == gorm.ErrRecordNotFound {
+			position = models.Position{Name: cfg.AdminPositions[0]}
+			err = tx.Create(&position).Error
+			createdPosition = true
+		}
+		if err != nil {
+			return err
+		}
+
+		err = tx.Where("user_id = ? AND position_id = ?", user.ID, position.ID).First(&userPosition).Error
+		if err == gorm.ErrRecordNotFound {
+			userPosition = models.UserPosition{UserID: user.ID, PositionID: position.ID}
+			err = tx.Create(&userPosition).Error
+			assigned = true
+		}
+		return err
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "grant admin failed: %v\n", err)
+		return 1
+	}
+
+	auditService := services.NewAuditService(mongodb, cfg.Audit)
+	if createdPosition {
+		auditService.LogCreate(ctx, "cli", "positions", position.ID.String(), map[string]interface{}{
+			"id": position.ID.String(), "name": position.Name,
+		})
+	}
+	if !assigned {
+		fmt.Fprintf(out, "%s already holds %s\n", user.Username, position.Name)
+		return 0
+	}
+	auditService.LogCreate(ctx, "cli", "user_positions", userPosition.ID.String(), map[string]interface{}{
+		"id": userPosition.ID.String(), "user_id": user.ID.String(), "position_id": position.ID.String(),
+	})
+	fmt.Fprintf(out, "%s now holds %s\n", user.Username, position.Name)
+	return 0
+}
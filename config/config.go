@@ -0,0 +1,403 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"todo-apps/jwtkeys"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// InsecureJWTSecret is the development fallback signing secret. It is
+// rejected when running in production.
+const InsecureJWTSecret = "your-secret-key"
+
+// MinPseudonymKeyLength is the shortest AUDIT_PSEUDONYM_KEY accepted in
+// production.
+const MinPseudonymKeyLength = 32
+
+// Config is the typed application configuration. Values are resolved in
+// order of increasing precedence: struct defaults, the optional YAML/TOML
+// file named by CONFIG_FILE, then environment variables (including .env).
+type Config struct {
+	Env  string `yaml:"env" toml:"env" env:"APP_ENV" default:"development"`
+	Port string `yaml:"port" toml:"port" env:"PORT" default:"3000"`
+	// RequestTimeout bounds the context passed to gorm and MongoDB for each request.
+	RequestTimeout time.Duration `yaml:"request_timeout" toml:"request_timeout" env:"REQUEST_TIMEOUT" default:"15s"`
+	// PublicURL is the externally reachable base URL used in emailed links.
+	PublicURL string `yaml:"public_url" toml:"public_url" env:"APP_PUBLIC_URL" default:"http://localhost:3000"`
+	// AdminPositions lists the position names whose holders may use admin endpoints.
+	AdminPositions []string `yaml:"admin_positions" toml:"admin_positions" env:"ADMIN_POSITIONS" default:"Admin"`
+
+	Log          LogConfig          `yaml:"log" toml:"log"`
+	JWT          JWTConfig          `yaml:"jwt" toml:"jwt"`
+	Postgres     PostgresConfig     `yaml:"postgres" toml:"postgres"`
+	Mongo        MongoConfig        `yaml:"mongo" toml:"mongo"`
+	Audit        AuditConfig        `yaml:"audit" toml:"audit"`
+	Tracing      TracingConfig      `yaml:"tracing" toml:"tracing"`
+	Redis        RedisConfig        `yaml:"redis" toml:"redis"`
+	RateLimit    RateLimitConfig    `yaml:"rate_limit" toml:"rate_limit"`
+	Password     PasswordConfig     `yaml:"password" toml:"password"`
+	Notifier     NotifierConfig     `yaml:"notifier" toml:"notifier"`
+	TwoFactor    TwoFactorConfig    `yaml:"two_factor" toml:"two_factor"`
+	AccessTokens AccessTokenConfig  `yaml:"access_tokens" toml:"access_tokens"`
+	OIDC         OIDCConfig         `yaml:"oidc" toml:"oidc"`
+	Registration RegistrationConfig `yaml:"registration" toml:"registration"`
+
+	// Database is the primary connection, set once ConnectDB succeeds.
+	Database *gorm.DB `yaml:"-" toml:"-"`
+	// ReadDatabase serves list endpoints. It is the read replica when one is
+	// configured and the primary otherwise.
+	ReadDatabase *gorm.DB `yaml:"-" toml:"-"`
+}
+
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level" env:"LOG_LEVEL" default:"info"`
+	Format string `yaml:"format" toml:"format" env:"LOG_FORMAT" default:"json"`
+}
+
+type JWTConfig struct {
+	// Secret signs HS256 tokens when no KeyFiles are configured.
+	Secret string        `yaml:"secret" toml:"secret" env:"JWT_SECRET" default:"your-secret-key" secret:"true"`
+	TTL    time.Duration `yaml:"ttl" toml:"ttl" env:"JWT_TTL" default:"24h"`
+	// ImpersonationTTL is the lifetime of an administrator's "act as user"
+	// token.
+	ImpersonationTTL time.Duration `yaml:"impersonation_ttl" toml:"impersonation_ttl" env:"JWT_IMPERSONATION_TTL" default:"15m"`
+	// KeyFiles lists RSA or Ed25519 private keys as kid=path.pem, optionally
+	// suffixed with @RFC3339 to schedule when the key starts signing.
+	KeyFiles []string `yaml:"key_files" toml:"key_files" env:"JWT_KEY_FILES"`
+	// KeyGrace is how long a replaced key still verifies tokens.
+	KeyGrace time.Duration `yaml:"key_grace" toml:"key_grace" env:"JWT_KEY_GRACE" default:"24h"`
+
+	// KeySet signs and verifies tokens, set once the keys are loaded.
+	KeySet *jwtkeys.KeySet `yaml:"-" toml:"-"`
+}
+
+type PostgresConfig struct {
+	Host     string `yaml:"host" toml:"host" env:"DB_HOST" required:"true"`
+	Port     string `yaml:"port" toml:"port" env:"DB_PORT" default:"5432"`
+	User     string `yaml:"user" toml:"user" env:"DB_USER" required:"true"`
+	Password string `yaml:"password" toml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name     string `yaml:"name" toml:"name" env:"DB_NAME" required:"true"`
+
+	// TLS settings, passed through to libpq-style connection parameters
+	SSLMode     string `yaml:"sslmode" toml:"sslmode" env:"DB_SSLMODE" default:"disable"`
+	SSLRootCert string `yaml:"sslrootcert" toml:"sslrootcert" env:"DB_SSLROOTCERT"`
+	SSLCert     string `yaml:"sslcert" toml:"sslcert" env:"DB_SSLCERT"`
+	SSLKey      string `yaml:"sslkey" toml:"sslkey" env:"DB_SSLKEY"`
+
+	// Pool sizing
+	MaxOpenConns    int           `yaml:"max_open_conns" toml:"max_open_conns" env:"DB_MAX_OPEN_CONNS" default:"25"`
+	MaxIdleConns    int           `yaml:"max_idle_conns" toml:"max_idle_conns" env:"DB_MAX_IDLE_CONNS" default:"10"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME" default:"30m"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time" toml:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME" default:"5m"`
+
+	// StatementTimeout is enforced server-side; zero disables it.
+	StatementTimeout time.Duration `yaml:"statement_timeout" toml:"statement_timeout" env:"DB_STATEMENT_TIMEOUT" default:"30s"`
+
+	// Optional read replica sharing the primary's credentials
+	ReplicaHost string `yaml:"replica_host" toml:"replica_host" env:"DB_REPLICA_HOST"`
+	ReplicaPort string `yaml:"replica_port" toml:"replica_port" env:"DB_REPLICA_PORT" default:"5432"`
+}
+
+type MongoConfig struct {
+	URI      string `yaml:"uri" toml:"uri" env:"MONGO_URI" default:"mongodb://localhost:27017" secret:"true"`
+	Database string `yaml:"database" toml:"database" env:"MONGO_DB_NAME" default:"audit_db"`
+
+	// Pool and timeouts
+	MaxPoolSize            uint64        `yaml:"max_pool_size" toml:"max_pool_size" env:"MONGO_MAX_POOL_SIZE" default:"100"`
+	MinPoolSize            uint64        `yaml:"min_pool_size" toml:"min_pool_size" env:"MONGO_MIN_POOL_SIZE" default:"0"`
+	ConnectTimeout         time.Duration `yaml:"connect_timeout" toml:"connect_timeout" env:"MONGO_CONNECT_TIMEOUT" default:"10s"`
+	ServerSelectionTimeout time.Duration `yaml:"server_selection_timeout" toml:"server_selection_timeout" env:"MONGO_SERVER_SELECTION_TIMEOUT" default:"5s"`
+	SocketTimeout          time.Duration `yaml:"socket_timeout" toml:"socket_timeout" env:"MONGO_SOCKET_TIMEOUT" default:"30s"`
+
+	// TLS and x509 authentication. CertKeyFile holds the client certificate
+	// followed by its private key, as expected by MongoDB.
+	TLS            bool   `yaml:"tls" toml:"tls" env:"MONGO_TLS"`
+	TLSCAFile      string `yaml:"tls_ca_file" toml:"tls_ca_file" env:"MONGO_TLS_CA_FILE"`
+	TLSCertKeyFile string `yaml:"tls_cert_key_file" toml:"tls_cert_key_file" env:"MONGO_TLS_CERT_KEY_FILE"`
+	AuthMechanism  string `yaml:"auth_mechanism" toml:"auth_mechanism" env:"MONGO_AUTH_MECHANISM"`
+
+	// Write concern applied to audit inserts: "majority" or a node count.
+	WriteConcern string        `yaml:"write_concern" toml:"write_concern" env:"MONGO_WRITE_CONCERN" default:"majority"`
+	Journal      bool          `yaml:"journal" toml:"journal" env:"MONGO_JOURNAL" default:"true"`
+	WriteTimeout time.Duration `yaml:"write_timeout" toml:"write_timeout" env:"MONGO_WRITE_TIMEOUT" default:"5s"`
+
+	// Startup retry with exponential backoff
+	ConnectRetries int           `yaml:"connect_retries" toml:"connect_retries" env:"MONGO_CONNECT_RETRIES" default:"5"`
+	RetryBackoff   time.Duration `yaml:"retry_backoff" toml:"retry_backoff" env:"MONGO_RETRY_BACKOFF" default:"1s"`
+	MaxBackoff     time.Duration `yaml:"max_backoff" toml:"max_backoff" env:"MONGO_MAX_BACKOFF" default:"30s"`
+}
+
+type AuditConfig struct {
+	// Required controls whether an unreachable audit store makes the
+	// service not ready. When false the service reports itself as degraded.
+	Required bool `yaml:"required" toml:"required" env:"AUDIT_REQUIRED" default:"true"`
+	// PseudonymKey keys the pseudonyms that replace erased users' IDs in
+	// the audit log and the audit chain hashes. Changing it invalidates the
+	// chain. Without it pseudonyms can be reversed by anyone who knows a
+	// user ID, so erasure is refused, and it is required in production.
+	PseudonymKey string `yaml:"pseudonym_key" toml:"pseudonym_key" env:"AUDIT_PSEUDONYM_KEY" secret:"true"`
+}
+
+type TracingConfig struct {
+	// Exporter selects the OpenTelemetry span exporter: otlp, stdout or none.
+	Exporter    string `yaml:"exporter" toml:"exporter" env:"OTEL_TRACES_EXPORTER" default:"none"`
+	ServiceName string `yaml:"service_name" toml:"service_name" env:"OTEL_SERVICE_NAME" default:"todo-apps"`
+}
+
+var validSSLModes = map[string]bool{
+	"disable": true, "allow": true, "prefer": true,
+	"require": true, "verify-ca": true, "verify-full": true,
+}
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr" toml:"addr" env:"REDIS_ADDR" default:"localhost:6379"`
+	Password string `yaml:"password" toml:"password" env:"REDIS_PASSWORD" secret:"true"`
+	DB       int    `yaml:"db" toml:"db" env:"REDIS_DB" default:"0"`
+}
+
+type RateLimitConfig struct {
+	// Store is memory or redis.
+	Store string `yaml:"store" toml:"store" env:"RATE_LIMIT_STORE" default:"memory"`
+
+	// Sliding-window attempt limits for /auth/login
+	Window        time.Duration `yaml:"window" toml:"window" env:"LOGIN_RATE_WINDOW" default:"1m"`
+	IPLimit       int           `yaml:"ip_limit" toml:"ip_limit" env:"LOGIN_RATE_IP_LIMIT" default:"20"`
+	UsernameLimit int           `yaml:"username_limit" toml:"username_limit" env:"LOGIN_RATE_USERNAME_LIMIT" default:"5"`
+
+	// Progressive delay and lockout after repeated failures
+	FailureWindow    time.Duration `yaml:"failure_window" toml:"failure_window" env:"LOGIN_FAILURE_WINDOW" default:"15m"`
+	LockoutThreshold int           `yaml:"lockout_threshold" toml:"lockout_threshold" env:"LOGIN_LOCKOUT_THRESHOLD" default:"10"`
+	LockoutDuration  time.Duration `yaml:"lockout_duration" toml:"lockout_duration" env:"LOGIN_LOCKOUT_DURATION" default:"15m"`
+	DelayStep        time.Duration `yaml:"delay_step" toml:"delay_step" env:"LOGIN_DELAY_STEP" default:"250ms"`
+	MaxDelay         time.Duration `yaml:"max_delay" toml:"max_delay" env:"LOGIN_MAX_DELAY" default:"3s"`
+}
+
+type PasswordConfig struct {
+	MinLength     int  `yaml:"min_length" toml:"min_length" env:"PASSWORD_MIN_LENGTH" default:"10"`
+	RequireUpper  bool `yaml:"require_upper" toml:"require_upper" env:"PASSWORD_REQUIRE_UPPER" default:"true"`
+	RequireLower  bool `yaml:"require_lower" toml:"require_lower" env:"PASSWORD_REQUIRE_LOWER" default:"true"`
+	RequireDigit  bool `yaml:"require_digit" toml:"require_digit" env:"PASSWORD_REQUIRE_DIGIT" default:"true"`
+	RequireSymbol bool `yaml:"require_symbol" toml:"require_symbol" env:"PASSWORD_REQUIRE_SYMBOL" default:"false"`
+	// HistorySize is how many previous passwords may not be reused; zero disables the check.
+	HistorySize int `yaml:"history_size" toml:"history_size" env:"PASSWORD_HISTORY_SIZE" default:"5"`
+	// BreachListFile optionally names an offline breached-password list.
+	BreachListFile string `yaml:"breach_list_file" toml:"breach_list_file" env:"PASSWORD_BREACH_LIST_FILE"`
+
+	// Hashing: new hashes use HashAlgorithm; hashes made with another
+	// algorithm or other parameters are upgraded on the next login.
+	HashAlgorithm     string `yaml:"hash_algorithm" toml:"hash_algorithm" env:"PASSWORD_HASH_ALGORITHM" default:"argon2id"`
+	Argon2MemoryKiB   uint32 `yaml:"argon2_memory_kib" toml:"argon2_memory_kib" env:"ARGON2_MEMORY_KIB" default:"65536"`
+	Argon2Iterations  uint32 `yaml:"argon2_iterations" toml:"argon2_iterations" env:"ARGON2_ITERATIONS" default:"3"`
+	Argon2Parallelism uint8  `yaml:"argon2_parallelism" toml:"argon2_parallelism" env:"ARGON2_PARALLELISM" default:"2"`
+	BcryptCost        int    `yaml:"bcrypt_cost" toml:"bcrypt_cost" env:"BCRYPT_COST" default:"12"`
+
+	// ResetTokenTTL bounds how long an emailed reset link stays valid.
+	ResetTokenTTL time.Duration `yaml:"reset_token_ttl" toml:"reset_token_ttl" env:"PASSWORD_RESET_TOKEN_TTL" default:"30m"`
+}
+
+type TwoFactorConfig struct {
+	Issuer string `yaml:"issuer" toml:"issuer" env:"TOTP_ISSUER" default:"todo-apps"`
+	// ChallengeTTL bounds the time between the password step and the code step.
+	ChallengeTTL  time.Duration `yaml:"challenge_ttl" toml:"challenge_ttl" env:"TWO_FACTOR_CHALLENGE_TTL" default:"5m"`
+	RecoveryCodes int           `yaml:"recovery_codes" toml:"recovery_codes" env:"TWO_FACTOR_RECOVERY_CODES" default:"10"`
+}
+
+type AccessTokenConfig struct {
+	// DefaultTTL applies when a personal access token is created without an expiry.
+	DefaultTTL time.Duration `yaml:"default_ttl" toml:"default_ttl" env:"PAT_DEFAULT_TTL" default:"720h"`
+	MaxTTL     time.Duration `yaml:"max_ttl" toml:"max_ttl" env:"PAT_MAX_TTL" default:"8760h"`
+}
+
+// OIDCConfig enables single sign-on through an external OpenID Connect
+// provider. Login is disabled while IssuerURL is empty.
+type OIDCConfig struct {
+	IssuerURL    string `yaml:"issuer_url" toml:"issuer_url" env:"OIDC_ISSUER_URL"`
+	ClientID     string `yaml:"client_id" toml:"client_id" env:"OIDC_CLIENT_ID"`
+	ClientSecret string `yaml:"client_secret" toml:"client_secret" env:"OIDC_CLIENT_SECRET" secret:"true"`
+	// RedirectURL defaults to APP_PUBLIC_URL + /auth/oidc/callback.
+	RedirectURL   string   `yaml:"redirect_url" toml:"redirect_url" env:"OIDC_REDIRECT_URL"`
+	Scopes        []string `yaml:"scopes" toml:"scopes" env:"OIDC_SCOPES" default:"openid,profile,email"`
+	UsernameClaim string   `yaml:"username_claim" toml:"username_claim" env:"OIDC_USERNAME_CLAIM" default:"preferred_username"`
+	GroupsClaim   string   `yaml:"groups_claim" toml:"groups_claim" env:"OIDC_GROUPS_CLAIM" default:"groups"`
+	// GroupPositions maps IdP groups to positions as group=Position name.
+	// Only the positions listed here are granted or removed on login.
+	GroupPositions []string      `yaml:"group_positions" toml:"group_positions" env:"OIDC_GROUP_POSITIONS"`
+	StateTTL       time.Duration `yaml:"state_ttl" toml:"state_ttl" env:"OIDC_STATE_TTL" default:"10m"`
+}
+
+func (c OIDCConfig) Enabled() bool {
+	return c.IssuerURL != ""
+}
+
+// Registration modes.
+const (
+	RegistrationOpen       = "open"
+	RegistrationInviteOnly = "invite_only"
+	RegistrationDisabled   = "disabled"
+)
+
+// RegistrationConfig controls how accounts are created. Administrators can
+// always invite users, whatever the mode.
+type RegistrationConfig struct {
+	// Mode is open, invite_only or disabled and applies to /auth/register.
+	Mode string `yaml:"mode" toml:"mode" env:"REGISTRATION_MODE" default:"open"`
+	// VerifyEmail keeps self-registered accounts pending until the link sent
+	// to their email address is used.
+	VerifyEmail     bool          `yaml:"verify_email" toml:"verify_email" env:"REGISTRATION_VERIFY_EMAIL" default:"true"`
+	VerificationTTL time.Duration `yaml:"verification_ttl" toml:"verification_ttl" env:"EMAIL_VERIFICATION_TTL" default:"24h"`
+	InviteTTL       time.Duration `yaml:"invite_ttl" toml:"invite_ttl" env:"INVITE_TTL" default:"168h"`
+}
+
+type NotifierConfig struct {
+	// Driver is smtp, file or log.
+	Driver       string `yaml:"driver" toml:"driver" env:"NOTIFIER_DRIVER" default:"log"`
+	FilePath     string `yaml:"file_path" toml:"file_path" env:"NOTIFIER_FILE_PATH" default:"notifications.log"`
+	SMTPHost     string `yaml:"smtp_host" toml:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     string `yaml:"smtp_port" toml:"smtp_port" env:"SMTP_PORT" default:"587"`
+	SMTPUsername string `yaml:"smtp_username" toml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `yaml:"smtp_password" toml:"smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+	From         string `yaml:"from" toml:"from" env:"SMTP_FROM" default:"no-reply@localhost"`
+}
+
+// Load builds the configuration from defaults, the optional config file and
+// the environment, then validates it.
+func Load() (*Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("load .env: %w", err)
+	}
+
+	cfg := &Config{}
+	if err := applyDefaults(cfg); err != nil {
+		return nil, err
+	}
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("unsupported config file format %q", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// IsProduction reports whether the service runs in production mode.
+func (c *Config) IsProduction() bool {
+	return strings.EqualFold(c.Env, "production") || strings.EqualFold(c.Env, "prod")
+}
+
+// Validate checks required fields and refuses insecure settings in
+// production.
+func (c *Config) Validate() error {
+	var errs []error
+	for _, name := range missingRequired(c) {
+		errs = append(errs, fmt.Errorf("%s is required", name))
+	}
+
+	if len(c.JWT.KeyFiles) == 0 {
+		if c.JWT.Secret == "" {
+			errs = append(errs, errors.New("JWT_SECRET must not be empty"))
+		}
+		if c.IsProduction() && c.JWT.Secret == InsecureJWTSecret {
+			errs = append(errs, errors.New("JWT_SECRET must be changed from the insecure default in production"))
+		}
+	}
+	if c.JWT.TTL <= 0 {
+		errs = append(errs, errors.New("JWT_TTL must be positive"))
+	}
+	if c.JWT.ImpersonationTTL <= 0 || c.JWT.ImpersonationTTL > c.JWT.TTL {
+		errs = append(errs, errors.New("JWT_IMPERSONATION_TTL must be positive and no longer than JWT_TTL"))
+	}
+	if c.IsProduction() && len(c.Audit.PseudonymKey) < MinPseudonymKeyLength {
+		errs = append(errs, fmt.Errorf("AUDIT_PSEUDONYM_KEY must be at least %d bytes in production", MinPseudonymKeyLength))
+	}
+	if c.OIDC.Enabled() && c.OIDC.ClientID == "" {
+		errs = append(errs, errors.New("OIDC_CLIENT_ID is required when OIDC_ISSUER_URL is set"))
+	}
+	for _, mapping := range c.OIDC.GroupPositions {
+		if group, position, ok := strings.Cut(mapping, "="); !ok || group == "" || position == "" {
+			errs = append(errs, fmt.Errorf("OIDC_GROUP_POSITIONS entry %q must have the form group=Position", mapping))
+		}
+	}
+	if len(c.JWT.KeyFiles) > 0 && c.JWT.KeyGrace < c.JWT.TTL {
+		errs = append(errs, errors.New("JWT_KEY_GRACE must be at least JWT_TTL so tokens signed before a rotation stay valid"))
+	}
+	if !validSSLModes[c.Postgres.SSLMode] {
+		errs = append(errs, fmt.Errorf("DB_SSLMODE %q is not one of disable, allow, prefer, require, verify-ca, verify-full", c.Postgres.SSLMode))
+	}
+	if c.Mongo.AuthMechanism == "MONGODB-X509" && c.Mongo.TLSCertKeyFile == "" {
+		errs = append(errs, errors.New("MONGO_TLS_CERT_KEY_FILE is required for MONGODB-X509 authentication"))
+	}
+	if c.Mongo.ConnectRetries < 0 {
+		errs = append(errs, errors.New("MONGO_CONNECT_RETRIES must not be negative"))
+	}
+	if c.Password.MinLength < 1 {
+		errs = append(errs, errors.New("PASSWORD_MIN_LENGTH must be at least 1"))
+	}
+	if c.Password.HashAlgorithm != "argon2id" && c.Password.HashAlgorithm != "bcrypt" {
+		errs = append(errs, fmt.Errorf("PASSWORD_HASH_ALGORITHM %q is not one of argon2id, bcrypt", c.Password.HashAlgorithm))
+	}
+	if c.Notifier.Driver == "smtp" && c.Notifier.SMTPHost == "" {
+		errs = append(errs, errors.New("SMTP_HOST is required when NOTIFIER_DRIVER is smtp"))
+	}
+	switch c.Registration.Mode {
+	case RegistrationOpen, RegistrationInviteOnly, RegistrationDisabled:
+	default:
+		errs = append(errs, fmt.Errorf("REGISTRATION_MODE %q is not one of open, invite_only, disabled", c.Registration.Mode))
+	}
+	if c.RateLimit.Store != "memory" && c.RateLimit.Store != "redis" {
+		errs = append(errs, fmt.Errorf("RATE_LIMIT_STORE %q is not one of memory, redis", c.RateLimit.Store))
+	}
+	if c.Postgres.MaxIdleConns > c.Postgres.MaxOpenConns && c.Postgres.MaxOpenConns > 0 {
+		errs = append(errs, errors.New("DB_MAX_IDLE_CONNS must not exceed DB_MAX_OPEN_CONNS"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// String renders the configuration with secrets masked.
+func (c *Config) String() string {
+	return fmt.Sprint(masked(c))
+}
+
+// LogValue implements slog.LogValuer so logging a Config never leaks secrets.
+func (c *Config) LogValue() slog.Value {
+	return slog.AnyValue(masked(c))
+}
@@ -2,46 +2,71 @@ package config
 
 import (
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+	"strings"
+	"time"
+
+	"todo-apps/logging"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
-type Config struct {
-	Database *gorm.DB
-}
+// ConnectDB opens the primary connection and, when DB_REPLICA_HOST is set, a
+// read replica. Without a replica both returned handles are the primary.
+func ConnectDB(cfg PostgresConfig) (primary *gorm.DB, replica *gorm.DB) {
+	primary = openDB(cfg, cfg.Host, cfg.Port)
+	slog.Info("Database connected successfully", "host", cfg.Host, "database", cfg.Name)
 
-func NewConfig() *Config {
-	return &Config{
-		Database: connectDB(),
+	if cfg.ReplicaHost == "" {
+		return primary, primary
 	}
-}
 
-func connectDB() *gorm.DB {
-	// Database connection parameters
-	host := getEnv("DB_HOST", "")
-	port := getEnv("DB_PORT", "")
-	user := getEnv("DB_USER", "")
-	password := getEnv("DB_PASSWORD", "")
-	dbname := getEnv("DB_NAME", "")
+	replica = openDB(cfg, cfg.ReplicaHost, cfg.ReplicaPort)
+	slog.Info("Read replica connected successfully", "host", cfg.ReplicaHost, "database", cfg.Name)
+	return primary, replica
+}
 
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		host, port, user, password, dbname)
+func openDB(cfg PostgresConfig, host, port string) *gorm.DB {
+	db, err := gorm.Open(postgres.Open(buildDSN(cfg, host, port)), &gorm.Config{
+		Logger: logging.NewGormLogger(200 * time.Millisecond),
+	})
+	if err != nil {
+		logging.Fatal("Failed to connect to database", "host", host, "error", err)
+	}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	sqlDB, err := db.DB()
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		logging.Fatal("Failed to configure database pool", "host", host, "error", err)
 	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 
-	log.Println("Database connected successfully")
 	return db
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
+func buildDSN(cfg PostgresConfig, host, port string) string {
+	params := []string{
+		fmt.Sprintf("host=%s", host),
+		fmt.Sprintf("port=%s", port),
+		fmt.Sprintf("user=%s", cfg.User),
+		fmt.Sprintf("password=%s", cfg.Password),
+		fmt.Sprintf("dbname=%s", cfg.Name),
+		fmt.Sprintf("sslmode=%s", cfg.SSLMode),
+	}
+	if cfg.SSLRootCert != "" {
+		params = append(params, fmt.Sprintf("sslrootcert=%s", cfg.SSLRootCert))
+	}
+	if cfg.SSLCert != "" {
+		params = append(params, fmt.Sprintf("sslcert=%s", cfg.SSLCert))
+	}
+	if cfg.SSLKey != "" {
+		params = append(params, fmt.Sprintf("sslkey=%s", cfg.SSLKey))
+	}
+	if cfg.StatementTimeout > 0 {
+		params = append(params, fmt.Sprintf("statement_timeout=%d", cfg.StatementTimeout.Milliseconds()))
 	}
-	return defaultValue
+	return strings.Join(params, " ")
 }
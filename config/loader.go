@@ -0,0 +1,162 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maskedValue = "****"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// applyDefaults sets every field with a `default` tag.
+func applyDefaults(cfg *Config) error {
+	return walk(reflect.ValueOf(cfg).Elem(), func(field reflect.StructField, value reflect.Value) error {
+		if def, ok := field.Tag.Lookup("default"); ok {
+			return setValue(value, def, field.Name)
+		}
+		return nil
+	})
+}
+
+// applyEnv overrides fields from the environment variable named in their
+// `env` tag when it is set.
+func applyEnv(cfg *Config) error {
+	return walk(reflect.ValueOf(cfg).Elem(), func(field reflect.StructField, value reflect.Value) error {
+		name := field.Tag.Get("env")
+		if name == "" {
+			return nil
+		}
+		if raw, ok := os.LookupEnv(name); ok && raw != "" {
+			return setValue(value, raw, name)
+		}
+		return nil
+	})
+}
+
+// missingRequired lists the env names of `required` fields left empty.
+func missingRequired(cfg *Config) []string {
+	var missing []string
+	walk(reflect.ValueOf(cfg).Elem(), func(field reflect.StructField, value reflect.Value) error {
+		if field.Tag.Get("required") == "true" && value.IsZero() {
+			missing = append(missing, field.Tag.Get("env"))
+		}
+		return nil
+	})
+	return missing
+}
+
+// masked returns the configuration as nested maps keyed by yaml name with
+// every `secret` field replaced.
+func masked(cfg *Config) map[string]interface{} {
+	return maskStruct(reflect.ValueOf(cfg).Elem())
+}
+
+func maskStruct(v reflect.Value) map[string]interface{} {
+	out := map[string]interface{}{}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+		if name == "-" || name == "" || !field.IsExported() {
+			continue
+		}
+
+		value := v.Field(i)
+		switch {
+		case value.Kind() == reflect.Struct:
+			out[name] = maskStruct(value)
+		case field.Tag.Get("secret") == "true":
+			if value.IsZero() {
+				out[name] = ""
+			} else {
+				out[name] = maskedValue
+			}
+		default:
+			out[name] = value.Interface()
+		}
+	}
+	return out
+}
+
+// walk visits every leaf field of the configuration, descending into nested
+// structs.
+func walk(v reflect.Value, visit func(reflect.StructField, reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Tag.Get("yaml") == "-" {
+			continue
+		}
+
+		value := v.Field(i)
+		if value.Kind() == reflect.Struct && value.Type() != durationType {
+			if err := walk(value, visit); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := visit(field, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setValue(value reflect.Value, raw, name string) error {
+	if value.Type() == durationType {
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("%s: invalid duration %q", name, raw)
+		}
+		value.SetInt(int64(d))
+		return nil
+	}
+
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%s: invalid boolean %q", name, raw)
+		}
+		value.SetBool(b)
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: invalid integer %q", name, raw)
+		}
+		value.SetInt(n)
+	case reflect.Uint, reflect.Uint32, reflect.Uint64, reflect.Uint8:
+		n, err := strconv.ParseUint(raw, 10, value.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%s: invalid unsigned integer %q", name, raw)
+		}
+		value.SetUint(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%s: invalid number %q", name, raw)
+		}
+		value.SetFloat(f)
+	case reflect.Slice:
+		if value.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("%s: unsupported slice type", name)
+		}
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("%s: unsupported field type %s", name, value.Type())
+	}
+	return nil
+}
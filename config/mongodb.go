@@ -2,44 +2,187 @@ package config
 
 import (
 	"context"
-	"log"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync/atomic"
 	"time"
 
+	"todo-apps/logging"
+
+	"go.mongodb.org/mongo-driver/event"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/description"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/mongo/writeconcern"
+	"go.opentelemetry.io/contrib/instrumentation/go.mongodb.org/mongo-driver/mongo/otelmongo"
+)
+
+// Connection states reported by MongoDB.State.
+const (
+	MongoConnecting   = "connecting"
+	MongoConnected    = "connected"
+	MongoDisconnected = "disconnected"
 )
 
 type MongoDB struct {
 	Client   *mongo.Client
 	Database *mongo.Database
+	state    atomic.Value
 }
 
-func NewMongoDB() *MongoDB {
-	uri := getEnv("MONGO_URI", "mongodb://localhost:27017")
-	dbName := getEnv("MONGO_DB_NAME", "audit_db")
+// NewMongoDB connects to MongoDB, retrying the initial ping with exponential
+// backoff. When every attempt fails the process exits if required is true;
+// otherwise the client is returned disconnected and the driver keeps trying
+// to reach the server in the background.
+func NewMongoDB(cfg MongoConfig, required bool) *MongoDB {
+	m := &MongoDB{}
+	m.state.Store(MongoConnecting)
 
-	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(uri))
+	clientOptions, err := mongoClientOptions(cfg)
 	if err != nil {
-		log.Fatal("Failed to connect to MongoDB:", err)
+		logging.Fatal("Invalid MongoDB configuration", "error", err)
 	}
+	clientOptions.SetServerMonitor(&event.ServerMonitor{
+		TopologyDescriptionChanged: m.topologyChanged,
+	})
 
-	// Test the connection
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	err = client.Ping(ctx, nil)
+	client, err := mongo.Connect(context.Background(), clientOptions)
 	if err != nil {
-		log.Fatal("Failed to ping MongoDB:", err)
+		logging.Fatal("Failed to connect to MongoDB", "error", err)
 	}
+	m.Client = client
+	m.Database = client.Database(cfg.Database)
 
-	log.Println("MongoDB connected successfully")
+	backoff := cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
+		err = client.Ping(ctx, readpref.Primary())
+		cancel()
+		if err == nil {
+			m.state.Store(MongoConnected)
+			slog.Info("MongoDB connected successfully", "database", cfg.Database)
+			return m
+		}
+		if attempt >= cfg.ConnectRetries {
+			break
+		}
 
-	return &MongoDB{
-		Client:   client,
-		Database: client.Database(dbName),
+		slog.Warn("Failed to ping MongoDB, retrying", "attempt", attempt+1, "backoff", backoff, "error", err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, cfg.MaxBackoff)
 	}
+
+	m.state.Store(MongoDisconnected)
+	if required {
+		logging.Fatal("Failed to ping MongoDB", "error", err)
+	}
+	slog.Warn("MongoDB unreachable, continuing with audit logging degraded", "error", err)
+	return m
+}
+
+// State reports the last known connection state: connecting, connected or
+// disconnected.
+func (m *MongoDB) State() string {
+	return m.state.Load().(string)
 }
 
 func (m *MongoDB) Disconnect() error {
 	return m.Client.Disconnect(context.TODO())
 }
+
+// topologyChanged is called by the driver with the topology locked, so it
+// must not run any operation on the client.
+func (m *MongoDB) topologyChanged(e *event.TopologyDescriptionChangedEvent) {
+	for _, server := range e.NewDescription.Servers {
+		if server.Kind != description.Unknown {
+			m.state.Store(MongoConnected)
+			return
+		}
+	}
+	m.state.Store(MongoDisconnected)
+}
+
+func mongoClientOptions(cfg MongoConfig) (*options.ClientOptions, error) {
+	clientOptions := options.Client().
+		ApplyURI(cfg.URI).
+		SetMonitor(otelmongo.NewMonitor()).
+		SetMaxPoolSize(cfg.MaxPoolSize).
+		SetMinPoolSize(cfg.MinPoolSize).
+		SetConnectTimeout(cfg.ConnectTimeout).
+		SetServerSelectionTimeout(cfg.ServerSelectionTimeout).
+		SetSocketTimeout(cfg.SocketTimeout)
+
+	writeConcern, err := mongoWriteConcern(cfg)
+	if err != nil {
+		return nil, err
+	}
+	clientOptions.SetWriteConcern(writeConcern)
+
+	if cfg.TLS || cfg.TLSCAFile != "" || cfg.TLSCertKeyFile != "" {
+		tlsConfig, err := mongoTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		clientOptions.SetTLSConfig(tlsConfig)
+	}
+
+	if cfg.AuthMechanism != "" {
+		credential := options.Credential{AuthMechanism: cfg.AuthMechanism}
+		if cfg.AuthMechanism == "MONGODB-X509" {
+			credential.AuthSource = "$external"
+		}
+		clientOptions.SetAuth(credential)
+	}
+
+	return clientOptions, nil
+}
+
+func mongoWriteConcern(cfg MongoConfig) (*writeconcern.WriteConcern, error) {
+	journal := cfg.Journal
+	writeConcern := &writeconcern.WriteConcern{
+		Journal:  &journal,
+		WTimeout: cfg.WriteTimeout,
+	}
+
+	if cfg.WriteConcern == "majority" {
+		writeConcern.W = "majority"
+	} else {
+		nodes, err := strconv.Atoi(cfg.WriteConcern)
+		if err != nil {
+			return nil, fmt.Errorf("MONGO_WRITE_CONCERN must be \"majority\" or a number, got %q", cfg.WriteConcern)
+		}
+		writeConcern.W = nodes
+	}
+	return writeConcern, nil
+}
+
+func mongoTLSConfig(cfg MongoConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.TLSCAFile != "" {
+		caPEM, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read MongoDB CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.TLSCertKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertKeyFile, cfg.TLSCertKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load MongoDB client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"todo-apps/logging"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// NewRedis connects to a Redis-compatible server.
+func NewRedis(cfg RedisConfig) *redis.Client {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := client.Ping(ctx).Err(); err != nil {
+		logging.Fatal("Failed to ping Redis", "addr", cfg.Addr, "error", err)
+	}
+
+	slog.Info("Redis connected successfully", "addr", cfg.Addr)
+	return client
+}
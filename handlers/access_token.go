@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"todo-apps/config"
+	"todo-apps/logging"
+	"todo-apps/middleware"
+	"todo-apps/models"
+	"todo-apps/services"
+	"todo-apps/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type AccessTokenHandler struct {
+	db           *gorm.DB
+	tokens       config.AccessTokenConfig
+	auditService *services.AuditService
+}
+
+func NewAccessTokenHandler(cfg *config.Config, auditService *services.AuditService) *AccessTokenHandler {
+	return &AccessTokenHandler{
+		db:           cfg.Database,
+		tokens:       cfg.AccessTokens,
+		auditService: auditService,
+	}
+}
+
+type CreateAccessTokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresIn is a Go duration such as "720h"; defaults to PAT_DEFAULT_TTL.
+	ExpiresIn string `json:"expires_in"`
+}
+
+// GET /me/tokens - List the current user's personal access tokens
+func (h *AccessTokenHandler) GetTokens(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+	var tokens []models.PersonalAccessToken
+
+	if err := db.Where("user_id = ?", c.Locals("user_id")).Order("created_at DESC").Find(&tokens).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to fetch tokens", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch tokens",
+		})
+	}
+
+	data := make([]AccessTokenView, len(tokens))
+	for i, token := range tokens {
+		data[i] = NewAccessTokenView(token)
+	}
+
+	return c.JSON(fiber.Map{
+		"data": data,
+	})
+}
+
+// POST /me/tokens - Create a personal access token, shown only once
+func (h *AccessTokenHandler) CreateToken(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+	var req CreateAccessTokenRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	var violations []utils.PolicyViolation
+	if strings.TrimSpace(req.Name) == "" {
+		violations = append(violations, utils.PolicyViolation{Field: "name", Code: "required", Message: "Name is required"})
+	}
+	if len(req.Scopes) == 0 {
+		violations = append(violations, utils.PolicyViolation{Field: "scopes", Code: "required", Message: "At least one scope is required"})
+	}
+	for _, scope := range req.Scopes {
+		if !middleware.IsValidScope(scope) {
+			violations = append(violations, utils.PolicyViolation{Field: "scopes", Code: "invalid", Message: "Unknown scope " + scope})
+		}
+	}
+
+	ttl := h.tokens.DefaultTTL
+	if req.ExpiresIn != "" {
+		parsed, err := time.ParseDuration(req.ExpiresIn)
+		if err != nil || parsed <= 0 {
+			violations = append(violations, utils.PolicyViolation{Field: "expires_in", Code: "invalid", Message: "Expiry must be a positive duration such as 720h"})
+		}
+		ttl = parsed
+	}
+	if ttl > h.tokens.MaxTTL {
+		violations = append(violations, utils.PolicyViolation{Field: "expires_in", Code: "too_long", Message: "Expiry exceeds the maximum of " + h.tokens.MaxTTL.String()})
+	}
+	if len(violations) > 0 {
+		return validationError(c, "Invalid token request", violations)
+	}
+
+	secret, _, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to generate token", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+	plaintext := middleware.PATPrefix + secret
+
+	userID, _ := uuid.Parse(c.Locals("user_id").(string))
+	token := models.PersonalAccessToken{
+		UserID:    userID,
+		Name:      strings.TrimSpace(req.Name),
+		Prefix:    plaintext[:len(middleware.PATPrefix)+6],
+		TokenHash: utils.HashToken(plaintext), // the hash covers the prefix too
+		Scopes:    strings.Join(req.Scopes, " "),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+
+	if err := db.Create(&token).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to create token", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create token",
+		})
+	}
+
+	// Log audit
+	h.auditService.LogCreate(c.UserContext(), userID.String(), "personal_access_tokens", token.ID.String(), map[string]interface{}{
+		"name":       token.Name,
+		"scopes":     req.Scopes,
+		"expires_at": token.ExpiresAt,
+	})
+
+	view := NewAccessTokenView(token)
+	view.Token = plaintext
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"data": view,
+	})
+}
+
+// DELETE /me/tokens/:id - Revoke a personal access token
+func (h *AccessTokenHandler) RevokeToken(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+
+	// Parse UUID
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid token ID",
+		})
+	}
+
+	result := db.Model(&models.PersonalAccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, c.Locals("user_id")).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to revoke token", "error", result.Error)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to revoke token",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Token not found",
+		})
+	}
+
+	// Log audit
+	h.auditService.LogAction(c.UserContext(), c.Locals("user_id").(string), "REVOKE", "personal_access_tokens", id.String(), nil, nil)
+
+	return c.JSON(fiber.Map{
+		"message": "Token revoked successfully",
+	})
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"todo-apps/config"
+	"todo-apps/logging"
+	"todo-apps/models"
+	"todo-apps/ratelimit"
+	"todo-apps/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type AdminHandler struct {
+	db           *gorm.DB
+	limiter      *ratelimit.LoginLimiter
+	auditService *services.AuditService
+}
+
+func NewAdminHandler(cfg *config.Config, limiter *ratelimit.LoginLimiter, auditService *services.AuditService) *AdminHandler {
+	return &AdminHandler{
+		db:           cfg.Database,
+		limiter:      limiter,
+		auditService: auditService,
+	}
+}
+
+// POST /admin/users/:id/unlock - Lift a login lockout
+func (h *AdminHandler) UnlockUser(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+
+	// Parse UUID
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	var user models.User
+	if err := db.First(&user, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
+		logging.FromContext(c.UserContext()).Error("Failed to fetch user", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch user",
+		})
+	}
+
+	if err := h.limiter.Unlock(c.UserContext(), user.Username); err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to unlock user", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to unlock user",
+		})
+	}
+
+	// Log audit
+	authUserID := c.Locals("user_id")
+	if authUserID != nil {
+		h.auditService.LogAction(c.UserContext(), authUserID.(string), "UNLOCK", "users", id.String(), nil, nil)
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "User unlocked successfully",
+	})
+}
+
+type RequireTwoFactorRequest struct {
+	Required bool `json:"required"`
+}
+
+// PUT /admin/positions/:id/require-2fa - Require 2FA for holders of a position
+func (h *AdminHandler) SetPositionTwoFactor(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+
+	// Parse UUID
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid position ID",
+		})
+	}
+
+	var req RequireTwoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	var position models.Position
+	if err := db.First(&position, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "Position not found",
+			})
+		}
+		logging.FromContext(c.UserContext()).Error("Failed to fetch position", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch position",
+		})
+	}
+
+	before := position.Require2FA
+	if err := db.Model(&position).Update("require_2fa", req.Required).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to update position", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update position",
+		})
+	}
+
+	// Log audit
+	authUserID := c.Locals("user_id")
+	if authUserID != nil {
+		h.auditService.LogUpdate(c.UserContext(), authUserID.(string), "positions", id.String(),
+			map[string]interface{}{"require_2fa": before},
+			map[string]interface{}{"require_2fa": req.Required})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": NewPositionView(position),
+	})
+}
+
+type UserStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// PUT /admin/users/:id/status - Suspend or reactivate a user. Reactivating
+// also restores deactivated users.
+func (h *AdminHandler) SetUserStatus(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+
+	// Parse UUID
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	var req UserStatusRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+	if req.Status != models.UserStatusActive && req.Status != models.UserStatusSuspended {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Status must be \"active\" or \"suspended\"",
+		})
+	}
+
+	var user models.User
+	if err := db.First(&user, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
+		logging.FromContext(c.UserContext()).Error("Failed to fetch user", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch user",
+		})
+	}
+
+	// Suspending also revokes the user's outstanding sessions
+	before := user.Status
+	updates := map[string]interface{}{"status": req.Status}
+	if req.Status == models.UserStatusSuspended && before != models.UserStatusSuspended {
+		updates["token_version"] = gorm.Expr("token_version + 1")
+	}
+	if req.Status == models.UserStatusActive {
+		updates["deactivated_at"] = nil
+	}
+	if err := db.Model(&user).Updates(updates).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to update user status", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to update user status",
+		})
+	}
+	user.Status = req.Status
+	if req.Status == models.UserStatusActive {
+		user.DeactivatedAt = nil
+	}
+
+	// Log audit
+	authUserID := c.Locals("user_id")
+	if authUserID != nil {
+		h.auditService.LogUpdate(c.UserContext(), authUserID.(string), "users", id.String(),
+			map[string]interface{}{"status": before},
+			map[string]interface{}{"status": req.Status})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": NewUserView(user),
+	})
+}
+
+// GET /admin/audit/verify - Check the audit log hash chain
+func (h *AdminHandler) VerifyAuditLog(c *fiber.Ctx) error {
+	result, err := h.auditService.Verify(c.UserContext())
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to verify audit log", "error", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Audit log is temporarily unavailable",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": result,
+	})
+}
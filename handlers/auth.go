@@ -1,21 +1,42 @@
 package handlers
 
 import (
+	"math"
+	"strconv"
+	"time"
+
 	"todo-apps/config"
+	"todo-apps/logging"
+	"todo-apps/metrics"
 	"todo-apps/models"
+	"todo-apps/ratelimit"
+	"todo-apps/services"
 	"todo-apps/utils"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 type AuthHandler struct {
-	db *gorm.DB
+	db                *gorm.DB
+	jwt               config.JWTConfig
+	twoFactor         config.TwoFactorConfig
+	registration      config.RegistrationConfig
+	limiter           *ratelimit.LoginLimiter
+	passwordService   *services.PasswordService
+	onboardingService *services.OnboardingService
 }
 
-func NewAuthHandler(cfg *config.Config) *AuthHandler {
+func NewAuthHandler(cfg *config.Config, limiter *ratelimit.LoginLimiter, passwordService *services.PasswordService, onboardingService *services.OnboardingService) *AuthHandler {
 	return &AuthHandler{
-		db: cfg.Database,
+		db:                cfg.Database,
+		jwt:               cfg.JWT,
+		twoFactor:         cfg.TwoFactor,
+		registration:      cfg.Registration,
+		limiter:           limiter,
+		passwordService:   passwordService,
+		onboardingService: onboardingService,
 	}
 }
 
@@ -25,16 +46,30 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Token string      `json:"token"`
-	User  models.User `json:"user"`
+	Token         string   `json:"token"`
+	User          UserView `json:"user"`
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+// TwoFactorChallengeResponse is returned by Login instead of a token when a
+// second factor is needed. EnrollmentRequired means the user holds a position
+// that requires 2FA but has not set it up yet.
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired  bool   `json:"two_factor_required"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+	ChallengeToken     string `json:"challenge_token"`
 }
 
 type RegisterResponse struct {
-	User models.User `json:"user"`
+	User UserView `json:"user"`
+	// VerificationRequired means the account stays pending until the link
+	// emailed to the user is used.
+	VerificationRequired bool `json:"verification_required"`
 }
 
 // POST /auth/login - Login user
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
 	var req LoginRequest
 
 	if err := c.BodyParser(&req); err != nil {
@@ -43,82 +78,283 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		})
 	}
 
+	// Throttle by client IP and username before touching the password hash
+	if allowed, err := enforceLoginRateLimit(c, h.limiter, req.Username); !allowed {
+		return err
+	}
+
 	// Find user by username
 	var user models.User
 
-	if err := h.db.Select("*").Where("username = ?", req.Username).First(&user).Error; err != nil {
+	if err := db.Select("*").Where("username = ?", req.Username).First(&user).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
+			h.recordFailure(c, req.Username)
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Invalid credentials",
 			})
 		}
+		logging.FromContext(c.UserContext()).Error("Database error", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Database error",
 		})
 	}
 
 	// Check password
-	isValid := utils.CheckPasswordHash(req.Password, user.Password)
+	isValid, outdated := utils.CheckPasswordHash(req.Password, user.Password)
 
 	if !isValid {
+		h.recordFailure(c, req.Username)
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 			"error": "Invalid credentials",
 		})
-	} // Generate JWT token
-	token, err := utils.GenerateJWT(user.ID.String(), user.Username)
+	}
+
+	if message := loginStatusError(user); message != "" {
+		metrics.LoginAttempts.WithLabelValues(user.Status).Inc()
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	if outdated {
+		h.rehashPassword(c, user, req.Password)
+	}
+
+	// Two-factor users must complete a second step with a challenge token.
+	// Failures are only cleared once that step succeeds, otherwise logging in
+	// again would reset the count of wrong codes.
+	purpose := ""
+	if user.TwoFactorEnabled {
+		purpose = twoFactorChallengePurpose
+	} else {
+		required, err := requiresTwoFactor(db, user.ID)
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("Failed to check two-factor requirement", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to check two-factor requirement",
+			})
+		}
+		if required {
+			purpose = twoFactorEnrollPurpose
+		}
+	}
+	if purpose != "" {
+		challenge, err := utils.GenerateChallengeJWT(h.jwt.KeySet, h.twoFactor.ChallengeTTL, user, purpose)
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("Failed to generate challenge token", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to generate challenge token",
+			})
+		}
+		return c.JSON(TwoFactorChallengeResponse{
+			TwoFactorRequired:  true,
+			EnrollmentRequired: purpose == twoFactorEnrollPurpose,
+			ChallengeToken:     challenge,
+		})
+	}
+
+	recordLoginSuccess(c, h.limiter, user.Username)
+	return respondWithToken(c, db, h.jwt, user, nil)
+}
+
+// respondWithToken completes a login by issuing a JWT for user and recording
+// the login time. Every login method finishes here, so the account status is
+// enforced here too. recoveryCodes are included when the login also
+// finished two-factor enrollment.
+func respondWithToken(c *fiber.Ctx, db *gorm.DB, jwtCfg config.JWTConfig, user models.User, recoveryCodes []string) error {
+	if message := loginStatusError(user); message != "" {
+		metrics.LoginAttempts.WithLabelValues(user.Status).Inc()
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+
+	// Generate JWT token
+	token, err := issueToken(c, db, jwtCfg, user)
 	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to generate token", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to generate token",
 		})
 	}
 
-	// Remove password from response
-	user.Password = ""
+	metrics.LoginAttempts.WithLabelValues("success").Inc()
+
+	now := time.Now()
+	if err := db.Model(&user).UpdateColumn("last_login_at", now).Error; err != nil {
+		logging.FromContext(c.UserContext()).Warn("Failed to record last login", "user_id", user.ID, "error", err)
+	}
+	user.LastLoginAt = &now
 
 	return c.JSON(LoginResponse{
-		Token: token,
-		User:  user,
+		Token:         token,
+		User:          NewUserView(user),
+		RecoveryCodes: recoveryCodes,
 	})
 }
 
+// loginStatusError returns why user may not log in, or "" if they may.
+func loginStatusError(user models.User) string {
+	switch user.Status {
+	case models.UserStatusSuspended:
+		return "Account is suspended"
+	case models.UserStatusPending:
+		return "Email address has not been verified"
+	case models.UserStatusDeactivated:
+		return "Account is deactivated"
+	}
+	return ""
+}
+
+// enforceLoginRateLimit applies the login limiter for username. When the
+// attempt is not allowed it writes the 429 response and returns false.
+func enforceLoginRateLimit(c *fiber.Ctx, limiter *ratelimit.LoginLimiter, username string) (bool, error) {
+	decision, err := limiter.Allow(c.UserContext(), c.IP(), username)
+	if err != nil {
+		// Fail open so an unavailable rate limit store doesn't block every login
+		logging.FromContext(c.UserContext()).Error("Failed to check login rate limit", "error", err)
+		decision = ratelimit.Decision{Allowed: true}
+	}
+	if !decision.Allowed {
+		metrics.LoginAttempts.WithLabelValues("throttled").Inc()
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+		message := "Too many login attempts, try again later"
+		if decision.Locked {
+			message = "Account temporarily locked due to repeated failed logins"
+		}
+		return false, c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": message,
+		})
+	}
+	if decision.Delay > 0 {
+		select {
+		case <-time.After(decision.Delay):
+		case <-c.UserContext().Done():
+		}
+	}
+	return true, nil
+}
+
+// recordLoginSuccess clears the failure history for username once it has
+// fully authenticated, including any second factor.
+func recordLoginSuccess(c *fiber.Ctx, limiter *ratelimit.LoginLimiter, username string) {
+	if err := limiter.RecordSuccess(c.UserContext(), username); err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to reset login failures", "error", err)
+	}
+}
+
+// rehashPassword upgrades a hash made with an outdated algorithm or
+// parameters. Failures are logged but never block the login.
+func (h *AuthHandler) rehashPassword(c *fiber.Ctx, user models.User, password string) {
+	hashedPassword, err := utils.HashPassword(password)
+	if err == nil {
+		err = h.db.WithContext(c.UserContext()).Model(&user).Update("password", hashedPassword).Error
+	}
+	if err != nil {
+		logging.FromContext(c.UserContext()).Warn("Failed to rehash password", "user_id", user.ID, "error", err)
+	}
+}
+
+func (h *AuthHandler) recordFailure(c *fiber.Ctx, username string) {
+	metrics.LoginAttempts.WithLabelValues("failure").Inc()
+	if err := h.limiter.RecordFailure(c.UserContext(), username); err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to record login failure", "error", err)
+	}
+}
+
 // POST /auth/register - Register new user
 func (h *AuthHandler) Register(c *fiber.Ctx) error {
-	var user models.User
+	db := h.db.WithContext(c.UserContext())
+	var req UserRequest
 
-	if err := c.BodyParser(&user); err != nil {
+	switch h.registration.Mode {
+	case config.RegistrationDisabled:
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Registration is disabled",
+		})
+	case config.RegistrationInviteOnly:
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Registration is by invitation only",
+		})
+	}
+
+	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid request body",
 		})
 	}
+	if h.registration.VerifyEmail && req.Email == "" {
+		return validationError(c, "Invalid profile", []utils.PolicyViolation{
+			{Field: "email", Code: "required", Message: "Email address is required"},
+		})
+	}
+
+	// Validate optional profile settings
+	user := models.User{Name: req.Name, Username: req.Username}
+	if h.registration.VerifyEmail {
+		user.Status = models.UserStatusPending
+	}
+	violations, err := profileViolations(db, uuid.Nil, &user, req)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to validate profile", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to validate profile",
+		})
+	}
+	if len(violations) > 0 {
+		return validationError(c, "Invalid profile", violations)
+	}
+
+	// Enforce password policy
+	violations, err = h.passwordService.Validate(c.UserContext(), uuid.Nil, req.Password)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to validate password", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to validate password",
+		})
+	}
+	if len(violations) > 0 {
+		return validationError(c, "Password does not meet policy", violations)
+	}
 
 	// Hash password
-	hashedPassword, err := utils.HashPassword(user.Password)
+	hashedPassword, err := utils.HashPassword(req.Password)
 	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to hash password", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to hash password",
 		})
 	}
 	user.Password = hashedPassword
 
-	// Create user
-	if err := h.db.Create(&user).Error; err != nil {
+	// Create user and record the initial password in its history
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return h.passwordService.Record(tx, user.ID, user.Password)
+	})
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to create user", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create user",
 		})
 	}
 
 	// Generate JWT token
-	// token, err := utils.GenerateJWT(user.ID.String(), user.Username)
+	// token, err := utils.GenerateJWT(h.jwt.KeySet, h.jwt.TTL, user.ID.String(), user.Username)
 	// if err != nil {
 	// 	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 	// 		"error": "Failed to generate token",
 	// 	})
 	// }
 
-	// Remove password from response
-	user.Password = ""
+	if h.registration.VerifyEmail {
+		sendVerification(c, db, h.onboardingService, user)
+	}
 
 	return c.Status(fiber.StatusCreated).JSON(RegisterResponse{
-		User: user,
+		User:                 NewUserView(user),
+		VerificationRequired: h.registration.VerifyEmail,
 	})
 }
@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"todo-apps/config"
+	"todo-apps/models"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"gorm.io/gorm"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+type HealthHandler struct {
+	db            *gorm.DB
+	readDB        *gorm.DB
+	mongodb       *config.MongoDB
+	auditRequired bool
+}
+
+func NewHealthHandler(cfg *config.Config, mongodb *config.MongoDB) *HealthHandler {
+	return &HealthHandler{
+		db:            cfg.Database,
+		readDB:        cfg.ReadDatabase,
+		mongodb:       mongodb,
+		auditRequired: cfg.Audit.Required,
+	}
+}
+
+type DependencyStatus struct {
+	Status    string  `json:"status"` // up, down
+	LatencyMS float64 `json:"latency_ms"`
+	State     string  `json:"state,omitempty"`
+	Error     string  `json:"error,omitempty"`
+	Fatal     bool    `json:"fatal"`
+}
+
+type ReadinessResponse struct {
+	Status string                      `json:"status"` // ready, degraded, not_ready
+	Checks map[string]DependencyStatus `json:"checks"`
+}
+
+// GET /healthz - Process liveness
+func (h *HealthHandler) Liveness(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status": "ok",
+	})
+}
+
+// GET /readyz - Readiness including database, audit store and schema version
+func (h *HealthHandler) Readiness(c *fiber.Ctx) error {
+	checks := map[string]DependencyStatus{
+		"database":   h.check(true, pingDatabase(h.db)),
+		"migrations": h.check(true, h.checkMigrations),
+		"audit":      h.check(h.auditRequired, h.pingAudit),
+	}
+
+	audit := checks["audit"]
+	audit.State = h.mongodb.State()
+	checks["audit"] = audit
+
+	if h.readDB != h.db {
+		checks["replica"] = h.check(true, pingDatabase(h.readDB))
+	}
+
+	response := ReadinessResponse{Status: "ready", Checks: checks}
+	for _, check := range checks {
+		if check.Status == "up" {
+			continue
+		}
+		if check.Fatal {
+			response.Status = "not_ready"
+			break
+		}
+		response.Status = "degraded"
+	}
+
+	if response.Status == "not_ready" {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(response)
+	}
+	return c.JSON(response)
+}
+
+func (h *HealthHandler) check(fatal bool, probe func(ctx context.Context) error) DependencyStatus {
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := probe(ctx)
+	status := DependencyStatus{
+		Status:    "up",
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+		Fatal:     fatal,
+	}
+	if err != nil {
+		status.Status = "down"
+		status.Error = err.Error()
+	}
+	return status
+}
+
+func pingDatabase(db *gorm.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return err
+		}
+		return sqlDB.PingContext(ctx)
+	}
+}
+
+func (h *HealthHandler) checkMigrations(ctx context.Context) error {
+	version, err := models.CurrentSchemaVersion(h.db.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	if version != models.SchemaVersion {
+		return fmt.Errorf("schema version %d does not match expected %d", version, models.SchemaVersion)
+	}
+	return nil
+}
+
+func (h *HealthHandler) pingAudit(ctx context.Context) error {
+	return h.mongodb.Client.Ping(ctx, readpref.Primary())
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"time"
+
+	"todo-apps/config"
+	"todo-apps/jwtkeys"
+	"todo-apps/logging"
+	"todo-apps/middleware"
+	"todo-apps/models"
+	"todo-apps/services"
+	"todo-apps/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ImpersonationHandler lets administrators act as another user to see what
+// they see. Every request made with the token is flagged and audited under
+// both users.
+type ImpersonationHandler struct {
+	db             *gorm.DB
+	keys           *jwtkeys.KeySet
+	ttl            time.Duration
+	adminPositions []string
+	auditService   *services.AuditService
+}
+
+func NewImpersonationHandler(cfg *config.Config, auditService *services.AuditService) *ImpersonationHandler {
+	return &ImpersonationHandler{
+		db:             cfg.Database,
+		keys:           cfg.JWT.KeySet,
+		ttl:            cfg.JWT.ImpersonationTTL,
+		adminPositions: cfg.AdminPositions,
+		auditService:   auditService,
+	}
+}
+
+type ImpersonationRequest struct {
+	// Reason is recorded in the audit log, such as a support ticket.
+	Reason string `json:"reason"`
+}
+
+type ImpersonationResponse struct {
+	Token        string    `json:"token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	User         UserView  `json:"user"`
+	Impersonator UserView  `json:"impersonator"`
+}
+
+// POST /admin/users/:id/impersonate - Issue a short-lived token to act as
+// a user
+func (h *ImpersonationHandler) Impersonate(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+	var req ImpersonationRequest
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+
+	authUserID, _ := c.Locals("user_id").(string)
+	if authUserID == id.String() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You cannot impersonate yourself",
+		})
+	}
+
+	var actor, subject models.User
+	err = db.First(&actor, "id = ?", authUserID).Error
+	if err == nil {
+		err = db.First(&subject, "id = ?", id).Error
+	}
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
+		logging.FromContext(c.UserContext()).Error("Failed to fetch user", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch user",
+		})
+	}
+	if subject.Status != models.UserStatusActive {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Only active users can be impersonated",
+		})
+	}
+
+	// Acting as another administrator would let one admin borrow another's
+	// identity for admin actions
+	isAdmin, err := middleware.IsAdmin(c.UserContext(), db, subject.ID.String(), h.adminPositions)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to check permissions", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check permissions",
+		})
+	}
+	if isAdmin {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Administrators cannot be impersonated",
+		})
+	}
+
+	session, err := startSession(c, db, subject, h.ttl, &actor)
+	var token string
+	if err == nil {
+		token, err = utils.GenerateImpersonationJWT(h.keys, h.ttl, actor, subject, session.ID.String())
+	}
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to generate token", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+
+	// Log audit
+	h.auditService.LogAction(c.UserContext(), authUserID, "IMPERSONATE", "users", subject.ID.String(), nil, map[string]interface{}{
+		"reason":     req.Reason,
+		"session_id": session.ID.String(),
+		"expires_at": session.ExpiresAt,
+	})
+
+	return c.Status(fiber.StatusCreated).JSON(ImpersonationResponse{
+		Token:        token,
+		ExpiresAt:    session.ExpiresAt,
+		User:         NewUserView(subject),
+		Impersonator: NewUserView(actor),
+	})
+}
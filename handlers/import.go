@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"io"
+
+	"todo-apps/config"
+	"todo-apps/logging"
+	"todo-apps/services"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ImportHandler struct {
+	importService *services.ImportService
+}
+
+func NewImportHandler(cfg *config.Config, importService *services.ImportService) *ImportHandler {
+	return &ImportHandler{importService: importService}
+}
+
+// POST /admin/users/import - Create users from an uploaded CSV or XLSX file
+func (h *ImportHandler) ImportUsers(c *fiber.Ctx) error {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "A file is required in the file form field",
+		})
+	}
+	file, err := header.Open()
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to read file",
+		})
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Failed to read file",
+		})
+	}
+
+	rows, err := services.ParseImportFile(header.Filename, data)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid import file: " + err.Error(),
+		})
+	}
+
+	authUserID, _ := c.Locals("user_id").(string)
+	report, err := h.importService.Import(c.UserContext(), authUserID, rows, c.QueryBool("dry_run"))
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to import users", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to import users",
+		})
+	}
+
+	// Invalid rows are skipped; the request only fails if nothing was usable
+	status := fiber.StatusOK
+	switch {
+	case report.Created > 0:
+		status = fiber.StatusCreated
+	case !report.DryRun:
+		status = fiber.StatusUnprocessableEntity
+	}
+	return c.Status(status).JSON(fiber.Map{
+		"data": report,
+	})
+}
@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"todo-apps/config"
+	"todo-apps/jwtkeys"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type JWKSHandler struct {
+	keys *jwtkeys.KeySet
+}
+
+func NewJWKSHandler(cfg *config.Config) *JWKSHandler {
+	return &JWKSHandler{
+		keys: cfg.JWT.KeySet,
+	}
+}
+
+// GET /.well-known/jwks.json - Public keys for verifying issued tokens
+func (h *JWKSHandler) GetKeys(c *fiber.Ctx) error {
+	// Keys scheduled for activation are already listed, so verifiers can
+	// cache the set briefly without missing a rotation
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(h.keys.JWKS())
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"todo-apps/config"
+	"todo-apps/logging"
+	"todo-apps/models"
+	"todo-apps/services"
+	"todo-apps/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Fields users may change on their own profile. Everything else is either
+// read-only or managed elsewhere: passwords through /me/password and
+// positions by administrators.
+var selfEditableFields = map[string]bool{
+	"name":        true,
+	"email":       true,
+	"timezone":    true,
+	"locale":      true,
+	"avatar_url":  true,
+	"preferences": true,
+}
+
+var selfReadOnlyFields = map[string]string{
+	"id":                 "The user ID cannot be changed",
+	"username":           "Username can only be changed by an administrator",
+	"password":           "Use POST /api/me/password to change your password",
+	"two_factor_enabled": "Use the /api/me/2fa endpoints to manage two-factor authentication",
+	"positions":          "Position assignments are managed by administrators",
+	"user_positions":     "Position assignments are managed by administrators",
+	"status":             "Account status is managed by administrators",
+	"email_verified_at":  "Use POST /auth/email/verify/resend to verify your email address",
+	"created_at":         "Timestamps are maintained by the server",
+	"updated_at":         "Timestamps are maintained by the server",
+	"last_login_at":      "Timestamps are maintained by the server",
+}
+
+const (
+	defaultActivityLimit = 50
+	maxActivityLimit     = 200
+)
+
+type MeHandler struct {
+	db           *gorm.DB
+	readDB       *gorm.DB
+	auditService *services.AuditService
+}
+
+func NewMeHandler(cfg *config.Config, auditService *services.AuditService) *MeHandler {
+	return &MeHandler{
+		db:           cfg.Database,
+		readDB:       cfg.ReadDatabase,
+		auditService: auditService,
+	}
+}
+
+// GET /me - Get the current user's profile
+func (h *MeHandler) GetProfile(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+	var user models.User
+
+	if err := db.First(&user, "id = ?", c.Locals("user_id")).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
+		logging.FromContext(c.UserContext()).Error("Failed to fetch user", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch user",
+		})
+	}
+
+	// Make it obvious to the administrator whose account they are in
+	response := fiber.Map{
+		"data": NewProfileView(user),
+	}
+	if impersonatorID, ok := c.Locals("impersonator_id").(string); ok {
+		response["impersonated_by"] = fiber.Map{
+			"id":       impersonatorID,
+			"username": c.Locals("impersonator_username"),
+		}
+	}
+	return c.JSON(response)
+}
+
+// PATCH /me - Update the current user's own profile fields
+func (h *MeHandler) UpdateProfile(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	// Reject the whole request if any field may not be edited
+	var violations []utils.PolicyViolation
+	updates := map[string]interface{}{}
+	for field, raw := range body {
+		if message, readOnly := selfReadOnlyFields[field]; readOnly {
+			violations = append(violations, utils.PolicyViolation{Field: field, Code: "read_only", Message: message})
+			continue
+		}
+		if !selfEditableFields[field] {
+			violations = append(violations, utils.PolicyViolation{Field: field, Code: "unknown_field", Message: "Unknown field " + field})
+			continue
+		}
+
+		value, violation := normalizeProfileField(field, raw)
+		if violation != nil {
+			violations = append(violations, *violation)
+			continue
+		}
+		updates[field] = value
+	}
+	if email, ok := updates["email"].(string); ok && len(violations) == 0 {
+		userID, _ := uuid.Parse(c.Locals("user_id").(string))
+		taken, err := emailTaken(db, email, userID)
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("Failed to validate profile", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to validate profile",
+			})
+		}
+		if taken {
+			violations = append(violations, utils.PolicyViolation{Field: "email", Code: "taken", Message: "Email address is already in use"})
+		}
+	}
+	if len(violations) > 0 {
+		return validationError(c, "Profile update rejected", violations)
+	}
+
+	var user models.User
+	if err := db.First(&user, "id = ?", c.Locals("user_id")).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to fetch user", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch user",
+		})
+	}
+
+	// A new address must be verified again
+	if email, ok := updates["email"]; ok && !sameEmail(user.Email, email) {
+		updates["email_verified_at"] = nil
+	}
+
+	before := map[string]interface{}{}
+	for field := range updates {
+		before[field] = profileField(user, field)
+	}
+
+	if len(updates) > 0 {
+		if err := db.Model(&user).Updates(updates).Error; err != nil {
+			logging.FromContext(c.UserContext()).Error("Failed to update profile", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to update profile",
+			})
+		}
+
+		// Log audit
+		h.auditService.LogUpdate(c.UserContext(), user.ID.String(), "users", user.ID.String(), before, updates)
+
+		// Get updated user
+		db.First(&user, "id = ?", user.ID)
+	}
+
+	return c.JSON(fiber.Map{
+		"data": NewProfileView(user),
+	})
+}
+
+// profileField returns the current value of a self-editable field.
+func profileField(user models.User, field string) interface{} {
+	switch field {
+	case "name":
+		return user.Name
+	case "email":
+		return user.Email
+	case "timezone":
+		return user.Timezone
+	case "locale":
+		return user.Locale
+	case "avatar_url":
+		return user.AvatarURL
+	case "preferences":
+		return user.Preferences
+	case "email_verified_at":
+		return user.EmailVerifiedAt
+	}
+	return nil
+}
+
+// GET /me/tasks - Get tasks assigned to the current user
+func (h *MeHandler) GetTasks(c *fiber.Ctx) error {
+	db := h.readDB.WithContext(c.UserContext())
+	var tasks []models.Task
+
+	loc, err := requestedLocation(c, db)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "tz must be \"me\" or an IANA timezone name",
+		})
+	}
+
+	if err := db.Where("user_id = ?", c.Locals("user_id")).Order("start_date").Find(&tasks).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to fetch tasks", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch tasks",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": NewTaskViews(tasks, loc),
+	})
+}
+
+// GET /me/positions - Get positions held by the current user
+func (h *MeHandler) GetPositions(c *fiber.Ctx) error {
+	db := h.readDB.WithContext(c.UserContext())
+	var positions []models.Position
+
+	err := db.Joins("JOIN user_positions ON user_positions.position_id = positions.id").
+		Where("user_positions.user_id = ?", c.Locals("user_id")).
+		Order("positions.name").
+		Find(&positions).Error
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to fetch positions", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch positions",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": NewPositionViews(positions),
+	})
+}
+
+// GET /me/activity - Get the current user's audit trail, newest first.
+// Supports ?limit= and ?before=<RFC3339 timestamp> for paging.
+func (h *MeHandler) GetActivity(c *fiber.Ctx) error {
+	limit := defaultActivityLimit
+	if raw := c.Query("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > maxActivityLimit {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "limit must be between 1 and " + strconv.Itoa(maxActivityLimit),
+			})
+		}
+		limit = parsed
+	}
+
+	var before time.Time
+	if raw := c.Query("before"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "before must be an RFC 3339 timestamp",
+			})
+		}
+		before = parsed
+	}
+
+	logs, err := h.auditService.ListByUser(c.UserContext(), c.Locals("user_id").(string), before, int64(limit))
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to fetch activity", "error", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Activity is temporarily unavailable",
+		})
+	}
+
+	response := fiber.Map{
+		"data": NewAuditLogViews(logs),
+	}
+	if len(logs) == limit {
+		response["next_before"] = logs[len(logs)-1].Timestamp.Format(time.RFC3339Nano)
+	}
+	return c.JSON(response)
+}
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"slices"
+	"time"
+
+	"todo-apps/config"
+	"todo-apps/logging"
+	"todo-apps/models"
+	"todo-apps/services"
+	"todo-apps/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	oidcStateCookie  = "oidc_state"
+	oidcStatePurpose = "oidc_state"
+)
+
+var errUsernameTaken = errors.New("username already belongs to a local account")
+
+type OIDCHandler struct {
+	db           *gorm.DB
+	jwt          config.JWTConfig
+	cfg          config.OIDCConfig
+	secureCookie bool
+	oidc         *services.OIDCService
+	auditService *services.AuditService
+}
+
+func NewOIDCHandler(cfg *config.Config, oidc *services.OIDCService, auditService *services.AuditService) *OIDCHandler {
+	return &OIDCHandler{
+		db:           cfg.Database,
+		jwt:          cfg.JWT,
+		cfg:          cfg.OIDC,
+		secureCookie: cfg.IsProduction(),
+		oidc:         oidc,
+		auditService: auditService,
+	}
+}
+
+// oidcStateClaims carries the state, nonce and PKCE verifier of a pending
+// login in a signed cookie, so no server-side storage is needed. Purpose
+// keeps JWTMiddleware from accepting it.
+type oidcStateClaims struct {
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+	Purpose  string `json:"purpose"`
+	jwt.RegisteredClaims
+}
+
+// GET /auth/oidc/login - Redirect to the identity provider
+func (h *OIDCHandler) Login(c *fiber.Ctx) error {
+	if !h.cfg.Enabled() {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Single sign-on is not configured",
+		})
+	}
+
+	var values [3]string
+	for i := range values {
+		value, _, err := utils.GenerateOpaqueToken()
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("Failed to generate login state", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to start login",
+			})
+		}
+		values[i] = value
+	}
+	claims := oidcStateClaims{
+		State:    values[0],
+		Nonce:    values[1],
+		Verifier: values[2],
+		Purpose:  oidcStatePurpose,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(h.cfg.StateTTL)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	authURL, err := h.oidc.AuthCodeURL(c.UserContext(), claims.State, claims.Nonce, claims.Verifier)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to reach identity provider", "error", err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"error": "Identity provider is unavailable",
+		})
+	}
+	cookie, err := h.jwt.KeySet.Sign(claims)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to sign login state", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to start login",
+		})
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    cookie,
+		Path:     "/auth/oidc",
+		MaxAge:   int(h.cfg.StateTTL.Seconds()),
+		Secure:   h.secureCookie,
+		HTTPOnly: true,
+		// Lax so the cookie survives the top-level redirect back from the IdP
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+	return c.Redirect(authURL, fiber.StatusFound)
+}
+
+// GET /auth/oidc/callback - Complete single sign-on and issue a token
+func (h *OIDCHandler) Callback(c *fiber.Ctx) error {
+	if !h.cfg.Enabled() {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Single sign-on is not configured",
+		})
+	}
+	if idpError := c.Query("error"); idpError != "" {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error":       "Identity provider rejected the login",
+			"idp_error":   idpError,
+			"description": c.Query("error_description"),
+		})
+	}
+
+	// The state cookie is single use
+	stateCookie := c.Cookies(oidcStateCookie)
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/auth/oidc",
+		MaxAge:   -1,
+		Secure:   h.secureCookie,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	var claims oidcStateClaims
+	token, err := h.jwt.KeySet.Parse(stateCookie, &claims)
+	if err != nil || !token.Valid || claims.Purpose != oidcStatePurpose ||
+		subtle.ConstantTimeCompare([]byte(claims.State), []byte(c.Query("state"))) != 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid or expired login state",
+		})
+	}
+
+	identity, err := h.oidc.Exchange(c.UserContext(), c.Query("code"), claims.Verifier, claims.Nonce)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Warn("OIDC login failed", "error", err)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Single sign-on failed",
+		})
+	}
+
+	user, created, err := h.provision(c, identity)
+	if errors.Is(err, errUsernameTaken) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Username already belongs to a local account",
+		})
+	}
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to provision user", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to provision user",
+		})
+	}
+
+	// Log audit
+	if created {
+		h.auditService.LogCreate(c.UserContext(), user.ID.String(), "users", user.ID.String(), map[string]interface{}{
+			"username": user.Username,
+			"name":     user.Name,
+			"issuer":   identity.Issuer,
+			"subject":  identity.Subject,
+		})
+	}
+
+	// Second factors are the identity provider's responsibility for SSO logins
+	return respondWithToken(c, h.db.WithContext(c.UserContext()), h.jwt, user, nil)
+}
+
+// provision finds the user linked to identity, creating one on first login,
+// and syncs the positions managed by the IdP's groups.
+func (h *OIDCHandler) provision(c *fiber.Ctx, identity *services.OIDCIdentity) (user models.User, created bool, err error) {
+	db := h.db.WithContext(c.UserContext())
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var link models.UserIdentity
+		err := tx.Where("issuer = ? AND subject = ?", identity.Issuer, identity.Subject).First(&link).Error
+		switch {
+		case err == nil:
+			if err := tx.First(&user, "id = ?", link.UserID).Error; err != nil {
+				return err
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// Never link to an existing local account by username; that
+			// would let the IdP take over accounts it doesn't own
+			var count int64
+			if err := tx.Model(&models.User{}).Where("username = ?", identity.Username).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return errUsernameTaken
+			}
+
+			// SSO users have no local password
+			user = models.User{Name: identity.Name, Username: identity.Username}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			link = models.UserIdentity{UserID: user.ID, Issuer: identity.Issuer, Subject: identity.Subject}
+			if err := tx.Create(&link).Error; err != nil {
+				return err
+			}
+			created = true
+		default:
+			return err
+		}
+
+		return h.syncPositions(c, tx, user.ID, identity.Groups)
+	})
+	return user, created, err
+}
+
+// syncPositions grants the positions mapped from groups and removes other
+// IdP-managed positions. Positions not named in the mapping are left alone.
+func (h *OIDCHandler) syncPositions(c *fiber.Ctx, tx *gorm.DB, userID uuid.UUID, groups []string) error {
+	managed, granted := h.oidc.Positions(groups)
+	if len(managed) == 0 {
+		return nil
+	}
+
+	var positions []models.Position
+	if err := tx.Where("name IN ?", managed).Find(&positions).Error; err != nil {
+		return err
+	}
+	if len(positions) < len(managed) {
+		logging.FromContext(c.UserContext()).Warn("Some OIDC mapped positions do not exist", "positions", managed)
+	}
+
+	var current []models.UserPosition
+	if err := tx.Where("user_id = ?", userID).Find(&current).Error; err != nil {
+		return err
+	}
+	held := make(map[uuid.UUID]models.UserPosition, len(current))
+	for _, up := range current {
+		held[up.PositionID] = up
+	}
+
+	for _, position := range positions {
+		want := slices.Contains(granted, position.Name)
+		up, has := held[position.ID]
+		switch {
+		case want && !has:
+			if err := tx.Create(&models.UserPosition{UserID: userID, PositionID: position.ID}).Error; err != nil {
+				return err
+			}
+		case !want && has:
+			if err := tx.Delete(&up).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
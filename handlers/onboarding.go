@@ -0,0 +1,391 @@
+package handlers
+
+import (
+	"encoding/json"
+	"time"
+
+	"todo-apps/config"
+	"todo-apps/logging"
+	"todo-apps/models"
+	"todo-apps/services"
+	"todo-apps/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// OnboardingHandler serves admin invitations and the public endpoints that
+// redeem invitation and email verification links.
+type OnboardingHandler struct {
+	db                *gorm.DB
+	passwordService   *services.PasswordService
+	onboardingService *services.OnboardingService
+	auditService      *services.AuditService
+}
+
+func NewOnboardingHandler(cfg *config.Config, passwordService *services.PasswordService, onboardingService *services.OnboardingService, auditService *services.AuditService) *OnboardingHandler {
+	return &OnboardingHandler{
+		db:                cfg.Database,
+		passwordService:   passwordService,
+		onboardingService: onboardingService,
+		auditService:      auditService,
+	}
+}
+
+// InvitationRequest creates a pending user. Username defaults to the email
+// address.
+type InvitationRequest struct {
+	Name     string `json:"name"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+	Timezone string `json:"timezone"`
+	Locale   string `json:"locale"`
+}
+
+type AcceptInvitationRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+// POST /admin/invitations - Invite a user by email
+func (h *OnboardingHandler) Invite(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+	var req InvitationRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	var violations []utils.PolicyViolation
+	if req.Name == "" {
+		violations = append(violations, utils.PolicyViolation{Field: "name", Code: "required", Message: "Name is required"})
+	}
+	if req.Email == "" {
+		violations = append(violations, utils.PolicyViolation{Field: "email", Code: "required", Message: "Email address is required"})
+	}
+	if len(violations) > 0 {
+		return validationError(c, "Invalid invitation", violations)
+	}
+
+	user := models.User{Name: req.Name, Status: models.UserStatusPending}
+	violations, err := profileViolations(db, uuid.Nil, &user, UserRequest{
+		Email:    req.Email,
+		Timezone: req.Timezone,
+		Locale:   req.Locale,
+	})
+	if err == nil && len(violations) == 0 {
+		user.Username = req.Username
+		if user.Username == "" {
+			user.Username = *user.Email
+		}
+		violations, err = usernameViolations(db, user.Username)
+	}
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to validate invitation", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to validate invitation",
+		})
+	}
+	if len(violations) > 0 {
+		return validationError(c, "Invalid invitation", violations)
+	}
+
+	// The user has no password until the invitation is accepted
+	var token string
+	var expiresAt time.Time
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		var err error
+		token, expiresAt, err = h.onboardingService.Issue(tx, user, models.TokenPurposeInvite)
+		return err
+	})
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to create invitation", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create invitation",
+		})
+	}
+
+	if err := h.onboardingService.SendInvitation(c.UserContext(), user, token, expiresAt); err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to send invitation", "error", err)
+	}
+
+	// Log audit
+	authUserID := c.Locals("user_id")
+	if authUserID != nil {
+		userJSON, _ := json.Marshal(NewUserView(user))
+		var userData map[string]interface{}
+		json.Unmarshal(userJSON, &userData)
+
+		h.auditService.LogAction(c.UserContext(), authUserID.(string), "INVITE", "users", user.ID.String(), nil, userData)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"data":       NewUserView(user),
+		"expires_at": expiresAt,
+	})
+}
+
+// POST /admin/invitations/:id/resend - Send a new invitation link, voiding earlier ones
+func (h *OnboardingHandler) ResendInvitation(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+
+	// Parse UUID
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	var user models.User
+	if err := db.First(&user, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
+		logging.FromContext(c.UserContext()).Error("Failed to fetch user", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch user",
+		})
+	}
+	if user.Status != models.UserStatusPending || user.Password != "" || user.Email == nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "User has no outstanding invitation",
+		})
+	}
+
+	var token string
+	var expiresAt time.Time
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		token, expiresAt, err = h.onboardingService.Issue(tx, user, models.TokenPurposeInvite)
+		return err
+	})
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to create invitation", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to create invitation",
+		})
+	}
+
+	if err := h.onboardingService.SendInvitation(c.UserContext(), user, token, expiresAt); err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to send invitation", "error", err)
+	}
+
+	// Log audit
+	authUserID := c.Locals("user_id")
+	if authUserID != nil {
+		h.auditService.LogAction(c.UserContext(), authUserID.(string), "INVITE", "users", user.ID.String(), nil, nil)
+	}
+
+	return c.JSON(fiber.Map{
+		"data":       NewUserView(user),
+		"expires_at": expiresAt,
+	})
+}
+
+// POST /auth/invitations/accept - Choose a password and activate an invited account
+func (h *OnboardingHandler) AcceptInvitation(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+	var req AcceptInvitationRequest
+
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	invitation, err := h.onboardingService.Find(db, models.TokenPurposeInvite, req.Token)
+	if err != nil {
+		return tokenError(c, err)
+	}
+
+	violations, err := h.passwordService.Validate(c.UserContext(), invitation.UserID, req.Password)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to validate password", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to validate password",
+		})
+	}
+	if len(violations) > 0 {
+		return validationError(c, "Password does not meet policy", violations)
+	}
+
+	hashedPassword, err := utils.HashPassword(req.Password)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to hash password", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to hash password",
+		})
+	}
+
+	// The invitation link proves the user controls the email address
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := h.onboardingService.Claim(tx, invitation); err != nil {
+			return err
+		}
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND status = ?", invitation.UserID, models.UserStatusPending).
+			Updates(map[string]interface{}{
+				"status":            models.UserStatusActive,
+				"email_verified_at": time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return services.ErrVerificationTokenInvalid
+		}
+		return h.passwordService.Change(tx, invitation.UserID, hashedPassword)
+	})
+	if err != nil {
+		return tokenError(c, err)
+	}
+
+	h.auditService.LogAction(c.UserContext(), invitation.UserID.String(), "ACCEPT_INVITE", "users", invitation.UserID.String(), nil, nil)
+
+	return c.JSON(fiber.Map{
+		"message": "Invitation accepted, you can now log in",
+	})
+}
+
+// POST /auth/email/verify - Confirm an email address using a verification token
+func (h *OnboardingHandler) VerifyEmail(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+	var req VerifyEmailRequest
+
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	verification, err := h.onboardingService.Find(db, models.TokenPurposeVerifyEmail, req.Token)
+	if err != nil {
+		return tokenError(c, err)
+	}
+
+	// Verifying activates self-registered accounts, but never lifts a suspension
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := h.onboardingService.Claim(tx, verification); err != nil {
+			return err
+		}
+		err := tx.Model(&models.User{}).Where("id = ?", verification.UserID).
+			Update("email_verified_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).
+			Where("id = ? AND status = ?", verification.UserID, models.UserStatusPending).
+			Update("status", models.UserStatusActive).Error
+	})
+	if err != nil {
+		return tokenError(c, err)
+	}
+
+	h.auditService.LogAction(c.UserContext(), verification.UserID.String(), "VERIFY_EMAIL", "users", verification.UserID.String(), nil,
+		map[string]interface{}{"email": verification.Email})
+
+	return c.JSON(fiber.Map{
+		"message": "Email address verified",
+	})
+}
+
+// POST /auth/email/verify/resend - Send a new verification link
+func (h *OnboardingHandler) ResendVerification(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+	var req ResendVerificationRequest
+
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	// The response never reveals whether the address is registered
+	accepted := func() error {
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message": "If the address needs verification, a link has been sent",
+		})
+	}
+
+	email, err := utils.NormalizeEmail(req.Email)
+	if err != nil {
+		return accepted()
+	}
+
+	// Invited users verify by accepting their invitation instead
+	var user models.User
+	err = db.Where("email = ? AND email_verified_at IS NULL AND status NOT IN ? AND password <> ''", email, []string{models.UserStatusSuspended, models.UserStatusDeactivated}).
+		First(&user).Error
+	if err != nil {
+		if err != gorm.ErrRecordNotFound {
+			logging.FromContext(c.UserContext()).Error("Failed to fetch user", "error", err)
+		}
+		return accepted()
+	}
+
+	sendVerification(c, db, h.onboardingService, user)
+	return accepted()
+}
+
+// sendVerification issues a verification token for user and emails it.
+// Failures are logged; the user can always ask for a new link.
+func sendVerification(c *fiber.Ctx, db *gorm.DB, onboardingService *services.OnboardingService, user models.User) {
+	var token string
+	var expiresAt time.Time
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		token, expiresAt, err = onboardingService.Issue(tx, user, models.TokenPurposeVerifyEmail)
+		return err
+	})
+	if err == nil {
+		err = onboardingService.SendVerification(c.UserContext(), user, token, expiresAt)
+	}
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to send verification link", "error", err)
+	}
+}
+
+// usernameViolations reports a username that is empty or already taken.
+func usernameViolations(db *gorm.DB, username string) ([]utils.PolicyViolation, error) {
+	if username == "" {
+		return []utils.PolicyViolation{{Field: "username", Code: "required", Message: "Username is required"}}, nil
+	}
+	taken, err := usernameTaken(db, username, uuid.Nil)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return []utils.PolicyViolation{{Field: "username", Code: "taken", Message: "Username is already in use"}}, nil
+	}
+	return nil, nil
+}
+
+// tokenError responds to a failed invitation or verification token lookup.
+func tokenError(c *fiber.Ctx, err error) error {
+	if err == services.ErrVerificationTokenInvalid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": err.Error(),
+		})
+	}
+	logging.FromContext(c.UserContext()).Error("Failed to redeem token", "error", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "Failed to redeem token",
+	})
+}
@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+
+	"todo-apps/config"
+	"todo-apps/logging"
+	"todo-apps/models"
+	"todo-apps/ratelimit"
+	"todo-apps/services"
+	"todo-apps/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+var errResetTokenInvalid = errors.New("reset token is invalid or expired")
+
+type PasswordHandler struct {
+	db              *gorm.DB
+	jwt             config.JWTConfig
+	publicURL       string
+	resetTokenTTL   time.Duration
+	limiter         *ratelimit.LoginLimiter
+	passwordService *services.PasswordService
+	notifier        services.Notifier
+	auditService    *services.AuditService
+}
+
+func NewPasswordHandler(cfg *config.Config, limiter *ratelimit.LoginLimiter, passwordService *services.PasswordService, notifier services.Notifier, auditService *services.AuditService) *PasswordHandler {
+	return &PasswordHandler{
+		db:              cfg.Database,
+		jwt:             cfg.JWT,
+		publicURL:       cfg.PublicURL,
+		resetTokenTTL:   cfg.Password.ResetTokenTTL,
+		limiter:         limiter,
+		passwordService: passwordService,
+		notifier:        notifier,
+		auditService:    auditService,
+	}
+}
+
+type ForgotPasswordRequest struct {
+	Username string `json:"username"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// POST /auth/password/forgot - Email a single-use reset link
+func (h *PasswordHandler) ForgotPassword(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+	var req ForgotPasswordRequest
+
+	if err := c.BodyParser(&req); err != nil || req.Username == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	decision, err := h.limiter.AllowReset(c.UserContext(), c.IP(), req.Username)
+	if err != nil {
+		// Fail open like login does when the rate limit store is unavailable
+		logging.FromContext(c.UserContext()).Error("Failed to check reset rate limit", "error", err)
+		decision = ratelimit.Decision{Allowed: true}
+	}
+	if !decision.Allowed {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(decision.RetryAfter.Seconds()))))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": "Too many password reset requests, try again later",
+		})
+	}
+
+	// The response never reveals whether the account exists
+	accepted := func() error {
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message": "If the account exists, a reset link has been sent",
+		})
+	}
+
+	var user models.User
+	if err := db.Where("username = ?", req.Username).First(&user).Error; err != nil {
+		if err != gorm.ErrRecordNotFound {
+			logging.FromContext(c.UserContext()).Error("Failed to fetch user", "error", err)
+		}
+		return accepted()
+	}
+	if user.Email == nil {
+		return accepted()
+	}
+
+	// The link is issued and sent after answering, so the response time
+	// doesn't tell whether an email went out
+	go h.sendResetLink(context.WithoutCancel(c.UserContext()), user)
+
+	return accepted()
+}
+
+// sendResetLink invalidates user's unused reset links and emails a new one.
+// Failures can only be logged because the request has already been answered.
+func (h *PasswordHandler) sendResetLink(ctx context.Context, user models.User) {
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to generate reset token", "error", err)
+		return
+	}
+
+	// Issuing a new link invalidates any earlier unused ones
+	now := time.Now()
+	err = h.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", now).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&models.PasswordResetToken{
+			UserID:    user.ID,
+			TokenHash: tokenHash,
+			ExpiresAt: now.Add(h.resetTokenTTL),
+		}).Error
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to store reset token", "error", err)
+		return
+	}
+
+	link := fmt.Sprintf("%s/reset-password?token=%s", h.publicURL, url.QueryEscape(token))
+	err = h.notifier.Send(ctx, services.Message{
+		To:      *user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Use the link below to choose a new password. It expires in %s and can only be used once.\n\n%s\n\nIf you did not request this, you can ignore this message.",
+			h.resetTokenTTL, link),
+	})
+	if err != nil {
+		logging.FromContext(ctx).Error("Failed to send reset link", "error", err)
+	}
+}
+
+// POST /auth/password/reset - Set a new password using a reset token
+func (h *PasswordHandler) ResetPassword(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+	var req ResetPasswordRequest
+
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	var resetToken models.PasswordResetToken
+	err := db.Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(req.Token), time.Now()).
+		First(&resetToken).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": errResetTokenInvalid.Error(),
+			})
+		}
+		logging.FromContext(c.UserContext()).Error("Failed to fetch reset token", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch reset token",
+		})
+	}
+
+	violations, err := h.passwordService.Validate(c.UserContext(), resetToken.UserID, req.NewPassword)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to validate password", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to validate password",
+		})
+	}
+	if len(violations) > 0 {
+		return validationError(c, "Password does not meet policy", violations)
+	}
+
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to hash password", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to hash password",
+		})
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Claim the token atomically so concurrent requests can't both use it
+		result := tx.Model(&models.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", resetToken.ID).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errResetTokenInvalid
+		}
+		return h.passwordService.Change(tx, resetToken.UserID, hashedPassword)
+	})
+	if err == errResetTokenInvalid {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": errResetTokenInvalid.Error(),
+		})
+	}
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to reset password", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to reset password",
+		})
+	}
+
+	h.auditService.LogAction(c.UserContext(), resetToken.UserID.String(), "PASSWORD_RESET", "users", resetToken.UserID.String(), nil, nil)
+
+	return c.JSON(fiber.Map{
+		"message": "Password has been reset, please log in again",
+	})
+}
+
+// POST /api/me/password - Change the current user's password
+func (h *PasswordHandler) ChangePassword(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+	var req ChangePasswordRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	var user models.User
+	if err := db.First(&user, "id = ?", c.Locals("user_id")).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to fetch user", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch user",
+		})
+	}
+
+	if valid, _ := utils.CheckPasswordHash(req.CurrentPassword, user.Password); !valid {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Current password is incorrect",
+		})
+	}
+
+	violations, err := h.passwordService.Validate(c.UserContext(), user.ID, req.NewPassword)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to validate password", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to validate password",
+		})
+	}
+	if len(violations) > 0 {
+		return validationError(c, "Password does not meet policy", violations)
+	}
+
+	hashedPassword, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to hash password", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to hash password",
+		})
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return h.passwordService.Change(tx, user.ID, hashedPassword)
+	})
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to change password", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to change password",
+		})
+	}
+
+	h.auditService.LogAction(c.UserContext(), user.ID.String(), "PASSWORD_CHANGE", "users", user.ID.String(), nil, nil)
+
+	// Every existing token is now revoked, so hand the caller a fresh one
+	user.TokenVersion++
+	token, err := issueToken(c, db, h.jwt, user)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to generate token", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate token",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Password changed successfully",
+		"token":   token,
+	})
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"todo-apps/config"
+	"todo-apps/logging"
 	"todo-apps/models"
 	"todo-apps/services"
 
@@ -13,33 +14,38 @@ import (
 
 type PositionHandler struct {
 	db           *gorm.DB
+	readDB       *gorm.DB
 	auditService *services.AuditService
 }
 
 func NewPositionHandler(cfg *config.Config, auditService *services.AuditService) *PositionHandler {
 	return &PositionHandler{
 		db:           cfg.Database,
+		readDB:       cfg.ReadDatabase,
 		auditService: auditService,
 	}
 }
 
 // GET /positions - Get all positions
 func (h *PositionHandler) GetPositions(c *fiber.Ctx) error {
+	db := h.readDB.WithContext(c.UserContext())
 	var positions []models.Position
 
-	if err := h.db.Preload("UserPositions.User").Find(&positions).Error; err != nil {
+	if err := db.Preload("UserPositions.User").Find(&positions).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to fetch positions", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch positions",
 		})
 	}
 
 	return c.JSON(fiber.Map{
-		"data": positions,
+		"data": NewPositionViews(positions),
 	})
 }
 
 // POST /positions - Create a new position
 func (h *PositionHandler) CreatePosition(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
 	var position models.Position
 
 	if err := c.BodyParser(&position); err != nil {
@@ -48,8 +54,12 @@ func (h *PositionHandler) CreatePosition(c *fiber.Ctx) error {
 		})
 	}
 
+	// Only admins may require 2FA, through the admin endpoint
+	position.Require2FA = false
+
 	// Create position
-	if err := h.db.Create(&position).Error; err != nil {
+	if err := db.Create(&position).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to create position", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create position",
 		})
@@ -62,16 +72,17 @@ func (h *PositionHandler) CreatePosition(c *fiber.Ctx) error {
 		var positionData map[string]interface{}
 		json.Unmarshal(positionJSON, &positionData)
 
-		h.auditService.LogCreate(userID.(string), "positions", position.ID.String(), positionData)
+		h.auditService.LogCreate(c.UserContext(), userID.(string), "positions", position.ID.String(), positionData)
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"data": position,
+		"data": NewPositionView(position),
 	})
 }
 
 // PUT /positions/:id - Update a position
 func (h *PositionHandler) UpdatePosition(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
 	positionID := c.Params("id")
 
 	// Parse UUID
@@ -84,12 +95,13 @@ func (h *PositionHandler) UpdatePosition(c *fiber.Ctx) error {
 
 	// Get existing position
 	var existingPosition models.Position
-	if err := h.db.First(&existingPosition, "id = ?", id).Error; err != nil {
+	if err := db.First(&existingPosition, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"error": "Position not found",
 			})
 		}
+		logging.FromContext(c.UserContext()).Error("Failed to fetch position", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch position",
 		})
@@ -108,15 +120,19 @@ func (h *PositionHandler) UpdatePosition(c *fiber.Ctx) error {
 		})
 	}
 
+	// Only admins may require 2FA, through the admin endpoint
+	updateData.Require2FA = false
+
 	// Update position
-	if err := h.db.Model(&existingPosition).Updates(updateData).Error; err != nil {
+	if err := db.Model(&existingPosition).Updates(updateData).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to update position", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update position",
 		})
 	}
 
 	// Get updated position
-	h.db.First(&existingPosition, "id = ?", id)
+	db.First(&existingPosition, "id = ?", id)
 
 	// Store after state for audit
 	afterJSON, _ := json.Marshal(existingPosition)
@@ -126,16 +142,17 @@ func (h *PositionHandler) UpdatePosition(c *fiber.Ctx) error {
 	// Log audit
 	authUserID := c.Locals("user_id")
 	if authUserID != nil {
-		h.auditService.LogUpdate(authUserID.(string), "positions", id.String(), beforeData, afterData)
+		h.auditService.LogUpdate(c.UserContext(), authUserID.(string), "positions", id.String(), beforeData, afterData)
 	}
 
 	return c.JSON(fiber.Map{
-		"data": existingPosition,
+		"data": NewPositionView(existingPosition),
 	})
 }
 
 // DELETE /positions/:id - Delete a position
 func (h *PositionHandler) DeletePosition(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
 	positionID := c.Params("id")
 
 	// Parse UUID
@@ -148,12 +165,13 @@ func (h *PositionHandler) DeletePosition(c *fiber.Ctx) error {
 
 	// Get existing position for audit
 	var position models.Position
-	if err := h.db.First(&position, "id = ?", id).Error; err != nil {
+	if err := db.First(&position, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"error": "Position not found",
 			})
 		}
+		logging.FromContext(c.UserContext()).Error("Failed to fetch position", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch position",
 		})
@@ -165,7 +183,8 @@ func (h *PositionHandler) DeletePosition(c *fiber.Ctx) error {
 	json.Unmarshal(positionJSON, &positionData)
 
 	// Delete position
-	if err := h.db.Delete(&position, "id = ?", id).Error; err != nil {
+	if err := db.Delete(&position, "id = ?", id).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to delete position", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete position",
 		})
@@ -174,7 +193,7 @@ func (h *PositionHandler) DeletePosition(c *fiber.Ctx) error {
 	// Log audit
 	authUserID := c.Locals("user_id")
 	if authUserID != nil {
-		h.auditService.LogDelete(authUserID.(string), "positions", id.String(), positionData)
+		h.auditService.LogDelete(c.UserContext(), authUserID.(string), "positions", id.String(), positionData)
 	}
 
 	return c.JSON(fiber.Map{
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"todo-apps/config"
+	"todo-apps/logging"
+	"todo-apps/models"
+	"todo-apps/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PrivacyHandler serves data subject requests: exporting everything stored
+// about a user and erasing it.
+type PrivacyHandler struct {
+	db           *gorm.DB
+	auditService *services.AuditService
+}
+
+func NewPrivacyHandler(cfg *config.Config, auditService *services.AuditService) *PrivacyHandler {
+	return &PrivacyHandler{
+		db:           cfg.Database,
+		auditService: auditService,
+	}
+}
+
+type EraseUserRequest struct {
+	// Confirm must repeat the username of the user being erased.
+	Confirm string `json:"confirm"`
+}
+
+// ErasureReport lists what an erasure removed.
+type ErasureReport struct {
+	Pseudonym string                      `json:"pseudonym"`
+	Deleted   map[string]int64            `json:"deleted"`
+	AuditLog  services.PseudonymizeResult `json:"audit_log"`
+}
+
+// erasedTables are the tables holding rows owned by a user, deleted in this
+// order before the user row itself.
+var erasedTables = []struct {
+	name  string
+	model interface{}
+}{
+	{"tasks", &models.Task{}},
+	{"user_positions", &models.UserPosition{}},
+	{"password_histories", &models.PasswordHistory{}},
+	{"password_reset_tokens", &models.PasswordResetToken{}},
+	{"recovery_codes", &models.RecoveryCode{}},
+	{"personal_access_tokens", &models.PersonalAccessToken{}},
+	{"user_identities", &models.UserIdentity{}},
+	{"verification_tokens", &models.VerificationToken{}},
+	{"sessions", &models.Session{}},
+}
+
+// GET /me/export - Download the current user's data as a ZIP of JSON files
+func (h *PrivacyHandler) ExportMe(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Locals("user_id").(string))
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+	return h.export(c, id)
+}
+
+// GET /admin/users/:id/export - Download a user's data as a ZIP of JSON files
+func (h *PrivacyHandler) ExportUser(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+	return h.export(c, id)
+}
+
+func (h *PrivacyHandler) export(c *fiber.Ctx, id uuid.UUID) error {
+	db := h.db.WithContext(c.UserContext())
+
+	var user models.User
+	if err := db.First(&user, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
+		logging.FromContext(c.UserContext()).Error("Failed to fetch user", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch user",
+		})
+	}
+
+	var tasks []models.Task
+	var userPositions []models.UserPosition
+	var sessions []models.Session
+	err := db.Where("user_id = ?", id).Order("start_date").Find(&tasks).Error
+	if err == nil {
+		err = db.Preload("Position").Where("user_id = ?", id).Find(&userPositions).Error
+	}
+	if err == nil {
+		err = db.Where("user_id = ?", id).Order("created_at").Find(&sessions).Error
+	}
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to fetch user data", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch user data",
+		})
+	}
+
+	// An export without the audit trail would be incomplete
+	logs, err := h.auditService.ListConcerning(c.UserContext(), id.String())
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to fetch audit log", "error", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Export is temporarily unavailable",
+		})
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", NewProfileView(user)},
+		{"tasks.json", NewTaskViews(tasks, nil)},
+		{"positions.json", NewUserPositionViews(userPositions)},
+		{"sessions.json", NewSessionViews(sessions)},
+		{"audit_log.json", NewAuditLogViews(logs)},
+	}
+	for _, file := range files {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: time.Now()})
+		if err == nil {
+			encoder := json.NewEncoder(w)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(file.data)
+		}
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("Failed to build export", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to build export",
+			})
+		}
+	}
+	if err := archive.Close(); err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to build export", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to build export",
+		})
+	}
+
+	authUserID := c.Locals("user_id")
+	if authUserID != nil {
+		h.auditService.LogAction(c.UserContext(), authUserID.(string), "EXPORT", "users", id.String(), nil, nil)
+	}
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Attachment("user-" + id.String() + ".zip")
+	return c.Send(buf.Bytes())
+}
+
+// POST /admin/users/:id/erase - Erase a user and pseudonymize them in the
+// audit log
+func (h *PrivacyHandler) EraseUser(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+	var req EraseUserRequest
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	authUserID, _ := c.Locals("user_id").(string)
+	if authUserID == id.String() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You cannot erase your own account",
+		})
+	}
+
+	var user models.User
+	if err := db.First(&user, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"error": "User not found",
+			})
+		}
+		logging.FromContext(c.UserContext()).Error("Failed to fetch user", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch user",
+		})
+	}
+	if req.Confirm != user.Username {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "confirm must repeat the username of the user being erased",
+		})
+	}
+
+	// The audit log goes first: it can be retried while the user still
+	// exists, whereas a failure after deleting the user could not be
+	// retried
+	report := ErasureReport{Pseudonym: h.auditService.Pseudonym(id.String()), Deleted: map[string]int64{}}
+	result, err := h.auditService.Pseudonymize(c.UserContext(), id.String())
+	if errors.Is(err, services.ErrNoPseudonymKey) {
+		logging.FromContext(c.UserContext()).Error("Refusing to erase user without AUDIT_PSEUDONYM_KEY", "user_id", id)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Erasure is unavailable until an audit pseudonym key is configured",
+		})
+	}
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to pseudonymize audit log", "error", err)
+		return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+			"error": "Audit log is unavailable, the user was not erased",
+		})
+	}
+	report.AuditLog = *result
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range erasedTables {
+			deleted := tx.Where("user_id = ?", id).Delete(table.model)
+			if deleted.Error != nil {
+				return deleted.Error
+			}
+			report.Deleted[table.name] = deleted.RowsAffected
+		}
+		// Sessions the user opened while impersonating someone else belong
+		// to that user, so they are kept without naming the impersonator
+		err := tx.Model(&models.Session{}).Where("impersonator_id = ?", id).Update("impersonator_id", nil).Error
+		if err != nil {
+			return err
+		}
+		deleted := tx.Delete(&models.User{}, "id = ?", id)
+		report.Deleted["users"] = deleted.RowsAffected
+		return deleted.Error
+	})
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to erase user", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to erase user",
+		})
+	}
+
+	// Record the erasure under the pseudonym only
+	h.auditService.LogAction(c.UserContext(), authUserID, "ERASE", "users", report.Pseudonym, nil, nil)
+
+	return c.JSON(fiber.Map{
+		"data": report,
+	})
+}
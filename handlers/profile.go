@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"todo-apps/models"
+	"todo-apps/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// normalizeProfileField validates one profile setting from a request body
+// and returns the value to store.
+func normalizeProfileField(field string, raw json.RawMessage) (interface{}, *utils.PolicyViolation) {
+	if field == "preferences" {
+		var preferences models.JSONB
+		if err := json.Unmarshal(raw, &preferences); err != nil || preferences == nil {
+			return nil, &utils.PolicyViolation{Field: field, Code: "invalid", Message: "Preferences must be a JSON object"}
+		}
+		return preferences, nil
+	}
+
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, &utils.PolicyViolation{Field: field, Code: "invalid", Message: field + " must be a string"}
+	}
+	value = strings.TrimSpace(value)
+
+	switch field {
+	case "name":
+		if value == "" {
+			return nil, &utils.PolicyViolation{Field: field, Code: "required", Message: "Name must not be empty"}
+		}
+	case "email":
+		if value == "" {
+			return nil, nil
+		}
+		email, err := utils.NormalizeEmail(value)
+		if err != nil {
+			return nil, &utils.PolicyViolation{Field: field, Code: "invalid", Message: "Email address is invalid"}
+		}
+		return email, nil
+	case "timezone":
+		if _, err := utils.ParseTimezone(value); err != nil {
+			return nil, &utils.PolicyViolation{Field: field, Code: "invalid", Message: "Timezone must be an IANA name such as Europe/Berlin"}
+		}
+	case "locale":
+		locale, err := utils.NormalizeLocale(value)
+		if err != nil {
+			return nil, &utils.PolicyViolation{Field: field, Code: "invalid", Message: "Locale must be a BCP 47 tag such as en-US"}
+		}
+		return locale, nil
+	case "avatar_url":
+		if err := utils.ValidateAvatarURL(value); err != nil {
+			return nil, &utils.PolicyViolation{Field: field, Code: "invalid", Message: err.Error()}
+		}
+	}
+	return value, nil
+}
+
+// applyProfile validates the optional profile settings in req and copies
+// them onto user. Empty fields are left unchanged.
+func applyProfile(user *models.User, req UserRequest) []utils.PolicyViolation {
+	var violations []utils.PolicyViolation
+	fields := []struct{ field, value string }{
+		{"email", req.Email},
+		{"timezone", req.Timezone},
+		{"locale", req.Locale},
+		{"avatar_url", req.AvatarURL},
+	}
+	for _, f := range fields {
+		field, value := f.field, f.value
+		if value == "" {
+			continue
+		}
+		raw, _ := json.Marshal(value)
+		normalized, violation := normalizeProfileField(field, raw)
+		if violation != nil {
+			violations = append(violations, *violation)
+			continue
+		}
+
+		switch field {
+		case "email":
+			email := normalized.(string)
+			user.Email = &email
+		case "timezone":
+			user.Timezone = normalized.(string)
+		case "locale":
+			user.Locale = normalized.(string)
+		case "avatar_url":
+			user.AvatarURL = normalized.(string)
+		}
+	}
+	return violations
+}
+
+// emailTaken reports whether another user already uses email.
+func emailTaken(db *gorm.DB, email string, userID uuid.UUID) (bool, error) {
+	var count int64
+	err := db.Model(&models.User{}).Where("email = ? AND id <> ?", email, userID).Count(&count).Error
+	return count > 0, err
+}
+
+// usernameTaken reports whether another user already uses username.
+func usernameTaken(db *gorm.DB, username string, userID uuid.UUID) (bool, error) {
+	var count int64
+	err := db.Model(&models.User{}).Where("username = ? AND id <> ?", username, userID).Count(&count).Error
+	return count > 0, err
+}
+
+// profileViolations applies the profile settings in req to user and checks
+// that a new email address isn't already used by anyone but userID. Pass
+// uuid.Nil for a user that doesn't exist yet.
+func profileViolations(db *gorm.DB, userID uuid.UUID, user *models.User, req UserRequest) ([]utils.PolicyViolation, error) {
+	if violations := applyProfile(user, req); len(violations) > 0 {
+		return violations, nil
+	}
+	if user.Email == nil {
+		return nil, nil
+	}
+	taken, err := emailTaken(db, *user.Email, userID)
+	if err != nil || !taken {
+		return nil, err
+	}
+	return []utils.PolicyViolation{{Field: "email", Code: "taken", Message: "Email address is already in use"}}, nil
+}
+
+// sameEmail reports whether current matches an email value produced by
+// normalizeProfileField, where nil clears the address.
+func sameEmail(current *string, value interface{}) bool {
+	email, ok := value.(string)
+	if !ok || current == nil {
+		return !ok && current == nil
+	}
+	return *current == email
+}
+
+// requestedLocation resolves the ?tz= query parameter used to render dates.
+// "me" selects the requesting user's profile timezone and any other value
+// must be an IANA name. It returns nil when no conversion was requested.
+func requestedLocation(c *fiber.Ctx, db *gorm.DB) (*time.Location, error) {
+	name := c.Query("tz")
+	if name == "" {
+		return nil, nil
+	}
+	if name == "me" {
+		var user models.User
+		if err := db.Select("timezone").First(&user, "id = ?", c.Locals("user_id")).Error; err != nil {
+			return nil, err
+		}
+		name = user.Timezone
+	}
+	return utils.ParseTimezone(name)
+}
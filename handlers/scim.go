@@ -0,0 +1,1204 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+
+	"todo-apps/config"
+	"todo-apps/logging"
+	"todo-apps/models"
+	"todo-apps/scim"
+	"todo-apps/services"
+	"todo-apps/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SCIMHandler serves SCIM 2.0 provisioning. Users map to models.User,
+// Groups to models.Position and group membership to models.UserPosition.
+// Deactivating a user through "active": false suspends the account.
+type SCIMHandler struct {
+	db              *gorm.DB
+	readDB          *gorm.DB
+	baseURL         string
+	passwordService *services.PasswordService
+	auditService    *services.AuditService
+	// deactivationService handles DELETE, since users are never deleted;
+	// deactivated users are hidden from SCIM as if they had been.
+	deactivationService *services.DeactivationService
+}
+
+func NewSCIMHandler(cfg *config.Config, passwordService *services.PasswordService, auditService *services.AuditService, deactivationService *services.DeactivationService) *SCIMHandler {
+	return &SCIMHandler{
+		db:                  cfg.Database,
+		readDB:              cfg.ReadDatabase,
+		baseURL:             strings.TrimSuffix(cfg.PublicURL, "/") + "/scim/v2",
+		passwordService:     passwordService,
+		auditService:        auditService,
+		deactivationService: deactivationService,
+	}
+}
+
+type SCIMUser struct {
+	Schemas     []string        `json:"schemas"`
+	ID          string          `json:"id"`
+	UserName    string          `json:"userName"`
+	Name        SCIMName        `json:"name"`
+	DisplayName string          `json:"displayName"`
+	Emails      []SCIMEmail     `json:"emails,omitempty"`
+	Active      bool            `json:"active"`
+	Locale      string          `json:"locale,omitempty"`
+	Timezone    string          `json:"timezone,omitempty"`
+	Groups      []SCIMReference `json:"groups"`
+	Meta        scim.Meta       `json:"meta"`
+}
+
+type SCIMName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type SCIMEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type SCIMReference struct {
+	Value   string `json:"value"`
+	Ref     string `json:"$ref,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+type SCIMGroup struct {
+	Schemas     []string        `json:"schemas"`
+	ID          string          `json:"id"`
+	DisplayName string          `json:"displayName"`
+	Members     []SCIMReference `json:"members,omitempty"`
+	Meta        scim.Meta       `json:"meta"`
+}
+
+// SCIMUserRequest is the body of POST and PUT /Users. Attributes the service
+// doesn't store, such as externalId, are ignored.
+type SCIMUserRequest struct {
+	UserName    string          `json:"userName"`
+	Name        SCIMName        `json:"name"`
+	DisplayName string          `json:"displayName"`
+	Emails      []SCIMEmail     `json:"emails"`
+	Active      json.RawMessage `json:"active"`
+	Locale      string          `json:"locale"`
+	Timezone    string          `json:"timezone"`
+	Password    string          `json:"password"`
+}
+
+// SCIMGroupRequest is the body of POST and PUT /Groups.
+type SCIMGroupRequest struct {
+	DisplayName string          `json:"displayName"`
+	Members     []SCIMReference `json:"members"`
+}
+
+var scimUserColumns = map[string]scim.Column{
+	"id":                {Expr: "users.id", Kind: scim.UUID},
+	"username":          {Expr: "users.username", Kind: scim.String},
+	"displayname":       {Expr: "users.name", Kind: scim.String},
+	"name.formatted":    {Expr: "users.name", Kind: scim.String},
+	"emails":            {Expr: "users.email", Kind: scim.String},
+	"emails.value":      {Expr: "users.email", Kind: scim.String},
+	"active":            {Expr: "(users.status = 'active')", Kind: scim.Boolean},
+	"locale":            {Expr: "users.locale", Kind: scim.String},
+	"timezone":          {Expr: "users.timezone", Kind: scim.String},
+	"meta.created":      {Expr: "users.created_at", Kind: scim.DateTime},
+	"meta.lastmodified": {Expr: "users.updated_at", Kind: scim.DateTime},
+	"groups":            {Expr: "EXISTS (SELECT 1 FROM user_positions WHERE user_positions.user_id = users.id AND user_positions.position_id = ?)", Kind: scim.Reference},
+	"groups.value":      {Expr: "EXISTS (SELECT 1 FROM user_positions WHERE user_positions.user_id = users.id AND user_positions.position_id = ?)", Kind: scim.Reference},
+}
+
+var scimGroupColumns = map[string]scim.Column{
+	"id":            {Expr: "positions.id", Kind: scim.UUID},
+	"displayname":   {Expr: "positions.name", Kind: scim.String},
+	"members":       {Expr: "EXISTS (SELECT 1 FROM user_positions WHERE user_positions.position_id = positions.id AND user_positions.user_id = ?)", Kind: scim.Reference},
+	"members.value": {Expr: "EXISTS (SELECT 1 FROM user_positions WHERE user_positions.position_id = positions.id AND user_positions.user_id = ?)", Kind: scim.Reference},
+}
+
+// GET /scim/v2/ServiceProviderConfig - Describe the supported SCIM features
+func (h *SCIMHandler) GetServiceProviderConfig(c *fiber.Ctx) error {
+	return c.JSON(scim.ServiceProviderConfig(h.baseURL), scim.ContentType)
+}
+
+// GET /scim/v2/ResourceTypes - List the User and Group resource types
+func (h *SCIMHandler) GetResourceTypes(c *fiber.Ctx) error {
+	types := scim.ResourceTypes(h.baseURL)
+	return c.JSON(scim.NewListResponse(types, len(types), int64(len(types)), 1), scim.ContentType)
+}
+
+// GET /scim/v2/Users - List users, with ?filter=, ?startIndex= and ?count=
+func (h *SCIMHandler) GetUsers(c *fiber.Ctx) error {
+	db := h.readDB.WithContext(c.UserContext())
+
+	// Deactivated users count as deleted
+	visible := db.Model(&models.User{}).Where("users.status <> ?", models.UserStatusDeactivated)
+	query, startIndex, count, scimErr := scimListQuery(c, visible, scimUserColumns)
+	if scimErr != nil {
+		return scimError(c, scimErr)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return scimFailure(c, "Failed to fetch users", err)
+	}
+	var users []models.User
+	if count > 0 {
+		err := query.Order("users.created_at, users.id").Offset(startIndex - 1).Limit(count).Find(&users).Error
+		if err != nil {
+			return scimFailure(c, "Failed to fetch users", err)
+		}
+	}
+
+	resources, err := h.userResources(db, users)
+	if err != nil {
+		return scimFailure(c, "Failed to fetch users", err)
+	}
+	return c.JSON(scim.NewListResponse(resources, len(resources), total, startIndex), scim.ContentType)
+}
+
+// GET /scim/v2/Users/:id - Get a user
+func (h *SCIMHandler) GetUser(c *fiber.Ctx) error {
+	db := h.readDB.WithContext(c.UserContext())
+
+	user, scimErr := h.findUser(c, db)
+	if scimErr != nil {
+		return scimError(c, scimErr)
+	}
+	return h.respondUser(c, db, fiber.StatusOK, user)
+}
+
+// POST /scim/v2/Users - Provision a user
+func (h *SCIMHandler) CreateUser(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+
+	var req SCIMUserRequest
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return scimError(c, scim.Errorf(fiber.StatusBadRequest, "invalidSyntax", "Request body is not a valid User"))
+	}
+
+	state := scimUserState{Active: true, Timezone: "UTC", Locale: "en"}
+	if scimErr := state.replace(req); scimErr != nil {
+		return scimError(c, scimErr)
+	}
+
+	user := models.User{}
+	if scimErr := h.saveUser(c, db, &user, state); scimErr != nil {
+		return scimError(c, scimErr)
+	}
+
+	// Log audit
+	userJSON, _ := json.Marshal(NewUserView(user))
+	var userData map[string]interface{}
+	json.Unmarshal(userJSON, &userData)
+	h.auditService.LogCreate(c.UserContext(), c.Locals("user_id").(string), "users", user.ID.String(), userData)
+
+	c.Location(h.baseURL + "/Users/" + user.ID.String())
+	return h.respondUser(c, db, fiber.StatusCreated, user)
+}
+
+// PUT /scim/v2/Users/:id - Replace a user's attributes
+func (h *SCIMHandler) ReplaceUser(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+
+	user, scimErr := h.findUser(c, db)
+	if scimErr != nil {
+		return scimError(c, scimErr)
+	}
+
+	var req SCIMUserRequest
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return scimError(c, scim.Errorf(fiber.StatusBadRequest, "invalidSyntax", "Request body is not a valid User"))
+	}
+
+	state := newSCIMUserState(user)
+	if scimErr := state.replace(req); scimErr != nil {
+		return scimError(c, scimErr)
+	}
+	return h.updateUser(c, db, user, state)
+}
+
+// PATCH /scim/v2/Users/:id - Modify a user with PatchOp operations
+func (h *SCIMHandler) PatchUser(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+
+	user, scimErr := h.findUser(c, db)
+	if scimErr != nil {
+		return scimError(c, scimErr)
+	}
+
+	patch, err := scim.ParsePatch(c.Body())
+	if err != nil {
+		return scimError(c, err.(*scim.Error))
+	}
+
+	state := newSCIMUserState(user)
+	for _, op := range patch.Operations {
+		if scimErr := state.patch(op); scimErr != nil {
+			return scimError(c, scimErr)
+		}
+	}
+	return h.updateUser(c, db, user, state)
+}
+
+// DELETE /scim/v2/Users/:id - Deprovision a user
+func (h *SCIMHandler) DeleteUser(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+
+	user, scimErr := h.findUser(c, db)
+	if scimErr != nil {
+		return scimError(c, scimErr)
+	}
+
+	// The user keeps their tasks and audit history; the deactivation
+	// service audits each change
+	_, err := h.deactivationService.Deactivate(c.UserContext(), c.Locals("user_id").(string), user.ID, services.DeactivationOptions{
+		EndPositions: true,
+		RevokeTokens: true,
+	})
+	switch err {
+	case nil:
+	case services.ErrUserNotFound, services.ErrUserDeactivated:
+		// Deleted concurrently
+		return scimError(c, scim.Errorf(fiber.StatusNotFound, "", "User %s not found", user.ID))
+	default:
+		return scimFailure(c, "Failed to delete user", err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// GET /scim/v2/Groups - List groups, with ?filter=, ?startIndex=, ?count=
+// and ?excludedAttributes=members
+func (h *SCIMHandler) GetGroups(c *fiber.Ctx) error {
+	db := h.readDB.WithContext(c.UserContext())
+
+	query, startIndex, count, scimErr := scimListQuery(c, db.Model(&models.Position{}), scimGroupColumns)
+	if scimErr != nil {
+		return scimError(c, scimErr)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return scimFailure(c, "Failed to fetch groups", err)
+	}
+	var positions []models.Position
+	if count > 0 {
+		err := query.Order("positions.name").Offset(startIndex - 1).Limit(count).Find(&positions).Error
+		if err != nil {
+			return scimFailure(c, "Failed to fetch groups", err)
+		}
+	}
+
+	resources, err := h.groupResources(db, positions, excludesMembers(c))
+	if err != nil {
+		return scimFailure(c, "Failed to fetch groups", err)
+	}
+	return c.JSON(scim.NewListResponse(resources, len(resources), total, startIndex), scim.ContentType)
+}
+
+// GET /scim/v2/Groups/:id - Get a group
+func (h *SCIMHandler) GetGroup(c *fiber.Ctx) error {
+	db := h.readDB.WithContext(c.UserContext())
+
+	position, scimErr := h.findGroup(c, db)
+	if scimErr != nil {
+		return scimError(c, scimErr)
+	}
+	return h.respondGroup(c, db, fiber.StatusOK, position, excludesMembers(c))
+}
+
+// POST /scim/v2/Groups - Create a group
+func (h *SCIMHandler) CreateGroup(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+
+	var req SCIMGroupRequest
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return scimError(c, scim.Errorf(fiber.StatusBadRequest, "invalidSyntax", "Request body is not a valid Group"))
+	}
+
+	state := scimGroupState{}
+	if scimErr := state.replace(req); scimErr != nil {
+		return scimError(c, scimErr)
+	}
+
+	position := models.Position{}
+	if scimErr := h.saveGroup(c, db, &position, nil, state); scimErr != nil {
+		return scimError(c, scimErr)
+	}
+
+	// Log audit
+	h.auditService.LogCreate(c.UserContext(), c.Locals("user_id").(string), "positions", position.ID.String(), state.auditData())
+
+	c.Location(h.baseURL + "/Groups/" + position.ID.String())
+	return h.respondGroup(c, db, fiber.StatusCreated, position, false)
+}
+
+// PUT /scim/v2/Groups/:id - Replace a group's name and members
+func (h *SCIMHandler) ReplaceGroup(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+
+	position, scimErr := h.findGroup(c, db)
+	if scimErr != nil {
+		return scimError(c, scimErr)
+	}
+
+	var req SCIMGroupRequest
+	if err := json.Unmarshal(c.Body(), &req); err != nil {
+		return scimError(c, scim.Errorf(fiber.StatusBadRequest, "invalidSyntax", "Request body is not a valid Group"))
+	}
+
+	state, err := h.groupState(db, position)
+	if err != nil {
+		return scimFailure(c, "Failed to fetch group", err)
+	}
+	before := state.clone()
+	if scimErr := state.replace(req); scimErr != nil {
+		return scimError(c, scimErr)
+	}
+	return h.updateGroup(c, db, position, before, state)
+}
+
+// PATCH /scim/v2/Groups/:id - Rename a group or change its members
+func (h *SCIMHandler) PatchGroup(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+
+	position, scimErr := h.findGroup(c, db)
+	if scimErr != nil {
+		return scimError(c, scimErr)
+	}
+
+	patch, err := scim.ParsePatch(c.Body())
+	if err != nil {
+		return scimError(c, err.(*scim.Error))
+	}
+
+	state, err := h.groupState(db, position)
+	if err != nil {
+		return scimFailure(c, "Failed to fetch group", err)
+	}
+	before := state.clone()
+	for _, op := range patch.Operations {
+		if scimErr := state.patch(op); scimErr != nil {
+			return scimError(c, scimErr)
+		}
+	}
+	return h.updateGroup(c, db, position, before, state)
+}
+
+// DELETE /scim/v2/Groups/:id - Delete a group and its memberships
+func (h *SCIMHandler) DeleteGroup(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+
+	position, scimErr := h.findGroup(c, db)
+	if scimErr != nil {
+		return scimError(c, scimErr)
+	}
+
+	state, err := h.groupState(db, position)
+	if err != nil {
+		return scimFailure(c, "Failed to fetch group", err)
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("position_id = ?", position.ID).Delete(&models.UserPosition{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&position).Error
+	})
+	if err != nil {
+		return scimFailure(c, "Failed to delete group", err)
+	}
+
+	// Log audit
+	h.auditService.LogDelete(c.UserContext(), c.Locals("user_id").(string), "positions", position.ID.String(), state.auditData())
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// scimUserState holds the attributes of a user that SCIM can change.
+type scimUserState struct {
+	UserName string
+	Name     string
+	Email    string
+	Active   bool
+	Locale   string
+	Timezone string
+	// Password is a new plaintext password, or empty to keep the current one.
+	Password string
+
+	// givenName and familyName track the parts of Name changed by PATCH.
+	// Only the full name is stored, so it is split at its last space the
+	// first time a part changes; later parts in the same request then
+	// combine exactly.
+	givenName, familyName string
+	nameSplit             bool
+}
+
+func newSCIMUserState(user models.User) scimUserState {
+	state := scimUserState{
+		UserName: user.Username,
+		Name:     user.Name,
+		Active:   user.Status == models.UserStatusActive,
+		Locale:   user.Locale,
+		Timezone: user.Timezone,
+	}
+	if user.Email != nil {
+		state.Email = *user.Email
+	}
+	return state
+}
+
+// replace applies a full User representation. Omitted optional attributes
+// keep their current values.
+func (s *scimUserState) replace(req SCIMUserRequest) *scim.Error {
+	if req.UserName == "" {
+		return scim.Errorf(fiber.StatusBadRequest, "invalidValue", "userName is required")
+	}
+	s.UserName = req.UserName
+	s.Name = scimDisplayName(req.DisplayName, req.Name, req.UserName)
+	if req.Emails != nil {
+		s.Email = primaryEmail(req.Emails)
+	}
+	if req.Active != nil {
+		active, err := scim.Bool(req.Active)
+		if err != nil {
+			return err.(*scim.Error)
+		}
+		s.Active = active
+	}
+	if req.Locale != "" {
+		s.Locale = req.Locale
+	}
+	if req.Timezone != "" {
+		s.Timezone = req.Timezone
+	}
+	s.Password = req.Password
+	return nil
+}
+
+// patch applies one PatchOp operation. Operations without a path carry an
+// object of attributes to add or replace.
+func (s *scimUserState) patch(op scim.PatchOperation) *scim.Error {
+	if op.Path == "" {
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &attrs); err != nil {
+			return scim.Errorf(fiber.StatusBadRequest, "invalidValue", "Operations without a path need an object value")
+		}
+		for attr, value := range attrs {
+			path, err := scim.ParsePath(attr)
+			if err != nil {
+				return err.(*scim.Error)
+			}
+			if scimErr := s.apply(op.Op, path, value); scimErr != nil {
+				return scimErr
+			}
+		}
+		return nil
+	}
+
+	path, err := scim.ParsePath(op.Path)
+	if err != nil {
+		return err.(*scim.Error)
+	}
+	return s.apply(op.Op, path, op.Value)
+}
+
+func (s *scimUserState) apply(op string, path scim.Path, value json.RawMessage) *scim.Error {
+	if op == "remove" {
+		switch path.Attr {
+		case "emails":
+			if path.Filter == nil || scim.Match(path.Filter, map[string]string{"value": s.Email}) {
+				s.Email = ""
+			}
+		case "locale":
+			s.Locale = "en"
+		case "timezone":
+			s.Timezone = "UTC"
+		case "username", "displayname", "name", "active", "password":
+			return scim.Errorf(fiber.StatusBadRequest, "mutability", "%s cannot be removed", path.Attr)
+		}
+		return nil
+	}
+
+	switch path.Attr {
+	case "username":
+		return scimString(value, &s.UserName)
+	case "displayname":
+		s.nameSplit = false
+		return scimString(value, &s.Name)
+	case "name":
+		var part string
+		switch path.Sub {
+		case "formatted":
+			s.nameSplit = false
+			return scimString(value, &s.Name)
+		case "givenname", "familyname":
+			if err := scimString(value, &part); err != nil {
+				return err
+			}
+			if path.Sub == "givenname" {
+				s.setNameParts(&part, nil)
+			} else {
+				s.setNameParts(nil, &part)
+			}
+		case "":
+			var name SCIMName
+			if err := json.Unmarshal(value, &name); err != nil {
+				return scim.Errorf(fiber.StatusBadRequest, "invalidValue", "name must be an object")
+			}
+			if name.Formatted != "" {
+				s.Name, s.nameSplit = name.Formatted, false
+				break
+			}
+			var given, family *string
+			if name.GivenName != "" {
+				given = &name.GivenName
+			}
+			if name.FamilyName != "" {
+				family = &name.FamilyName
+			}
+			s.setNameParts(given, family)
+		default:
+			return scim.Errorf(fiber.StatusBadRequest, "invalidPath", "name.%s is not supported", path.Sub)
+		}
+	case "active":
+		active, err := scim.Bool(value)
+		if err != nil {
+			return err.(*scim.Error)
+		}
+		s.Active = active
+	case "emails":
+		if path.Sub == "value" {
+			return scimString(value, &s.Email)
+		}
+		var emails []SCIMEmail
+		if err := json.Unmarshal(value, &emails); err != nil {
+			var email SCIMEmail
+			if err := json.Unmarshal(value, &email); err != nil {
+				return scim.Errorf(fiber.StatusBadRequest, "invalidValue", "emails must be a list of email objects")
+			}
+			emails = []SCIMEmail{email}
+		}
+		if len(emails) > 0 {
+			s.Email = primaryEmail(emails)
+		}
+	case "locale":
+		return scimString(value, &s.Locale)
+	case "timezone":
+		return scimString(value, &s.Timezone)
+	case "password":
+		return scimString(value, &s.Password)
+	}
+	// Other attributes, such as externalId or enterprise extensions, aren't stored
+	return nil
+}
+
+// setNameParts replaces the given and family parts of the name that are
+// not nil, keeping the other part.
+func (s *scimUserState) setNameParts(given, family *string) {
+	if !s.nameSplit {
+		s.givenName, s.familyName = s.Name, ""
+		if i := strings.LastIndex(s.Name, " "); i >= 0 {
+			s.givenName, s.familyName = s.Name[:i], s.Name[i+1:]
+		}
+		s.nameSplit = true
+	}
+	if given != nil {
+		s.givenName = strings.TrimSpace(*given)
+	}
+	if family != nil {
+		s.familyName = strings.TrimSpace(*family)
+	}
+	s.Name = strings.TrimSpace(s.givenName + " " + s.familyName)
+}
+
+// scimGroupState holds a group's name and member user IDs.
+type scimGroupState struct {
+	Name    string
+	Members []uuid.UUID
+}
+
+func (s scimGroupState) clone() scimGroupState {
+	s.Members = append([]uuid.UUID(nil), s.Members...)
+	return s
+}
+
+func (s scimGroupState) auditData() map[string]interface{} {
+	members := make([]string, len(s.Members))
+	for i, id := range s.Members {
+		members[i] = id.String()
+	}
+	return map[string]interface{}{"name": s.Name, "members": members}
+}
+
+func (s *scimGroupState) replace(req SCIMGroupRequest) *scim.Error {
+	if req.DisplayName == "" {
+		return scim.Errorf(fiber.StatusBadRequest, "invalidValue", "displayName is required")
+	}
+	s.Name = req.DisplayName
+	if req.Members != nil {
+		s.Members = nil
+		return s.addMembers(req.Members)
+	}
+	return nil
+}
+
+func (s *scimGroupState) patch(op scim.PatchOperation) *scim.Error {
+	if op.Path == "" {
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &attrs); err != nil {
+			return scim.Errorf(fiber.StatusBadRequest, "invalidValue", "Operations without a path need an object value")
+		}
+		for attr, value := range attrs {
+			path, err := scim.ParsePath(attr)
+			if err != nil {
+				return err.(*scim.Error)
+			}
+			if scimErr := s.apply(op.Op, path, value); scimErr != nil {
+				return scimErr
+			}
+		}
+		return nil
+	}
+
+	path, err := scim.ParsePath(op.Path)
+	if err != nil {
+		return err.(*scim.Error)
+	}
+	return s.apply(op.Op, path, op.Value)
+}
+
+func (s *scimGroupState) apply(op string, path scim.Path, value json.RawMessage) *scim.Error {
+	switch path.Attr {
+	case "displayname":
+		if op == "remove" {
+			return scim.Errorf(fiber.StatusBadRequest, "mutability", "displayName cannot be removed")
+		}
+		return scimString(value, &s.Name)
+	case "members":
+		switch op {
+		case "remove":
+			return s.removeMembers(path.Filter, value)
+		case "replace":
+			s.Members = nil
+		}
+		var members []SCIMReference
+		if err := json.Unmarshal(value, &members); err != nil {
+			var member SCIMReference
+			if err := json.Unmarshal(value, &member); err != nil {
+				return scim.Errorf(fiber.StatusBadRequest, "invalidValue", "members must be a list of member objects")
+			}
+			members = []SCIMReference{member}
+		}
+		return s.addMembers(members)
+	}
+	// Other attributes, such as id or externalId, aren't stored
+	return nil
+}
+
+func (s *scimGroupState) addMembers(members []SCIMReference) *scim.Error {
+	for _, member := range members {
+		id, err := uuid.Parse(member.Value)
+		if err != nil {
+			return scim.Errorf(fiber.StatusBadRequest, "invalidValue", "Member %q is not a valid user ID", member.Value)
+		}
+		if !containsUUID(s.Members, id) {
+			s.Members = append(s.Members, id)
+		}
+	}
+	return nil
+}
+
+// removeMembers removes the members matching filter, or those listed in
+// value, or everyone when neither is given.
+func (s *scimGroupState) removeMembers(filter scim.Filter, value json.RawMessage) *scim.Error {
+	var listed []SCIMReference
+	if filter == nil && len(value) > 0 {
+		if err := json.Unmarshal(value, &listed); err != nil {
+			return scim.Errorf(fiber.StatusBadRequest, "invalidValue", "members must be a list of member objects")
+		}
+	}
+
+	kept := s.Members[:0]
+	for _, id := range s.Members {
+		remove := false
+		switch {
+		case filter != nil:
+			remove = scim.Match(filter, map[string]string{"value": id.String()})
+		case listed != nil:
+			for _, member := range listed {
+				remove = remove || strings.EqualFold(member.Value, id.String())
+			}
+		default:
+			remove = true
+		}
+		if !remove {
+			kept = append(kept, id)
+		}
+	}
+	s.Members = kept
+	return nil
+}
+
+// saveUser validates state and stores it in user, creating the user when its
+// ID is unset.
+func (h *SCIMHandler) saveUser(c *fiber.Ctx, db *gorm.DB, user *models.User, state scimUserState) *scim.Error {
+	updates := map[string]interface{}{
+		"username": strings.TrimSpace(state.UserName),
+		"name":     strings.TrimSpace(state.Name),
+		"email":    nil,
+	}
+	if updates["username"] == "" {
+		return scim.Errorf(fiber.StatusBadRequest, "invalidValue", "userName must not be empty")
+	}
+	for _, field := range []struct{ name, value string }{{"name", state.Name}, {"email", state.Email}, {"timezone", state.Timezone}, {"locale", state.Locale}} {
+		raw, _ := json.Marshal(field.value)
+		value, violation := normalizeProfileField(field.name, raw)
+		if violation != nil {
+			return scim.Errorf(fiber.StatusBadRequest, "invalidValue", "%s", violation.Message)
+		}
+		updates[field.name] = value
+	}
+
+	// Uniqueness
+	taken, err := usernameTaken(db, updates["username"].(string), user.ID)
+	if err != nil {
+		return h.internalError(c, "Failed to validate user", err)
+	}
+	if taken {
+		return scim.Errorf(fiber.StatusConflict, "uniqueness", "userName is already in use")
+	}
+	if email, ok := updates["email"].(string); ok {
+		taken, err := emailTaken(db, email, user.ID)
+		if err != nil {
+			return h.internalError(c, "Failed to validate user", err)
+		}
+		if taken {
+			return scim.Errorf(fiber.StatusConflict, "uniqueness", "Email address is already in use")
+		}
+	}
+
+	var hashedPassword string
+	if state.Password != "" {
+		violations, err := h.passwordService.Validate(c.UserContext(), user.ID, state.Password)
+		if err != nil {
+			return h.internalError(c, "Failed to validate password", err)
+		}
+		if len(violations) > 0 {
+			messages := make([]string, len(violations))
+			for i, violation := range violations {
+				messages[i] = violation.Message
+			}
+			return scim.Errorf(fiber.StatusBadRequest, "invalidValue", "Password does not meet policy: %s", strings.Join(messages, "; "))
+		}
+		hashedPassword, err = utils.HashPassword(state.Password)
+		if err != nil {
+			return h.internalError(c, "Failed to hash password", err)
+		}
+	}
+
+	// Deactivation suspends the account and revokes its sessions. Pending
+	// users stay pending unless they are explicitly activated.
+	wasActive := user.ID != uuid.Nil && user.Status == models.UserStatusActive
+	if state.Active && (user.ID == uuid.Nil || !wasActive) {
+		updates["status"] = models.UserStatusActive
+		updates["deactivated_at"] = nil
+	} else if !state.Active && (user.ID == uuid.Nil || wasActive) {
+		updates["status"] = models.UserStatusSuspended
+		updates["token_version"] = gorm.Expr("token_version + 1")
+	}
+	if !sameEmail(user.Email, updates["email"]) {
+		updates["email_verified_at"] = nil
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if user.ID == uuid.Nil {
+			user.Username = updates["username"].(string)
+			user.Name = updates["name"].(string)
+			if email, ok := updates["email"].(string); ok {
+				user.Email = &email
+			}
+			user.Timezone = updates["timezone"].(string)
+			user.Locale = updates["locale"].(string)
+			user.Status = updates["status"].(string)
+			user.Password = hashedPassword
+			if err := tx.Create(user).Error; err != nil {
+				return err
+			}
+			if hashedPassword == "" {
+				return nil
+			}
+			return h.passwordService.Record(tx, user.ID, hashedPassword)
+		}
+
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+		if hashedPassword != "" {
+			if err := h.passwordService.Change(tx, user.ID, hashedPassword); err != nil {
+				return err
+			}
+		}
+		return tx.First(user, "id = ?", user.ID).Error
+	})
+	if err != nil {
+		return h.internalError(c, "Failed to save user", err)
+	}
+	return nil
+}
+
+func (h *SCIMHandler) updateUser(c *fiber.Ctx, db *gorm.DB, user models.User, state scimUserState) error {
+	// Store before state for audit
+	beforeJSON, _ := json.Marshal(NewUserView(user))
+	var beforeData map[string]interface{}
+	json.Unmarshal(beforeJSON, &beforeData)
+
+	if scimErr := h.saveUser(c, db, &user, state); scimErr != nil {
+		return scimError(c, scimErr)
+	}
+
+	// Log audit
+	afterJSON, _ := json.Marshal(NewUserView(user))
+	var afterData map[string]interface{}
+	json.Unmarshal(afterJSON, &afterData)
+	h.auditService.LogUpdate(c.UserContext(), c.Locals("user_id").(string), "users", user.ID.String(), beforeData, afterData)
+
+	return h.respondUser(c, db, fiber.StatusOK, user)
+}
+
+// saveGroup stores state in position, creating it when its ID is unset, and
+// adds or removes memberships relative to before.
+func (h *SCIMHandler) saveGroup(c *fiber.Ctx, db *gorm.DB, position *models.Position, before []uuid.UUID, state scimGroupState) *scim.Error {
+	name := strings.TrimSpace(state.Name)
+	if name == "" {
+		return scim.Errorf(fiber.StatusBadRequest, "invalidValue", "displayName must not be empty")
+	}
+
+	var count int64
+	if err := db.Model(&models.Position{}).Where("name = ? AND id <> ?", name, position.ID).Count(&count).Error; err != nil {
+		return h.internalError(c, "Failed to validate group", err)
+	}
+	if count > 0 {
+		return scim.Errorf(fiber.StatusConflict, "uniqueness", "A group named %q already exists", name)
+	}
+
+	var added, removed []uuid.UUID
+	for _, id := range state.Members {
+		if !containsUUID(before, id) {
+			added = append(added, id)
+		}
+	}
+	for _, id := range before {
+		if !containsUUID(state.Members, id) {
+			removed = append(removed, id)
+		}
+	}
+	if len(added) > 0 {
+		var found int64
+		err := db.Model(&models.User{}).Where("id IN ? AND status <> ?", added, models.UserStatusDeactivated).Count(&found).Error
+		if err != nil {
+			return h.internalError(c, "Failed to validate group", err)
+		}
+		if found != int64(len(added)) {
+			return scim.Errorf(fiber.StatusBadRequest, "invalidValue", "Every member must be an existing user")
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		position.Name = name
+		if position.ID == uuid.Nil {
+			if err := tx.Create(position).Error; err != nil {
+				return err
+			}
+		} else if err := tx.Model(position).Update("name", name).Error; err != nil {
+			return err
+		}
+
+		if len(removed) > 0 {
+			err := tx.Where("position_id = ? AND user_id IN ?", position.ID, removed).Delete(&models.UserPosition{}).Error
+			if err != nil {
+				return err
+			}
+		}
+		for _, id := range added {
+			if err := tx.Create(&models.UserPosition{UserID: id, PositionID: position.ID}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return h.internalError(c, "Failed to save group", err)
+	}
+	return nil
+}
+
+func (h *SCIMHandler) updateGroup(c *fiber.Ctx, db *gorm.DB, position models.Position, before, state scimGroupState) error {
+	if scimErr := h.saveGroup(c, db, &position, before.Members, state); scimErr != nil {
+		return scimError(c, scimErr)
+	}
+
+	// Log audit
+	h.auditService.LogUpdate(c.UserContext(), c.Locals("user_id").(string), "positions", position.ID.String(), before.auditData(), state.auditData())
+
+	return h.respondGroup(c, db, fiber.StatusOK, position, false)
+}
+
+func (h *SCIMHandler) groupState(db *gorm.DB, position models.Position) (scimGroupState, error) {
+	state := scimGroupState{Name: position.Name}
+	err := db.Model(&models.UserPosition{}).
+		Joins("JOIN users ON users.id = user_positions.user_id").
+		Where("user_positions.position_id = ? AND users.status <> ?", position.ID, models.UserStatusDeactivated).
+		Order("users.username").
+		Pluck("user_positions.user_id", &state.Members).Error
+	return state, err
+}
+
+func (h *SCIMHandler) findUser(c *fiber.Ctx, db *gorm.DB) (models.User, *scim.Error) {
+	var user models.User
+	notFound := scim.Errorf(fiber.StatusNotFound, "", "User %s not found", c.Params("id"))
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return user, notFound
+	}
+	if err := db.First(&user, "id = ? AND status <> ?", id, models.UserStatusDeactivated).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return user, notFound
+		}
+		return user, h.internalError(c, "Failed to fetch user", err)
+	}
+	return user, nil
+}
+
+func (h *SCIMHandler) findGroup(c *fiber.Ctx, db *gorm.DB) (models.Position, *scim.Error) {
+	var position models.Position
+	notFound := scim.Errorf(fiber.StatusNotFound, "", "Group %s not found", c.Params("id"))
+
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return position, notFound
+	}
+	if err := db.First(&position, "id = ?", id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return position, notFound
+		}
+		return position, h.internalError(c, "Failed to fetch group", err)
+	}
+	return position, nil
+}
+
+func (h *SCIMHandler) respondUser(c *fiber.Ctx, db *gorm.DB, status int, user models.User) error {
+	resources, err := h.userResources(db, []models.User{user})
+	if err != nil {
+		return scimFailure(c, "Failed to fetch user", err)
+	}
+	return c.Status(status).JSON(resources[0], scim.ContentType)
+}
+
+func (h *SCIMHandler) respondGroup(c *fiber.Ctx, db *gorm.DB, status int, position models.Position, excludeMembers bool) error {
+	resources, err := h.groupResources(db, []models.Position{position}, excludeMembers)
+	if err != nil {
+		return scimFailure(c, "Failed to fetch group", err)
+	}
+	return c.Status(status).JSON(resources[0], scim.ContentType)
+}
+
+// userResources converts users, loading their group memberships.
+func (h *SCIMHandler) userResources(db *gorm.DB, users []models.User) ([]SCIMUser, error) {
+	ids := make([]uuid.UUID, len(users))
+	for i, user := range users {
+		ids[i] = user.ID
+	}
+	var memberships []models.UserPosition
+	if len(ids) > 0 {
+		err := db.InnerJoins("Position").Where("user_positions.user_id IN ?", ids).Find(&memberships).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+	groups := map[uuid.UUID][]SCIMReference{}
+	for _, membership := range memberships {
+		groups[membership.UserID] = append(groups[membership.UserID], SCIMReference{
+			Value:   membership.PositionID.String(),
+			Ref:     h.baseURL + "/Groups/" + membership.PositionID.String(),
+			Display: membership.Position.Name,
+		})
+	}
+
+	resources := make([]SCIMUser, len(users))
+	for i, user := range users {
+		created, modified := user.CreatedAt, user.UpdatedAt
+		resource := SCIMUser{
+			Schemas:     []string{scim.SchemaUser},
+			ID:          user.ID.String(),
+			UserName:    user.Username,
+			Name:        SCIMName{Formatted: user.Name},
+			DisplayName: user.Name,
+			Active:      user.Status == models.UserStatusActive,
+			Locale:      user.Locale,
+			Timezone:    user.Timezone,
+			Groups:      groups[user.ID],
+			Meta: scim.Meta{
+				ResourceType: "User",
+				Created:      &created,
+				LastModified: &modified,
+				Location:     h.baseURL + "/Users/" + user.ID.String(),
+			},
+		}
+		if resource.Groups == nil {
+			resource.Groups = []SCIMReference{}
+		}
+		if user.Email != nil {
+			resource.Emails = []SCIMEmail{{Value: *user.Email, Type: "work", Primary: true}}
+		}
+		resources[i] = resource
+	}
+	return resources, nil
+}
+
+// groupResources converts positions, loading their members unless
+// excludeMembers is set.
+func (h *SCIMHandler) groupResources(db *gorm.DB, positions []models.Position, excludeMembers bool) ([]SCIMGroup, error) {
+	ids := make([]uuid.UUID, len(positions))
+	for i, position := range positions {
+		ids[i] = position.ID
+	}
+	members := map[uuid.UUID][]SCIMReference{}
+	if !excludeMembers && len(ids) > 0 {
+		var memberships []models.UserPosition
+		err := db.InnerJoins("User").
+			Where(`user_positions.position_id IN ? AND "User".status <> ?`, ids, models.UserStatusDeactivated).
+			Find(&memberships).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, membership := range memberships {
+			members[membership.PositionID] = append(members[membership.PositionID], SCIMReference{
+				Value:   membership.UserID.String(),
+				Ref:     h.baseURL + "/Users/" + membership.UserID.String(),
+				Display: membership.User.Username,
+			})
+		}
+	}
+
+	resources := make([]SCIMGroup, len(positions))
+	for i, position := range positions {
+		resources[i] = SCIMGroup{
+			Schemas:     []string{scim.SchemaGroup},
+			ID:          position.ID.String(),
+			DisplayName: position.Name,
+			Members:     members[position.ID],
+			Meta: scim.Meta{
+				ResourceType: "Group",
+				Location:     h.baseURL + "/Groups/" + position.ID.String(),
+			},
+		}
+	}
+	return resources, nil
+}
+
+func (h *SCIMHandler) internalError(c *fiber.Ctx, message string, err error) *scim.Error {
+	logging.FromContext(c.UserContext()).Error(message, "error", err)
+	return scim.Errorf(fiber.StatusInternalServerError, "", "%s", message)
+}
+
+// scimListQuery applies ?filter= to query and returns the 1-based start
+// index and page size.
+func scimListQuery(c *fiber.Ctx, query *gorm.DB, columns map[string]scim.Column) (*gorm.DB, int, int, *scim.Error) {
+	startIndex := c.QueryInt("startIndex", 1)
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	count := c.QueryInt("count", scim.DefaultCount)
+	if count < 0 {
+		count = 0
+	}
+	if count > scim.MaxCount {
+		count = scim.MaxCount
+	}
+
+	if raw := c.Query("filter"); raw != "" {
+		filter, err := scim.ParseFilter(raw)
+		if err != nil {
+			return nil, 0, 0, err.(*scim.Error)
+		}
+		condition, args, err := scim.ToSQL(filter, columns)
+		if err != nil {
+			return nil, 0, 0, err.(*scim.Error)
+		}
+		query = query.Where(condition, args...)
+	}
+	return query, startIndex, count, nil
+}
+
+func excludesMembers(c *fiber.Ctx) bool {
+	for _, attr := range strings.Split(c.Query("excludedAttributes"), ",") {
+		if scim.NormalizeAttr(strings.TrimSpace(attr)) == "members" {
+			return true
+		}
+	}
+	return false
+}
+
+func scimError(c *fiber.Ctx, err *scim.Error) error {
+	return c.Status(err.Status).JSON(err, scim.ContentType)
+}
+
+func scimFailure(c *fiber.Ctx, message string, err error) error {
+	logging.FromContext(c.UserContext()).Error(message, "error", err)
+	return scimError(c, scim.Errorf(fiber.StatusInternalServerError, "", "%s", message))
+}
+
+func scimString(raw json.RawMessage, target *string) *scim.Error {
+	if err := json.Unmarshal(raw, target); err != nil {
+		return scim.Errorf(fiber.StatusBadRequest, "invalidValue", "Expected a string but got %s", raw)
+	}
+	return nil
+}
+
+// scimDisplayName picks the name to store from the attributes clients
+// commonly send, falling back to fallback.
+func scimDisplayName(displayName string, name SCIMName, fallback string) string {
+	if displayName != "" {
+		return displayName
+	}
+	if name.Formatted != "" {
+		return name.Formatted
+	}
+	if full := strings.TrimSpace(name.GivenName + " " + name.FamilyName); full != "" {
+		return full
+	}
+	return fallback
+}
+
+// primaryEmail returns the primary address, or the first one when none is
+// marked primary.
+func primaryEmail(emails []SCIMEmail) string {
+	for _, email := range emails {
+		if email.Primary {
+			return email.Value
+		}
+	}
+	if len(emails) > 0 {
+		return emails[0].Value
+	}
+	return ""
+}
+
+func containsUUID(ids []uuid.UUID, id uuid.UUID) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
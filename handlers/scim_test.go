@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+
+	"todo-apps/scim"
+)
+
+func TestSCIMUserPatchNameParts(t *testing.T) {
+	tests := []struct {
+		name    string
+		current string
+		ops     []scim.PatchOperation
+		want    string
+		wantErr string
+	}{
+		{
+			name:    "given name",
+			current: "John Smith",
+			ops:     []scim.PatchOperation{{Op: "replace", Path: "name.givenName", Value: json.RawMessage(`"Jane"`)}},
+			want:    "Jane Smith",
+		},
+		{
+			name:    "family name",
+			current: "Mary Ann Smith",
+			ops:     []scim.PatchOperation{{Op: "replace", Path: "name.familyName", Value: json.RawMessage(`"Jones"`)}},
+			want:    "Mary Ann Jones",
+		},
+		{
+			name:    "both parts in separate operations",
+			current: "John Smith",
+			ops: []scim.PatchOperation{
+				{Op: "replace", Path: "name.familyName", Value: json.RawMessage(`"van Dyke"`)},
+				{Op: "replace", Path: "name.givenName", Value: json.RawMessage(`"Jan Willem"`)},
+			},
+			want: "Jan Willem van Dyke",
+		},
+		{
+			name:    "both parts without a path",
+			current: "John Smith",
+			ops: []scim.PatchOperation{
+				{Op: "replace", Value: json.RawMessage(`{"name.givenName": "Jan Willem", "name.familyName": "van Dyke"}`)},
+			},
+			want: "Jan Willem van Dyke",
+		},
+		{
+			name:    "partial name object",
+			current: "John Smith",
+			ops:     []scim.PatchOperation{{Op: "replace", Path: "name", Value: json.RawMessage(`{"familyName": "Doe"}`)}},
+			want:    "John Doe",
+		},
+		{
+			name:    "formatted wins",
+			current: "John Smith",
+			ops:     []scim.PatchOperation{{Op: "replace", Path: "name", Value: json.RawMessage(`{"formatted": "Dr. J. Smith", "givenName": "John"}`)}},
+			want:    "Dr. J. Smith",
+		},
+		{
+			name:    "single word name",
+			current: "Cher",
+			ops:     []scim.PatchOperation{{Op: "add", Path: "name.familyName", Value: json.RawMessage(`"Sarkisian"`)}},
+			want:    "Cher Sarkisian",
+		},
+		{
+			name:    "unsupported part",
+			current: "John Smith",
+			ops:     []scim.PatchOperation{{Op: "replace", Path: "name.middleName", Value: json.RawMessage(`"Q"`)}},
+			wantErr: "invalidPath",
+		},
+		{
+			name:    "non-string part",
+			current: "John Smith",
+			ops:     []scim.PatchOperation{{Op: "replace", Path: "name.givenName", Value: json.RawMessage(`42`)}},
+			wantErr: "invalidValue",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state := scimUserState{UserName: "user", Name: tt.current}
+			var err *scim.Error
+			for _, op := range tt.ops {
+				if err = state.patch(op); err != nil {
+					break
+				}
+			}
+			if tt.wantErr != "" {
+				if err == nil || err.ScimType != tt.wantErr {
+					t.Fatalf("error = %v, want scimType %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state.Name != tt.want {
+				t.Errorf("name = %q, want %q", state.Name, tt.want)
+			}
+		})
+	}
+}
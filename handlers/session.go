@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"todo-apps/config"
+	"todo-apps/logging"
+	"todo-apps/models"
+	"todo-apps/services"
+	"todo-apps/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// maxUserAgentLength caps the User-Agent stored with a session.
+const maxUserAgentLength = 512
+
+// truncateUTF8 shortens s to at most n bytes without splitting a character
+// and drops invalid bytes, which Postgres would refuse to store as text.
+func truncateUTF8(s string, n int) string {
+	s = strings.ToValidUTF8(s, "")
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// startSession records a session for user on the requesting device. Its ID
+// is the jti of the token issued for it. impersonator is set when an
+// administrator is acting as user.
+func startSession(c *fiber.Ctx, db *gorm.DB, user models.User, ttl time.Duration, impersonator *models.User) (models.Session, error) {
+	userAgent := truncateUTF8(c.Get(fiber.HeaderUserAgent), maxUserAgentLength)
+
+	now := time.Now()
+	session := models.Session{
+		UserID:       user.ID,
+		TokenVersion: user.TokenVersion,
+		Device:       utils.DeviceName(userAgent),
+		UserAgent:    userAgent,
+		IP:           c.IP(),
+		LastSeenAt:   now,
+		ExpiresAt:    now.Add(ttl),
+	}
+	if impersonator != nil {
+		session.ImpersonatorID = &impersonator.ID
+	}
+	err := db.WithContext(c.UserContext()).Create(&session).Error
+	return session, err
+}
+
+// issueToken starts a session for user and returns a JWT bound to it.
+func issueToken(c *fiber.Ctx, db *gorm.DB, jwtCfg config.JWTConfig, user models.User) (string, error) {
+	session, err := startSession(c, db, user, jwtCfg.TTL, nil)
+	if err != nil {
+		return "", err
+	}
+	return utils.GenerateJWT(jwtCfg.KeySet, jwtCfg.TTL, user, session.ID.String())
+}
+
+type SessionHandler struct {
+	db           *gorm.DB
+	auditService *services.AuditService
+}
+
+func NewSessionHandler(cfg *config.Config, auditService *services.AuditService) *SessionHandler {
+	return &SessionHandler{
+		db:           cfg.Database,
+		auditService: auditService,
+	}
+}
+
+// GET /me/sessions - List the current user's active sessions
+func (h *SessionHandler) GetMySessions(c *fiber.Ctx) error {
+	return h.listSessions(c, c.Locals("user_id").(string))
+}
+
+// DELETE /me/sessions/:id - End one of the current user's sessions
+func (h *SessionHandler) EndMySession(c *fiber.Ctx) error {
+	return h.endSession(c, c.Locals("user_id").(string), c.Params("id"))
+}
+
+// GET /admin/users/:id/sessions - List a user's active sessions
+func (h *SessionHandler) GetUserSessions(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+
+	var count int64
+	if err := h.db.WithContext(c.UserContext()).Model(&models.User{}).Where("id = ?", id).Count(&count).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to fetch user", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch user",
+		})
+	}
+	if count == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	}
+
+	return h.listSessions(c, id.String())
+}
+
+// DELETE /admin/users/:id/sessions/:session_id - End one of a user's sessions
+func (h *SessionHandler) EndUserSession(c *fiber.Ctx) error {
+	id, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid user ID",
+		})
+	}
+	return h.endSession(c, id.String(), c.Params("session_id"))
+}
+
+// listSessions returns userID's sessions that can still authenticate:
+// not ended, not expired and not revoked by a token version bump.
+func (h *SessionHandler) listSessions(c *fiber.Ctx, userID string) error {
+	db := h.db.WithContext(c.UserContext())
+	var sessions []models.Session
+
+	err := db.Where("user_id = ? AND ended_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Where("token_version = (?)", db.Model(&models.User{}).Select("token_version").Where("id = ?", userID)).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to fetch sessions", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch sessions",
+		})
+	}
+
+	current, _ := c.Locals("session_id").(string)
+	data := NewSessionViews(sessions)
+	for i, session := range sessions {
+		data[i].Current = session.ID.String() == current
+	}
+
+	return c.JSON(fiber.Map{
+		"data": data,
+	})
+}
+
+func (h *SessionHandler) endSession(c *fiber.Ctx, userID, sessionID string) error {
+	db := h.db.WithContext(c.UserContext())
+
+	id, err := uuid.Parse(sessionID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid session ID",
+		})
+	}
+
+	result := db.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND ended_at IS NULL", id, userID).
+		Update("ended_at", time.Now())
+	if result.Error != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to end session", "error", result.Error)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to end session",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "Session not found",
+		})
+	}
+
+	// Log audit
+	h.auditService.LogAction(c.UserContext(), c.Locals("user_id").(string), "REVOKE", "sessions", id.String(), nil, map[string]interface{}{
+		"user_id": userID,
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "Session ended successfully",
+	})
+}
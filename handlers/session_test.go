@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		n    int
+		want string
+	}{
+		{"short", "curl/8.0", 512, "curl/8.0"},
+		{"ascii", strings.Repeat("a", 10), 4, "aaaa"},
+		{"split rune", "ab€", 4, "ab"},
+		{"rune boundary", "ab€", 5, "ab€"},
+		{"invalid bytes", "a\xffb", 512, "ab"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := truncateUTF8(tt.in, tt.n)
+			if got != tt.want {
+				t.Errorf("truncateUTF8(%q, %d) = %q, want %q", tt.in, tt.n, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("truncateUTF8(%q, %d) is not valid UTF-8", tt.in, tt.n)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"todo-apps/config"
+	"todo-apps/logging"
 	"todo-apps/models"
 	"todo-apps/services"
 
@@ -13,33 +14,45 @@ import (
 
 type TaskHandler struct {
 	db           *gorm.DB
+	readDB       *gorm.DB
 	auditService *services.AuditService
 }
 
 func NewTaskHandler(cfg *config.Config, auditService *services.AuditService) *TaskHandler {
 	return &TaskHandler{
 		db:           cfg.Database,
+		readDB:       cfg.ReadDatabase,
 		auditService: auditService,
 	}
 }
 
 // GET /tasks - Get all tasks
 func (h *TaskHandler) GetTasks(c *fiber.Ctx) error {
+	db := h.readDB.WithContext(c.UserContext())
 	var tasks []models.Task
 
-	if err := h.db.Preload("User").Find(&tasks).Error; err != nil {
+	loc, err := requestedLocation(c, db)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "tz must be \"me\" or an IANA timezone name",
+		})
+	}
+
+	if err := db.Preload("User").Find(&tasks).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to fetch tasks", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch tasks",
 		})
 	}
 
 	return c.JSON(fiber.Map{
-		"data": tasks,
+		"data": NewTaskViews(tasks, loc),
 	})
 }
 
 // POST /tasks - Create a new task
 func (h *TaskHandler) CreateTask(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
 	var task models.Task
 
 	if err := c.BodyParser(&task); err != nil {
@@ -49,14 +62,15 @@ func (h *TaskHandler) CreateTask(c *fiber.Ctx) error {
 	}
 
 	// Create task
-	if err := h.db.Create(&task).Error; err != nil {
+	if err := db.Create(&task).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to create task", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create task",
 		})
 	}
 
 	// Load user relationship
-	h.db.Preload("User").First(&task, task.ID)
+	db.Preload("User").First(&task, task.ID)
 
 	// Log audit
 	userID := c.Locals("user_id")
@@ -65,16 +79,17 @@ func (h *TaskHandler) CreateTask(c *fiber.Ctx) error {
 		var taskData map[string]interface{}
 		json.Unmarshal(taskJSON, &taskData)
 
-		h.auditService.LogCreate(userID.(string), "tasks", task.ID.String(), taskData)
+		h.auditService.LogCreate(c.UserContext(), userID.(string), "tasks", task.ID.String(), taskData)
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"data": task,
+		"data": NewTaskView(task),
 	})
 }
 
 // PUT /tasks/:id - Update a task
 func (h *TaskHandler) UpdateTask(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
 	taskID := c.Params("id")
 
 	// Parse UUID
@@ -87,12 +102,13 @@ func (h *TaskHandler) UpdateTask(c *fiber.Ctx) error {
 
 	// Get existing task
 	var existingTask models.Task
-	if err := h.db.Preload("User").First(&existingTask, "id = ?", id).Error; err != nil {
+	if err := db.Preload("User").First(&existingTask, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"error": "Task not found",
 			})
 		}
+		logging.FromContext(c.UserContext()).Error("Failed to fetch task", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch task",
 		})
@@ -112,14 +128,15 @@ func (h *TaskHandler) UpdateTask(c *fiber.Ctx) error {
 	}
 
 	// Update task
-	if err := h.db.Model(&existingTask).Updates(updateData).Error; err != nil {
+	if err := db.Model(&existingTask).Updates(updateData).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to update task", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update task",
 		})
 	}
 
 	// Get updated task
-	h.db.Preload("User").First(&existingTask, "id = ?", id)
+	db.Preload("User").First(&existingTask, "id = ?", id)
 
 	// Store after state for audit
 	afterJSON, _ := json.Marshal(existingTask)
@@ -129,16 +146,17 @@ func (h *TaskHandler) UpdateTask(c *fiber.Ctx) error {
 	// Log audit
 	authUserID := c.Locals("user_id")
 	if authUserID != nil {
-		h.auditService.LogUpdate(authUserID.(string), "tasks", id.String(), beforeData, afterData)
+		h.auditService.LogUpdate(c.UserContext(), authUserID.(string), "tasks", id.String(), beforeData, afterData)
 	}
 
 	return c.JSON(fiber.Map{
-		"data": existingTask,
+		"data": NewTaskView(existingTask),
 	})
 }
 
 // DELETE /tasks/:id - Delete a task
 func (h *TaskHandler) DeleteTask(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
 	taskID := c.Params("id")
 
 	// Parse UUID
@@ -151,12 +169,13 @@ func (h *TaskHandler) DeleteTask(c *fiber.Ctx) error {
 
 	// Get existing task for audit
 	var task models.Task
-	if err := h.db.Preload("User").First(&task, "id = ?", id).Error; err != nil {
+	if err := db.Preload("User").First(&task, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"error": "Task not found",
 			})
 		}
+		logging.FromContext(c.UserContext()).Error("Failed to fetch task", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch task",
 		})
@@ -168,7 +187,8 @@ func (h *TaskHandler) DeleteTask(c *fiber.Ctx) error {
 	json.Unmarshal(taskJSON, &taskData)
 
 	// Delete task
-	if err := h.db.Delete(&task, "id = ?", id).Error; err != nil {
+	if err := db.Delete(&task, "id = ?", id).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to delete task", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete task",
 		})
@@ -177,7 +197,7 @@ func (h *TaskHandler) DeleteTask(c *fiber.Ctx) error {
 	// Log audit
 	authUserID := c.Locals("user_id")
 	if authUserID != nil {
-		h.auditService.LogDelete(authUserID.(string), "tasks", id.String(), taskData)
+		h.auditService.LogDelete(c.UserContext(), authUserID.(string), "tasks", id.String(), taskData)
 	}
 
 	return c.JSON(fiber.Map{
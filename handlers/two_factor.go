@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"todo-apps/config"
+	"todo-apps/logging"
+	"todo-apps/metrics"
+	"todo-apps/models"
+	"todo-apps/ratelimit"
+	"todo-apps/services"
+	"todo-apps/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Challenge token purposes issued by AuthHandler.Login
+const (
+	twoFactorChallengePurpose = "2fa"
+	twoFactorEnrollPurpose    = "2fa_enroll"
+)
+
+var errInvalidTwoFactorCode = errors.New("invalid two-factor code")
+
+type TwoFactorHandler struct {
+	db           *gorm.DB
+	jwt          config.JWTConfig
+	twoFactor    config.TwoFactorConfig
+	limiter      *ratelimit.LoginLimiter
+	auditService *services.AuditService
+}
+
+func NewTwoFactorHandler(cfg *config.Config, limiter *ratelimit.LoginLimiter, auditService *services.AuditService) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		db:           cfg.Database,
+		jwt:          cfg.JWT,
+		twoFactor:    cfg.TwoFactor,
+		limiter:      limiter,
+		auditService: auditService,
+	}
+}
+
+type TwoFactorVerifyRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+type TwoFactorCodeRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+type TwoFactorDisableRequest struct {
+	Password string `json:"password"`
+}
+
+type TwoFactorEnrollResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TwoFactorConfirmResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// POST /auth/2fa/verify - Exchange a challenge token and code for a JWT
+func (h *TwoFactorHandler) Verify(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+	var req TwoFactorVerifyRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	user, ok, err := h.userFromChallenge(c, req.ChallengeToken, twoFactorChallengePurpose)
+	if !ok {
+		return err
+	}
+	if allowed, err := enforceLoginRateLimit(c, h.limiter, user.Username); !allowed {
+		return err
+	}
+
+	if req.RecoveryCode != "" {
+		err = useRecoveryCode(db, user.ID, req.RecoveryCode)
+	} else {
+		err = useTOTPCode(db, user, req.Code)
+	}
+	if err == errInvalidTwoFactorCode {
+		metrics.LoginAttempts.WithLabelValues("failure").Inc()
+		if err := h.limiter.RecordFailure(c.UserContext(), user.Username); err != nil {
+			logging.FromContext(c.UserContext()).Error("Failed to record login failure", "error", err)
+		}
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid two-factor code",
+		})
+	}
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to verify two-factor code", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to verify two-factor code",
+		})
+	}
+
+	recordLoginSuccess(c, h.limiter, user.Username)
+	return respondWithToken(c, h.db.WithContext(c.UserContext()), h.jwt, user, nil)
+}
+
+// POST /api/me/2fa/enroll - Start TOTP enrollment for the current user
+func (h *TwoFactorHandler) Enroll(c *fiber.Ctx) error {
+	user, ok, err := h.currentUser(c)
+	if !ok {
+		return err
+	}
+	return h.enroll(c, user)
+}
+
+// POST /api/me/2fa/confirm - Enable TOTP after verifying the first code
+func (h *TwoFactorHandler) Confirm(c *fiber.Ctx) error {
+	var req TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	user, ok, err := h.currentUser(c)
+	if !ok {
+		return err
+	}
+
+	codes, ok, err := h.confirm(c, user, req.Code)
+	if !ok {
+		return err
+	}
+	return c.JSON(TwoFactorConfirmResponse{RecoveryCodes: codes})
+}
+
+// DELETE /api/me/2fa - Disable TOTP for the current user
+func (h *TwoFactorHandler) Disable(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
+	var req TwoFactorDisableRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	user, ok, err := h.currentUser(c)
+	if !ok {
+		return err
+	}
+
+	if valid, _ := utils.CheckPasswordHash(req.Password, user.Password); !valid {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Password is incorrect",
+		})
+	}
+
+	required, err := requiresTwoFactor(db, user.ID)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to check two-factor requirement", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to check two-factor requirement",
+		})
+	}
+	if required {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error": "Two-factor authentication is required for your position",
+		})
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&user).Updates(map[string]interface{}{
+			"two_factor_enabled": false,
+			"totp_secret":        "",
+			"totp_last_counter":  0,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+	})
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to disable two-factor authentication", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to disable two-factor authentication",
+		})
+	}
+
+	h.auditService.LogAction(c.UserContext(), user.ID.String(), "2FA_DISABLE", "users", user.ID.String(), nil, nil)
+
+	return c.JSON(fiber.Map{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// POST /auth/2fa/enroll - Start mandatory enrollment during login
+func (h *TwoFactorHandler) EnrollWithChallenge(c *fiber.Ctx) error {
+	var req TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	user, ok, err := h.userFromChallenge(c, req.ChallengeToken, twoFactorEnrollPurpose)
+	if !ok {
+		return err
+	}
+	return h.enroll(c, user)
+}
+
+// POST /auth/2fa/enroll/confirm - Finish mandatory enrollment and log in
+func (h *TwoFactorHandler) ConfirmWithChallenge(c *fiber.Ctx) error {
+	var req TwoFactorCodeRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Invalid request body",
+		})
+	}
+
+	user, ok, err := h.userFromChallenge(c, req.ChallengeToken, twoFactorEnrollPurpose)
+	if !ok {
+		return err
+	}
+	if allowed, err := enforceLoginRateLimit(c, h.limiter, user.Username); !allowed {
+		return err
+	}
+
+	codes, ok, err := h.confirm(c, user, req.Code)
+	if !ok {
+		return err
+	}
+	recordLoginSuccess(c, h.limiter, user.Username)
+	return respondWithToken(c, h.db.WithContext(c.UserContext()), h.jwt, user, codes)
+}
+
+func (h *TwoFactorHandler) enroll(c *fiber.Ctx, user models.User) error {
+	if user.TwoFactorEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Two-factor authentication is already enabled",
+		})
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to generate TOTP secret", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate TOTP secret",
+		})
+	}
+
+	// The secret stays inactive until confirmed with a valid code
+	err = h.db.WithContext(c.UserContext()).Model(&user).Updates(map[string]interface{}{
+		"totp_secret":       secret,
+		"totp_last_counter": 0,
+	}).Error
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to store TOTP secret", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to store TOTP secret",
+		})
+	}
+
+	return c.JSON(TwoFactorEnrollResponse{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(h.twoFactor.Issuer, user.Username, secret),
+	})
+}
+
+// confirm enables 2FA once code matches the pending secret and returns
+// freshly generated recovery codes. On failure the response is written.
+func (h *TwoFactorHandler) confirm(c *fiber.Ctx, user models.User, code string) ([]string, bool, error) {
+	db := h.db.WithContext(c.UserContext())
+
+	if user.TwoFactorEnabled {
+		return nil, false, c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "Two-factor authentication is already enabled",
+		})
+	}
+	if user.TOTPSecret == "" {
+		return nil, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "Two-factor enrollment has not been started",
+		})
+	}
+
+	codes, err := utils.GenerateRecoveryCodes(h.twoFactor.RecoveryCodes)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to generate recovery codes", "error", err)
+		return nil, false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to generate recovery codes",
+		})
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := useTOTPCode(tx, user, code); err != nil {
+			return err
+		}
+		if err := tx.Model(&user).Update("two_factor_enabled", true).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for _, code := range codes {
+			recoveryCode := models.RecoveryCode{UserID: user.ID, CodeHash: utils.HashToken(code)}
+			if err := tx.Create(&recoveryCode).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err == errInvalidTwoFactorCode {
+		return nil, false, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid two-factor code",
+		})
+	}
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to enable two-factor authentication", "error", err)
+		return nil, false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to enable two-factor authentication",
+		})
+	}
+
+	h.auditService.LogAction(c.UserContext(), user.ID.String(), "2FA_ENABLE", "users", user.ID.String(), nil, nil)
+	return codes, true, nil
+}
+
+// userFromChallenge loads the user named by a challenge token. On failure
+// the 401 response is written and false is returned.
+func (h *TwoFactorHandler) userFromChallenge(c *fiber.Ctx, token, purpose string) (models.User, bool, error) {
+	var user models.User
+
+	claims, err := utils.ParseChallengeJWT(h.jwt.KeySet, token, purpose)
+	if err == nil {
+		err = h.db.WithContext(c.UserContext()).First(&user, "id = ?", claims.UserID).Error
+	}
+	if err != nil || user.TokenVersion != claims.TokenVersion {
+		return user, false, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Invalid or expired challenge token",
+		})
+	}
+	return user, true, nil
+}
+
+func (h *TwoFactorHandler) currentUser(c *fiber.Ctx) (models.User, bool, error) {
+	var user models.User
+	if err := h.db.WithContext(c.UserContext()).First(&user, "id = ?", c.Locals("user_id")).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to fetch user", "error", err)
+		return user, false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to fetch user",
+		})
+	}
+	return user, true, nil
+}
+
+// useTOTPCode validates code and records its time step so it can't be
+// replayed.
+func useTOTPCode(db *gorm.DB, user models.User, code string) error {
+	counter, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return errInvalidTwoFactorCode
+	}
+
+	result := db.Model(&models.User{}).
+		Where("id = ? AND totp_last_counter < ?", user.ID, counter).
+		Update("totp_last_counter", counter)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// useRecoveryCode consumes one of the user's unused recovery codes.
+func useRecoveryCode(db *gorm.DB, userID uuid.UUID, code string) error {
+	result := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashToken(utils.NormalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// requiresTwoFactor reports whether any of the user's positions requires 2FA.
+func requiresTwoFactor(db *gorm.DB, userID uuid.UUID) (bool, error) {
+	var count int64
+	err := db.Model(&models.UserPosition{}).
+		Joins("JOIN positions ON positions.id = user_positions.position_id").
+		Where("user_positions.user_id = ? AND positions.require_2fa = ?", userID, true).
+		Count(&count).Error
+	return count > 0, err
+}
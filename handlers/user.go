@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"todo-apps/config"
+	"todo-apps/logging"
 	"todo-apps/models"
 	"todo-apps/services"
 	"todo-apps/utils"
@@ -13,53 +14,107 @@ import (
 )
 
 type UserHandler struct {
-	db           *gorm.DB
-	auditService *services.AuditService
+	db                  *gorm.DB
+	readDB              *gorm.DB
+	auditService        *services.AuditService
+	passwordService     *services.PasswordService
+	deactivationService *services.DeactivationService
 }
 
-func NewUserHandler(cfg *config.Config, auditService *services.AuditService) *UserHandler {
+func NewUserHandler(cfg *config.Config, auditService *services.AuditService, passwordService *services.PasswordService, deactivationService *services.DeactivationService) *UserHandler {
 	return &UserHandler{
-		db:           cfg.Database,
-		auditService: auditService,
+		db:                  cfg.Database,
+		readDB:              cfg.ReadDatabase,
+		auditService:        auditService,
+		passwordService:     passwordService,
+		deactivationService: deactivationService,
 	}
 }
 
+// UserRequest is the body accepted when registering, creating or updating a
+// user. Password is plaintext and only ever stored hashed.
+type UserRequest struct {
+	Name      string `json:"name"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	Email     string `json:"email"`
+	Timezone  string `json:"timezone"`
+	Locale    string `json:"locale"`
+	AvatarURL string `json:"avatar_url"`
+}
+
 // GET /users - Get all users
 func (h *UserHandler) GetUsers(c *fiber.Ctx) error {
+	db := h.readDB.WithContext(c.UserContext())
 	var users []models.User
 
-	if err := h.db.Find(&users).Error; err != nil {
+	if err := db.Find(&users).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to fetch users", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch users",
 		})
 	}
 
 	return c.JSON(fiber.Map{
-		"data": users,
+		"data": NewUserViews(users),
 	})
 }
 
 // POST /users - Create a new user
 func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
-	var user models.User
+	db := h.db.WithContext(c.UserContext())
+	var req UserRequest
 
-	if err := c.BodyParser(&user); err != nil {
+	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid request body",
 		})
 	}
 
+	// Validate optional profile settings
+	user := models.User{Name: req.Name, Username: req.Username}
+	violations, err := profileViolations(db, uuid.Nil, &user, req)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to validate profile", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to validate profile",
+		})
+	}
+	if len(violations) > 0 {
+		return validationError(c, "Invalid profile", violations)
+	}
+
+	// Enforce password policy
+	violations, err = h.passwordService.Validate(c.UserContext(), uuid.Nil, req.Password)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to validate password", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to validate password",
+		})
+	}
+	if len(violations) > 0 {
+		return validationError(c, "Password does not meet policy", violations)
+	}
+
 	// Hash password
-	hashedPassword, err := utils.HashPassword(user.Password)
+	hashedPassword, err := utils.HashPassword(req.Password)
 	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to hash password", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to h	ash password",
+			"error": "Failed to hash password",
 		})
 	}
 	user.Password = hashedPassword
 
-	// Create user
-	if err := h.db.Create(&user).Error; err != nil {
+	// Create user and record the initial password in its history
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return h.passwordService.Record(tx, user.ID, user.Password)
+	})
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to create user", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create user",
 		})
@@ -68,24 +123,21 @@ func (h *UserHandler) CreateUser(c *fiber.Ctx) error {
 	// Log audit
 	userID := c.Locals("user_id")
 	if userID != nil {
-		userJSON, _ := json.Marshal(user)
+		userJSON, _ := json.Marshal(NewUserView(user))
 		var userData map[string]interface{}
 		json.Unmarshal(userJSON, &userData)
-		delete(userData, "password") // Remove password from audit log
 
-		h.auditService.LogCreate(userID.(string), "users", user.ID.String(), userData)
+		h.auditService.LogCreate(c.UserContext(), userID.(string), "users", user.ID.String(), userData)
 	}
 
-	// Remove password from response
-	user.Password = ""
-
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"data": user,
+		"data": NewUserView(user),
 	})
 }
 
 // PUT /users/:id - Update a user
 func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
 	userID := c.Params("id")
 
 	// Parse UUID
@@ -98,35 +150,66 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 
 	// Get existing user
 	var existingUser models.User
-	if err := h.db.First(&existingUser, "id = ?", id).Error; err != nil {
+	if err := db.First(&existingUser, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"error": "User not found",
 			})
 		}
+		logging.FromContext(c.UserContext()).Error("Failed to fetch user", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch user",
 		})
 	}
 
 	// Store before state for audit
-	beforeJSON, _ := json.Marshal(existingUser)
+	beforeJSON, _ := json.Marshal(NewUserView(existingUser))
 	var beforeData map[string]interface{}
 	json.Unmarshal(beforeJSON, &beforeData)
-	delete(beforeData, "password")
 
 	// Parse update data
-	var updateData models.User
-	if err := c.BodyParser(&updateData); err != nil {
+	var req UserRequest
+	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid request body",
 		})
 	}
+	updateData := models.User{Name: req.Name, Username: req.Username}
+	violations, err := profileViolations(db, existingUser.ID, &updateData, req)
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to validate profile", "error", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to validate profile",
+		})
+	}
+	if len(violations) > 0 {
+		return validationError(c, "Invalid profile", violations)
+	}
+
+	// Admins change their own password like everyone else, with the
+	// current one
+	if req.Password != "" && existingUser.ID.String() == c.Locals("user_id") {
+		return validationError(c, "Profile update rejected", []utils.PolicyViolation{
+			{Field: "password", Code: "read_only", Message: selfReadOnlyFields["password"]},
+		})
+	}
+
+	// Enforce password policy and hash password if provided
+	if req.Password != "" {
+		violations, err := h.passwordService.Validate(c.UserContext(), existingUser.ID, req.Password)
+		if err != nil {
+			logging.FromContext(c.UserContext()).Error("Failed to validate password", "error", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to validate password",
+			})
+		}
+		if len(violations) > 0 {
+			return validationError(c, "Password does not meet policy", violations)
+		}
 
-	// Hash password if provided
-	if updateData.Password != "" {
-		hashedPassword, err := utils.HashPassword(updateData.Password)
+		hashedPassword, err := utils.HashPassword(req.Password)
 		if err != nil {
+			logging.FromContext(c.UserContext()).Error("Failed to hash password", "error", err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"error": "Failed to hash password",
 			})
@@ -134,81 +217,134 @@ func (h *UserHandler) UpdateUser(c *fiber.Ctx) error {
 		updateData.Password = hashedPassword
 	}
 
-	// Update user
-	if err := h.db.Model(&existingUser).Updates(updateData).Error; err != nil {
+	// Update user; a changed password revokes existing tokens and is recorded in its
+	// history, and a new email address must be verified again
+	emailChanged := updateData.Email != nil && !sameEmail(existingUser.Email, *updateData.Email)
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&existingUser).Updates(updateData).Error; err != nil {
+			return err
+		}
+		if emailChanged {
+			if err := tx.Model(&existingUser).Update("email_verified_at", nil).Error; err != nil {
+				return err
+			}
+		}
+		if updateData.Password == "" {
+			return nil
+		}
+		return h.passwordService.Change(tx, existingUser.ID, updateData.Password)
+	})
+	if err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to update user", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to update user",
 		})
 	}
 
 	// Get updated user
-	h.db.First(&existingUser, "id = ?", id)
+	db.First(&existingUser, "id = ?", id)
 
 	// Store after state for audit
-	afterJSON, _ := json.Marshal(existingUser)
+	afterJSON, _ := json.Marshal(NewUserView(existingUser))
 	var afterData map[string]interface{}
 	json.Unmarshal(afterJSON, &afterData)
-	delete(afterData, "password")
 
 	// Log audit
 	authUserID := c.Locals("user_id")
 	if authUserID != nil {
-		h.auditService.LogUpdate(authUserID.(string), "users", id.String(), beforeData, afterData)
+		h.auditService.LogUpdate(c.UserContext(), authUserID.(string), "users", id.String(), beforeData, afterData)
 	}
 
-	// Remove password from response
-	existingUser.Password = ""
-
 	return c.JSON(fiber.Map{
-		"data": existingUser,
+		"data": NewUserView(existingUser),
 	})
 }
 
-// DELETE /users/:id - Delete a user
+// DELETE /users/:id - Deactivate a user. Users are never deleted so their
+// tasks and history keep an owner; positions end and tokens are revoked.
+// ?reassign_to=<user id> hands their open tasks to another user.
 func (h *UserHandler) DeleteUser(c *fiber.Ctx) error {
-	userID := c.Params("id")
+	opts := services.DeactivationOptions{EndPositions: true, RevokeTokens: true}
+	if raw := c.Query("reassign_to"); raw != "" {
+		reassignTo, err := uuid.Parse(raw)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid reassign_to user ID",
+			})
+		}
+		opts.ReassignTo = &reassignTo
+	}
+	return h.deactivate(c, opts)
+}
 
-	// Parse UUID
-	id, err := uuid.Parse(userID)
+// DeactivateUserRequest chooses what happens to the user's work and access.
+// EndPositions and RevokeTokens default to true.
+type DeactivateUserRequest struct {
+	ReassignTo   *uuid.UUID `json:"reassign_to"`
+	EndPositions *bool      `json:"end_positions"`
+	RevokeTokens *bool      `json:"revoke_tokens"`
+}
+
+// POST /users/:id/deactivate - Deactivate a user, optionally reassigning
+// their open tasks, ending their positions and revoking their tokens
+func (h *UserHandler) DeactivateUser(c *fiber.Ctx) error {
+	var req DeactivateUserRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"error": "Invalid request body",
+			})
+		}
+	}
+
+	opts := services.DeactivationOptions{ReassignTo: req.ReassignTo, EndPositions: true, RevokeTokens: true}
+	if req.EndPositions != nil {
+		opts.EndPositions = *req.EndPositions
+	}
+	if req.RevokeTokens != nil {
+		opts.RevokeTokens = *req.RevokeTokens
+	}
+	return h.deactivate(c, opts)
+}
+
+func (h *UserHandler) deactivate(c *fiber.Ctx, opts services.DeactivationOptions) error {
+	id, err := uuid.Parse(c.Params("id"))
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Invalid user ID",
 		})
 	}
 
-	// Get existing user for audit
-	var user models.User
-	if err := h.db.First(&user, "id = ?", id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
-				"error": "User not found",
-			})
-		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to fetch user",
+	authUserID, _ := c.Locals("user_id").(string)
+	if authUserID == id.String() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "You cannot deactivate your own account",
 		})
 	}
 
-	// Store data for audit
-	userJSON, _ := json.Marshal(user)
-	var userData map[string]interface{}
-	json.Unmarshal(userJSON, &userData)
-	delete(userData, "password")
-
-	// Delete user
-	if err := h.db.Delete(&user, "id = ?", id).Error; err != nil {
+	report, err := h.deactivationService.Deactivate(c.UserContext(), authUserID, id, opts)
+	switch err {
+	case nil:
+	case services.ErrUserNotFound:
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"error": "User not found",
+		})
+	case services.ErrUserDeactivated:
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"error": "User is already deactivated",
+		})
+	case services.ErrInvalidReassignee, services.ErrReassignToSelf:
+		return validationError(c, "Invalid deactivation", []utils.PolicyViolation{
+			{Field: "reassign_to", Code: "invalid", Message: err.Error()},
+		})
+	default:
+		logging.FromContext(c.UserContext()).Error("Failed to deactivate user", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"error": "Failed to delete user",
+			"error": "Failed to deactivate user",
 		})
 	}
 
-	// Log audit
-	authUserID := c.Locals("user_id")
-	if authUserID != nil {
-		h.auditService.LogDelete(authUserID.(string), "users", id.String(), userData)
-	}
-
 	return c.JSON(fiber.Map{
-		"message": "User deleted successfully",
+		"data": report,
 	})
 }
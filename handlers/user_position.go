@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"todo-apps/config"
+	"todo-apps/logging"
 	"todo-apps/models"
 	"todo-apps/services"
 
@@ -13,33 +14,38 @@ import (
 
 type UserPositionHandler struct {
 	db           *gorm.DB
+	readDB       *gorm.DB
 	auditService *services.AuditService
 }
 
 func NewUserPositionHandler(cfg *config.Config, auditService *services.AuditService) *UserPositionHandler {
 	return &UserPositionHandler{
 		db:           cfg.Database,
+		readDB:       cfg.ReadDatabase,
 		auditService: auditService,
 	}
 }
 
 // GET /user-positions - Get all user positions
 func (h *UserPositionHandler) GetUserPositions(c *fiber.Ctx) error {
+	db := h.readDB.WithContext(c.UserContext())
 	var userPositions []models.UserPosition
 
-	if err := h.db.Preload("User").Preload("Position").Find(&userPositions).Error; err != nil {
+	if err := db.Preload("User").Preload("Position").Find(&userPositions).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to fetch user positions", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch user positions",
 		})
 	}
 
 	return c.JSON(fiber.Map{
-		"data": userPositions,
+		"data": NewUserPositionViews(userPositions),
 	})
 }
 
 // POST /user-positions - Create a new user position assignment
 func (h *UserPositionHandler) CreateUserPosition(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
 	var userPosition models.UserPosition
 
 	if err := c.BodyParser(&userPosition); err != nil {
@@ -50,14 +56,14 @@ func (h *UserPositionHandler) CreateUserPosition(c *fiber.Ctx) error {
 
 	// Validate that user and position exist
 	var user models.User
-	if err := h.db.First(&user, "id = ?", userPosition.UserID).Error; err != nil {
+	if err := db.First(&user, "id = ?", userPosition.UserID).Error; err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "User not found",
 		})
 	}
 
 	var position models.Position
-	if err := h.db.First(&position, "id = ?", userPosition.PositionID).Error; err != nil {
+	if err := db.First(&position, "id = ?", userPosition.PositionID).Error; err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"error": "Position not found",
 		})
@@ -65,21 +71,22 @@ func (h *UserPositionHandler) CreateUserPosition(c *fiber.Ctx) error {
 
 	// Check if assignment already exists
 	var existingAssignment models.UserPosition
-	if err := h.db.Where("user_id = ? AND position_id = ?", userPosition.UserID, userPosition.PositionID).First(&existingAssignment).Error; err == nil {
+	if err := db.Where("user_id = ? AND position_id = ?", userPosition.UserID, userPosition.PositionID).First(&existingAssignment).Error; err == nil {
 		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
 			"error": "User is already assigned to this position",
 		})
 	}
 
 	// Create user position
-	if err := h.db.Create(&userPosition).Error; err != nil {
+	if err := db.Create(&userPosition).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to create user position", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to create user position",
 		})
 	}
 
 	// Load relationships
-	h.db.Preload("User").Preload("Position").First(&userPosition, userPosition.ID)
+	db.Preload("User").Preload("Position").First(&userPosition, userPosition.ID)
 
 	// Log audit
 	userIDAuth := c.Locals("user_id")
@@ -88,16 +95,17 @@ func (h *UserPositionHandler) CreateUserPosition(c *fiber.Ctx) error {
 		var userPositionData map[string]interface{}
 		json.Unmarshal(userPositionJSON, &userPositionData)
 
-		h.auditService.LogCreate(userIDAuth.(string), "user_positions", userPosition.ID.String(), userPositionData)
+		h.auditService.LogCreate(c.UserContext(), userIDAuth.(string), "user_positions", userPosition.ID.String(), userPositionData)
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"data": userPosition,
+		"data": NewUserPositionView(userPosition),
 	})
 }
 
 // DELETE /user-positions/:id - Delete a user position assignment
 func (h *UserPositionHandler) DeleteUserPosition(c *fiber.Ctx) error {
+	db := h.db.WithContext(c.UserContext())
 	userPositionID := c.Params("id")
 
 	// Parse UUID
@@ -110,12 +118,13 @@ func (h *UserPositionHandler) DeleteUserPosition(c *fiber.Ctx) error {
 
 	// Get existing user position for audit
 	var userPosition models.UserPosition
-	if err := h.db.Preload("User").Preload("Position").First(&userPosition, "id = ?", id).Error; err != nil {
+	if err := db.Preload("User").Preload("Position").First(&userPosition, "id = ?", id).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"error": "User position not found",
 			})
 		}
+		logging.FromContext(c.UserContext()).Error("Failed to fetch user position", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to fetch user position",
 		})
@@ -127,7 +136,8 @@ func (h *UserPositionHandler) DeleteUserPosition(c *fiber.Ctx) error {
 	json.Unmarshal(userPositionJSON, &userPositionData)
 
 	// Delete user position
-	if err := h.db.Delete(&userPosition, "id = ?", id).Error; err != nil {
+	if err := db.Delete(&userPosition, "id = ?", id).Error; err != nil {
+		logging.FromContext(c.UserContext()).Error("Failed to delete user position", "error", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "Failed to delete user position",
 		})
@@ -136,7 +146,7 @@ func (h *UserPositionHandler) DeleteUserPosition(c *fiber.Ctx) error {
 	// Log audit
 	authUserID := c.Locals("user_id")
 	if authUserID != nil {
-		h.auditService.LogDelete(authUserID.(string), "user_positions", id.String(), userPositionData)
+		h.auditService.LogDelete(c.UserContext(), authUserID.(string), "user_positions", id.String(), userPositionData)
 	}
 
 	return c.JSON(fiber.Map{
@@ -0,0 +1,16 @@
+package handlers
+
+import (
+	"todo-apps/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// validationError responds 422 with the individual violations so clients
+// can show them next to the offending field.
+func validationError(c *fiber.Ctx, message string, violations []utils.PolicyViolation) error {
+	return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+		"error":      message,
+		"violations": violations,
+	})
+}
@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+
+	"todo-apps/logging"
+	"todo-apps/models"
+	"todo-apps/services"
+
+	"github.com/google/uuid"
+)
+
+// Response view models. Handlers serialize these instead of the gorm models
+// so that credentials such as password hashes, TOTP secrets and token hashes
+// have no path into a response, even through preloaded associations.
+
+type UserView struct {
+	ID               uuid.UUID  `json:"id"`
+	Name             string     `json:"name"`
+	Username         string     `json:"username"`
+	Email            *string    `json:"email"`
+	EmailVerifiedAt  *time.Time `json:"email_verified_at"`
+	Timezone         string     `json:"timezone"`
+	Locale           string     `json:"locale"`
+	AvatarURL        string     `json:"avatar_url"`
+	Status           string     `json:"status"`
+	TwoFactorEnabled bool       `json:"two_factor_enabled"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	LastLoginAt      *time.Time `json:"last_login_at"`
+	DeactivatedAt    *time.Time `json:"deactivated_at"`
+}
+
+func NewUserView(user models.User) UserView {
+	return UserView{
+		ID:               user.ID,
+		Name:             user.Name,
+		Username:         user.Username,
+		Email:            user.Email,
+		EmailVerifiedAt:  user.EmailVerifiedAt,
+		Timezone:         user.Timezone,
+		Locale:           user.Locale,
+		AvatarURL:        user.AvatarURL,
+		Status:           user.Status,
+		TwoFactorEnabled: user.TwoFactorEnabled,
+		CreatedAt:        user.CreatedAt,
+		UpdatedAt:        user.UpdatedAt,
+		LastLoginAt:      user.LastLoginAt,
+		DeactivatedAt:    user.DeactivatedAt,
+	}
+}
+
+// ProfileView is the current user's own profile, including private
+// settings that other users don't see.
+type ProfileView struct {
+	UserView
+	Preferences models.JSONB `json:"preferences"`
+}
+
+func NewProfileView(user models.User) ProfileView {
+	preferences := user.Preferences
+	if preferences == nil {
+		preferences = models.JSONB{}
+	}
+	return ProfileView{UserView: NewUserView(user), Preferences: preferences}
+}
+
+func NewUserViews(users []models.User) []UserView {
+	views := make([]UserView, len(users))
+	for i, user := range users {
+		views[i] = NewUserView(user)
+	}
+	return views
+}
+
+// loadedUserView returns nil when the association wasn't preloaded.
+func loadedUserView(user models.User) *UserView {
+	if user.ID == uuid.Nil {
+		return nil
+	}
+	view := NewUserView(user)
+	return &view
+}
+
+type TaskView struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	Todo      string    `json:"todo"`
+	StartDate time.Time `json:"start_date"`
+	EndDate   time.Time `json:"end_date"`
+	User      *UserView `json:"user,omitempty"`
+}
+
+func NewTaskView(task models.Task) TaskView {
+	return TaskView{
+		ID:        task.ID,
+		UserID:    task.UserID,
+		Todo:      task.Todo,
+		StartDate: task.StartDate,
+		EndDate:   task.EndDate,
+		User:      loadedUserView(task.User),
+	}
+}
+
+// NewTaskViews converts tasks, rendering their dates in loc when it is not
+// nil.
+func NewTaskViews(tasks []models.Task, loc *time.Location) []TaskView {
+	views := make([]TaskView, len(tasks))
+	for i, task := range tasks {
+		views[i] = NewTaskView(task)
+		if loc != nil {
+			views[i].StartDate = task.StartDate.In(loc)
+			views[i].EndDate = task.EndDate.In(loc)
+		}
+	}
+	return views
+}
+
+type PositionView struct {
+	ID            uuid.UUID          `json:"id"`
+	Name          string             `json:"name"`
+	Require2FA    bool               `json:"require_2fa"`
+	UserPositions []UserPositionView `json:"user_positions,omitempty"`
+}
+
+func NewPositionView(position models.Position) PositionView {
+	view := PositionView{
+		ID:         position.ID,
+		Name:       position.Name,
+		Require2FA: position.Require2FA,
+	}
+	for _, userPosition := range position.UserPositions {
+		view.UserPositions = append(view.UserPositions, NewUserPositionView(userPosition))
+	}
+	return view
+}
+
+func NewPositionViews(positions []models.Position) []PositionView {
+	views := make([]PositionView, len(positions))
+	for i, position := range positions {
+		views[i] = NewPositionView(position)
+	}
+	return views
+}
+
+type UserPositionView struct {
+	ID         uuid.UUID     `json:"id"`
+	UserID     uuid.UUID     `json:"user_id"`
+	PositionID uuid.UUID     `json:"position_id"`
+	User       *UserView     `json:"user,omitempty"`
+	Position   *PositionView `json:"position,omitempty"`
+}
+
+func NewUserPositionView(userPosition models.UserPosition) UserPositionView {
+	view := UserPositionView{
+		ID:         userPosition.ID,
+		UserID:     userPosition.UserID,
+		PositionID: userPosition.PositionID,
+		User:       loadedUserView(userPosition.User),
+	}
+	if userPosition.Position.ID != uuid.Nil {
+		position := NewPositionView(userPosition.Position)
+		view.Position = &position
+	}
+	return view
+}
+
+func NewUserPositionViews(userPositions []models.UserPosition) []UserPositionView {
+	views := make([]UserPositionView, len(userPositions))
+	for i, userPosition := range userPositions {
+		views[i] = NewUserPositionView(userPosition)
+	}
+	return views
+}
+
+type AccessTokenView struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	// Token is only populated in the creation response.
+	Token string `json:"token,omitempty"`
+}
+
+func NewAccessTokenView(token models.PersonalAccessToken) AccessTokenView {
+	return AccessTokenView{
+		ID:         token.ID,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     strings.Fields(token.Scopes),
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		RevokedAt:  token.RevokedAt,
+		CreatedAt:  token.CreatedAt,
+	}
+}
+
+// SessionView is a session as shown to its user or an administrator.
+// Current marks the session making the request. EndedAt only appears in
+// exports, since listings show active sessions.
+type SessionView struct {
+	ID             uuid.UUID  `json:"id"`
+	Device         string     `json:"device"`
+	UserAgent      string     `json:"user_agent"`
+	IP             string     `json:"ip"`
+	ImpersonatorID *uuid.UUID `json:"impersonator_id,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastSeenAt     time.Time  `json:"last_seen_at"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	EndedAt        *time.Time `json:"ended_at,omitempty"`
+	Current        bool       `json:"current"`
+}
+
+func NewSessionView(session models.Session) SessionView {
+	return SessionView{
+		ID:             session.ID,
+		Device:         session.Device,
+		UserAgent:      session.UserAgent,
+		IP:             session.IP,
+		ImpersonatorID: session.ImpersonatorID,
+		CreatedAt:      session.CreatedAt,
+		LastSeenAt:     session.LastSeenAt,
+		ExpiresAt:      session.ExpiresAt,
+		EndedAt:        session.EndedAt,
+	}
+}
+
+func NewSessionViews(sessions []models.Session) []SessionView {
+	views := make([]SessionView, len(sessions))
+	for i, session := range sessions {
+		views[i] = NewSessionView(session)
+	}
+	return views
+}
+
+// AuditLogView flattens the BSON documents stored in before/after into
+// plain JSON objects and redacts sensitive keys recorded by older releases.
+type AuditLogView struct {
+	ID             string                 `json:"id"`
+	UserID         string                 `json:"user_id"`
+	ImpersonatorID string                 `json:"impersonator_id,omitempty"`
+	Action         string                 `json:"action"`
+	Entity         string                 `json:"entity"`
+	EntityID       string                 `json:"entity_id"`
+	Timestamp      time.Time              `json:"timestamp"`
+	Before         map[string]interface{} `json:"before,omitempty"`
+	After          map[string]interface{} `json:"after,omitempty"`
+}
+
+func NewAuditLogView(log models.AuditLog) AuditLogView {
+	return AuditLogView{
+		ID:             log.ID.Hex(),
+		UserID:         log.UserID,
+		ImpersonatorID: log.ImpersonatorID,
+		Action:         log.Action,
+		Entity:         log.Entity,
+		EntityID:       log.EntityID,
+		Timestamp:      log.Timestamp,
+		Before:         auditDocument(log.Meta.Before),
+		After:          auditDocument(log.Meta.After),
+	}
+}
+
+func NewAuditLogViews(logs []models.AuditLog) []AuditLogView {
+	views := make([]AuditLogView, len(logs))
+	for i, log := range logs {
+		views[i] = NewAuditLogView(log)
+	}
+	return views
+}
+
+func auditDocument(value interface{}) map[string]interface{} {
+	doc, ok := services.PlainBSON(value).(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	return logging.RedactMap(doc)
+}
@@ -0,0 +1,25 @@
+// Package impersonation carries the administrator acting as a request's
+// user through its context, so services can attribute changes to them
+// without depending on the HTTP middleware that sets it.
+package impersonation
+
+import "context"
+
+type contextKey struct{}
+
+// WithImpersonator returns a copy of ctx naming impersonatorID as the
+// administrator acting as the request's user.
+func WithImpersonator(ctx context.Context, impersonatorID string) context.Context {
+	return context.WithValue(ctx, contextKey{}, impersonatorID)
+}
+
+// FromContext returns the ID of the administrator impersonating the
+// request's user, or "".
+func FromContext(ctx context.Context) string {
+	if ctx != nil {
+		if id, ok := ctx.Value(contextKey{}).(string); ok {
+			return id
+		}
+	}
+	return ""
+}
@@ -0,0 +1,211 @@
+// Package jwtkeys holds the keys used to sign and verify JWTs.
+//
+// Keys are loaded from PEM files and identified by kid. Each key has an
+// activation time: the signing key is the most recently activated one, keys
+// that activate later are published ahead of time so verifiers can cache
+// them, and a replaced key keeps verifying tokens for a grace period after
+// its successor activates. Rotation therefore happens on schedule without a
+// restart.
+package jwtkeys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Key is a single signing key.
+type Key struct {
+	ID          string
+	Method      jwt.SigningMethod
+	ActivatesAt time.Time
+
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeySet selects the signing key and the keys accepted for verification at
+// a point in time. It is immutable once built and safe for concurrent use.
+type KeySet struct {
+	keys  []*Key // sorted by ActivatesAt
+	grace time.Duration
+	now   func() time.Time
+}
+
+// NewHMAC returns a key set with a single HS256 shared secret, used when no
+// asymmetric keys are configured. Its tokens carry no kid and it publishes
+// no JWKS keys.
+func NewHMAC(secret string) *KeySet {
+	return &KeySet{
+		keys: []*Key{{Method: jwt.SigningMethodHS256, signKey: []byte(secret), verifyKey: []byte(secret)}},
+		now:  time.Now,
+	}
+}
+
+// Load reads the keys described by specs, each of the form
+// "kid=path/to/key.pem" or "kid=path/to/key.pem@2026-01-01T00:00:00Z" to
+// schedule its activation. RSA keys sign with RS256 and Ed25519 keys with
+// EdDSA.
+func Load(specs []string, grace time.Duration) (*KeySet, error) {
+	if len(specs) == 0 {
+		return nil, errors.New("no keys configured")
+	}
+
+	set := &KeySet{grace: grace, now: time.Now}
+	seen := make(map[string]bool)
+	for _, spec := range specs {
+		key, err := loadKey(spec)
+		if err != nil {
+			return nil, err
+		}
+		if seen[key.ID] {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		seen[key.ID] = true
+		set.keys = append(set.keys, key)
+	}
+	sort.SliceStable(set.keys, func(i, j int) bool {
+		return set.keys[i].ActivatesAt.Before(set.keys[j].ActivatesAt)
+	})
+
+	if set.current(set.now()) < 0 {
+		return nil, errors.New("no key is active yet")
+	}
+	return set, nil
+}
+
+func loadKey(spec string) (*Key, error) {
+	id, path, ok := strings.Cut(spec, "=")
+	if !ok || id == "" || path == "" {
+		return nil, fmt.Errorf("key %q must have the form kid=path[@activation]", spec)
+	}
+
+	key := &Key{ID: id}
+	if file, at, scheduled := strings.Cut(path, "@"); scheduled {
+		activatesAt, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: invalid activation time: %w", id, err)
+		}
+		path, key.ActivatesAt = file, activatesAt
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", id, err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("key %s: %s is not PEM encoded", id, path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		err = fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %w", id, err)
+	}
+
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		if private.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("key %s: RSA keys must be at least 2048 bits", id)
+		}
+		key.Method, key.signKey, key.verifyKey = jwt.SigningMethodRS256, private, &private.PublicKey
+	case ed25519.PrivateKey:
+		key.Method, key.signKey, key.verifyKey = jwt.SigningMethodEdDSA, private, private.Public()
+	default:
+		return nil, fmt.Errorf("key %s: only RSA and Ed25519 keys are supported", id)
+	}
+	return key, nil
+}
+
+// current returns the index of the key that signs at t, or -1.
+func (s *KeySet) current(t time.Time) int {
+	idx := -1
+	for i, key := range s.keys {
+		if !key.ActivatesAt.After(t) {
+			idx = i
+		}
+	}
+	return idx
+}
+
+// Verifying returns the keys that are accepted at t: the signing key, keys
+// scheduled to activate later, and replaced keys still within the grace
+// period.
+func (s *KeySet) Verifying(t time.Time) []*Key {
+	cur := s.current(t)
+	var keys []*Key
+	for i, key := range s.keys {
+		if i < cur && !s.keys[i+1].ActivatesAt.Add(s.grace).After(t) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Sign signs claims with the currently active key.
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	cur := s.current(s.now())
+	if cur < 0 {
+		return "", errors.New("no active signing key")
+	}
+	key := s.keys[cur]
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	return token.SignedString(key.signKey)
+}
+
+// Parse verifies tokenString against the keys accepted now and decodes it
+// into claims.
+func (s *KeySet) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, s.keyfunc, jwt.WithValidMethods(s.methods()))
+}
+
+func (s *KeySet) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	for _, key := range s.Verifying(s.now()) {
+		// Match on algorithm too so a key can never verify a token signed
+		// with a different method
+		if key.ID == kid && key.Method.Alg() == token.Method.Alg() {
+			return key.verifyKey, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (s *KeySet) methods() []string {
+	var methods []string
+	for _, key := range s.keys {
+		methods = append(methods, key.Method.Alg())
+	}
+	return methods
+}
+
+// PublicKey returns the key's public half, or nil for shared secrets.
+func (k *Key) PublicKey() crypto.PublicKey {
+	if _, ok := k.verifyKey.([]byte); ok {
+		return nil
+	}
+	return k.verifyKey
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"todo-apps/models"
+	"todo-apps/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TestTwoFactorFailuresSurviveRelogin checks that knowing the password does
+// not reset the count of wrong two-factor codes: only a completed login may.
+func TestTwoFactorFailuresSurviveRelogin(t *testing.T) {
+	t.Setenv("LOGIN_LOCKOUT_THRESHOLD", "3")
+	t.Setenv("LOGIN_DELAY_STEP", "0")
+	t.Setenv("LOGIN_RATE_USERNAME_LIMIT", "100")
+	s := newResponseScanner(t)
+	const password = "Correct-horse-42"
+
+	hash, err := (&utils.BcryptHasher{Cost: 4}).Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := models.User{Name: "Carol", Username: "carol", Password: hash, TOTPSecret: secret, TwoFactorEnabled: true}
+	if err := s.db.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var wrongCode string
+	for i := 0; ; i++ {
+		wrongCode = fmt.Sprintf("%06d", i)
+		if _, ok := utils.ValidateTOTP(secret, wrongCode, time.Now()); !ok {
+			break
+		}
+	}
+
+	login := func() string {
+		t.Helper()
+		var challenge struct {
+			ChallengeToken string `json:"challenge_token"`
+		}
+		s.expect(fiber.StatusOK, "POST", "/auth/login", map[string]string{
+			"username": "carol", "password": password,
+		}, &challenge)
+		if challenge.ChallengeToken == "" {
+			t.Fatal("login did not return a challenge token")
+		}
+		return challenge.ChallengeToken
+	}
+	verify := func(challenge string) int {
+		t.Helper()
+		return s.do("POST", "/auth/2fa/verify", map[string]string{
+			"challenge_token": challenge, "code": wrongCode,
+		}, nil)
+	}
+
+	// Two wrong codes, then a fresh challenge: the third wrong code must
+	// still reach the lockout threshold
+	challenge := login()
+	for i := 0; i < 2; i++ {
+		if got := verify(challenge); got != fiber.StatusUnauthorized {
+			t.Fatalf("wrong code %d: status %d, want 401", i+1, got)
+		}
+	}
+	challenge = login()
+	if got := verify(challenge); got != fiber.StatusUnauthorized {
+		t.Fatalf("wrong code 3: status %d, want 401", got)
+	}
+	if got := verify(challenge); got != fiber.StatusTooManyRequests {
+		t.Fatalf("after lockout: status %d, want 429", got)
+	}
+	if got := s.do("POST", "/auth/login", map[string]string{
+		"username": "carol", "password": password,
+	}, nil); got != fiber.StatusTooManyRequests {
+		t.Fatalf("login after lockout: status %d, want 429", got)
+	}
+}
+
+// TestForgotPasswordIsRateLimited checks that reset requests are throttled
+// per username without using up the login budget of that username.
+func TestForgotPasswordIsRateLimited(t *testing.T) {
+	t.Setenv("LOGIN_RATE_USERNAME_LIMIT", "2")
+	s := newResponseScanner(t)
+	const password = "Correct-horse-42"
+	s.expect(fiber.StatusCreated, "POST", "/auth/register", map[string]string{
+		"name": "Dave", "username": "dave", "password": password,
+	}, nil)
+
+	for i := 0; i < 2; i++ {
+		s.expect(fiber.StatusAccepted, "POST", "/auth/password/forgot", map[string]string{"username": "dave"}, nil)
+	}
+	s.expect(fiber.StatusTooManyRequests, "POST", "/auth/password/forgot", map[string]string{"username": "dave"}, nil)
+	s.expect(fiber.StatusOK, "POST", "/auth/login", map[string]string{
+		"username": "dave", "password": password,
+	}, nil)
+}
+
+// TestInvalidChallengeIssuesNoToken checks that a bad challenge token stops
+// the two-factor endpoints instead of falling through to a login.
+func TestInvalidChallengeIssuesNoToken(t *testing.T) {
+	s := newResponseScanner(t)
+	for _, path := range []string{"/auth/2fa/verify", "/auth/2fa/enroll", "/auth/2fa/enroll/confirm"} {
+		var resp map[string]interface{}
+		if got := s.do("POST", path, map[string]string{
+			"challenge_token": "invalid", "code": "123456",
+		}, &resp); got != fiber.StatusUnauthorized {
+			t.Errorf("%s: status %d, want 401", path, got)
+		}
+		if _, ok := resp["token"]; ok {
+			t.Errorf("%s returned a token", path)
+		}
+	}
+}
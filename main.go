@@ -1,131 +1,119 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"os"
+	_ "time/tzdata" // profile timezones must resolve on hosts without zoneinfo
 
 	"todo-apps/config"
-	"todo-apps/handlers"
-	"todo-apps/middleware"
+	"todo-apps/jwtkeys"
+	"todo-apps/logging"
+	"todo-apps/metrics"
 	"todo-apps/models"
-	"todo-apps/services"
-
-	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/gofiber/fiber/v2/middleware/recover"
-	"github.com/joho/godotenv"
+	"todo-apps/tracing"
+	"todo-apps/utils"
 )
 
 func main() {
-	// Load environment variables
-	if err := godotenv.Load(); err != nil {
-		log.Println("Warning: .env file not found, using default values")
+	// Load configuration from defaults, config file, .env and environment
+	cfg, err := config.Load()
+	if err != nil {
+		logging.Fatal("Invalid configuration", "error", err)
+	}
+
+	// Commands print their results to stdout, so their logs go to stderr
+	logOutput := os.Stdout
+	if len(os.Args) > 1 {
+		logOutput = os.Stderr
+	}
+	logging.SetupWriter(logOutput, cfg.Log.Level, cfg.Log.Format)
+	slog.Info("Configuration loaded", "config", cfg)
+
+	// Load JWT signing keys, falling back to the shared HS256 secret
+	cfg.JWT.KeySet = jwtkeys.NewHMAC(cfg.JWT.Secret)
+	if len(cfg.JWT.KeyFiles) > 0 {
+		cfg.JWT.KeySet, err = jwtkeys.Load(cfg.JWT.KeyFiles, cfg.JWT.KeyGrace)
+		if err != nil {
+			logging.Fatal("Failed to load JWT signing keys", "error", err)
+		}
 	}
 
 	// Initialize database connection
-	cfg := config.NewConfig()
+	cfg.Database, cfg.ReadDatabase = config.ConnectDB(cfg.Postgres)
 
 	// Enable UUID extension in PostgreSQL
-	err := cfg.Database.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\"").Error
+	err = cfg.Database.Exec("CREATE EXTENSION IF NOT EXISTS \"uuid-ossp\"").Error
 	if err != nil {
-		log.Println("Warning: Could not enable uuid-ossp extension:", err)
-		log.Println("UUIDs will be generated by the application instead of database")
+		slog.Warn("Could not enable uuid-ossp extension, UUIDs will be generated by the application instead of database", "error", err)
+	}
+
+	// Initialize tracing
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.Exporter, cfg.Tracing.ServiceName)
+	if err != nil {
+		logging.Fatal("Failed to initialize tracing", "error", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	if err := metrics.InstrumentGorm(cfg.Database, "postgres"); err != nil {
+		slog.Warn("Could not instrument database metrics", "error", err)
+	}
+	if err := tracing.InstrumentGorm(cfg.Database); err != nil {
+		slog.Warn("Could not instrument database tracing", "error", err)
+	}
+	if cfg.ReadDatabase != cfg.Database {
+		if err := metrics.InstrumentGorm(cfg.ReadDatabase, "postgres_replica"); err != nil {
+			slog.Warn("Could not instrument replica metrics", "error", err)
+		}
+		if err := tracing.InstrumentGorm(cfg.ReadDatabase); err != nil {
+			slog.Warn("Could not instrument replica tracing", "error", err)
+		}
 	}
 
 	// Initialize MongoDB connection
-	mongodb := config.NewMongoDB()
+	mongodb := config.NewMongoDB(cfg.Mongo, cfg.Audit.Required)
 	defer mongodb.Disconnect()
 
 	// Auto-migrate database schemas
-	err = cfg.Database.AutoMigrate(
-		&models.User{},
-		&models.Task{},
-		&models.Position{},
-		&models.UserPosition{},
-	)
+	err = models.Migrate(cfg.Database)
 	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+		logging.Fatal("Failed to migrate database", "error", err)
 	}
 
-	// Initialize services
-	auditService := services.NewAuditService(mongodb)
-
-	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(cfg)
-	userHandler := handlers.NewUserHandler(cfg, auditService)
-	taskHandler := handlers.NewTaskHandler(cfg, auditService)
-	positionHandler := handlers.NewPositionHandler(cfg, auditService)
-	userPositionHandler := handlers.NewUserPositionHandler(cfg, auditService)
-
-	// Initialize Fiber app
-	app := fiber.New(fiber.Config{
-		ErrorHandler: func(c *fiber.Ctx, err error) error {
-			code := fiber.StatusInternalServerError
-			if e, ok := err.(*fiber.Error); ok {
-				code = e.Code
-			}
-			return c.Status(code).JSON(fiber.Map{
-				"error": err.Error(),
-			})
-		},
-	})
-
-	// Middleware
-	app.Use(logger.New())
-	app.Use(recover.New())
-	app.Use(cors.New())
-
-	// Public routes
-	auth := app.Group("/auth")
-	auth.Post("/login", authHandler.Login)
-	auth.Post("/register", authHandler.Register)
-
-	// Protected routes
-	api := app.Group("/api")
-	api.Use(middleware.JWTMiddleware())
-
-	// User routes
-	users := api.Group("/users")
-	users.Get("/", userHandler.GetUsers)
-	users.Post("/", userHandler.CreateUser)
-	users.Put("/:id", userHandler.UpdateUser)
-	users.Delete("/:id", userHandler.DeleteUser)
-
-	// Task routes
-	tasks := api.Group("/tasks")
-	tasks.Get("/", taskHandler.GetTasks)
-	tasks.Post("/", taskHandler.CreateTask)
-	tasks.Put("/:id", taskHandler.UpdateTask)
-	tasks.Delete("/:id", taskHandler.DeleteTask)
-
-	// Position routes
-	positions := api.Group("/positions")
-	positions.Get("/", positionHandler.GetPositions)
-	positions.Post("/", positionHandler.CreatePosition)
-	positions.Put("/:id", positionHandler.UpdatePosition)
-	positions.Delete("/:id", positionHandler.DeletePosition)
-
-	// User Position routes
-	userPositions := api.Group("/user-positions")
-	userPositions.Get("/", userPositionHandler.GetUserPositions)
-	userPositions.Post("/", userPositionHandler.CreateUserPosition)
-	userPositions.Delete("/:id", userPositionHandler.DeleteUserPosition)
-
-	app.Get("/ping", func(c *fiber.Ctx) error {
-		return c.JSON(fiber.Map{
-			"status":  "ok",
-			"message": "server is running",
-		})
-	})
+	if len(os.Args) > 1 {
+		code := runCommand(cfg, mongodb, os.Args[1:])
+		mongodb.Disconnect()
+		shutdownTracing(context.Background())
+		os.Exit(code)
+	}
+
+	app, err := newApp(cfg, mongodb)
+	if err != nil {
+		logging.Fatal("Failed to initialize application", "error", err)
+	}
 
 	// Start server
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "3000"
+	slog.Info("Server starting", "port", cfg.Port)
+	if err := app.Listen(":" + cfg.Port); err != nil {
+		logging.Fatal("Server stopped", "error", err)
 	}
 
-	log.Printf("Server starting on port %s...", port)
-	log.Fatal(app.Listen(":" + port))
+}
 
+// newPasswordHasher prefers the configured algorithm and keeps the other one
+// available to verify existing hashes until they are rehashed.
+func newPasswordHasher(cfg config.PasswordConfig) *utils.PasswordHasher {
+	argon2id := &utils.Argon2idHasher{
+		Memory:      cfg.Argon2MemoryKiB,
+		Iterations:  cfg.Argon2Iterations,
+		Parallelism: cfg.Argon2Parallelism,
+		SaltLength:  16,
+		KeyLength:   32,
+	}
+	bcrypt := &utils.BcryptHasher{Cost: cfg.BcryptCost}
+
+	if cfg.HashAlgorithm == "bcrypt" {
+		return utils.NewPasswordHasher(bcrypt, argon2id)
+	}
+	return utils.NewPasswordHasher(argon2id, bcrypt)
 }
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+
+	"todo-apps/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// AdminOnly restricts a route to users holding one of adminPositions. It
+// must run after JWTMiddleware.
+func AdminOnly(db *gorm.DB, adminPositions []string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		userID, _ := c.Locals("user_id").(string)
+		if userID == "" {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Authentication required",
+			})
+		}
+
+		isAdmin, err := IsAdmin(c.UserContext(), db, userID, adminPositions)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to check permissions",
+			})
+		}
+		if !isAdmin {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Admin privileges required",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// IsAdmin reports whether userID holds one of adminPositions.
+func IsAdmin(ctx context.Context, db *gorm.DB, userID string, adminPositions []string) (bool, error) {
+	if len(adminPositions) == 0 {
+		return false, nil
+	}
+
+	var count int64
+	err := db.WithContext(ctx).Model(&models.UserPosition{}).
+		Joins("JOIN positions ON positions.id = user_positions.position_id").
+		Where("user_positions.user_id = ? AND positions.name IN ?", userID, adminPositions).
+		Count(&count).Error
+	return count > 0, err
+}
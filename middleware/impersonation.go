@@ -0,0 +1,42 @@
+package middleware
+
+import (
+	"todo-apps/impersonation"
+	"todo-apps/logging"
+	"todo-apps/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// ImpersonationHeader is set on every response to a request made with an
+// impersonation token and holds the administrator's user ID.
+const ImpersonationHeader = "X-Impersonated-By"
+
+// impersonate validates the actor of an impersonation token and marks the
+// request, its response, its logs and its context.
+func impersonate(c *fiber.Ctx, db *gorm.DB, actor *ActorClaims) error {
+	var admin models.User
+	err := db.WithContext(c.UserContext()).Select("token_version", "status").First(&admin, "id = ?", actor.UserID).Error
+	if err == gorm.ErrRecordNotFound || (err == nil && (admin.TokenVersion != actor.TokenVersion || admin.Status != models.UserStatusActive)) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Token has been revoked",
+		})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to validate token",
+		})
+	}
+
+	c.Locals("auth_method", AuthMethodImpersonation)
+	c.Locals("impersonator_id", actor.UserID)
+	c.Locals("impersonator_username", actor.Username)
+	c.Set(ImpersonationHeader, actor.UserID)
+
+	ctx := impersonation.WithImpersonator(c.UserContext(), actor.UserID)
+	logger := logging.FromContext(ctx).With("impersonator_id", actor.UserID)
+	c.SetUserContext(logging.WithLogger(ctx, logger))
+
+	return c.Next()
+}
@@ -1,20 +1,41 @@
 package middleware
 
 import (
-	"os"
 	"strings"
 
+	"todo-apps/jwtkeys"
+	"todo-apps/models"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
 )
 
 type JWTClaims struct {
 	UserID   string `json:"user_id"`
 	Username string `json:"username"`
+	// TokenVersion must match the user's current version; bumping it on
+	// password reset or change revokes every token issued before.
+	TokenVersion int `json:"ver"`
+	// Purpose marks restricted tokens, such as a pending two-factor
+	// challenge, that must not grant API access.
+	Purpose string `json:"purpose,omitempty"`
+	// Actor is set on impersonation tokens and names the administrator
+	// acting as the user.
+	Actor *ActorClaims `json:"act,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func JWTMiddleware() fiber.Handler {
+// ActorClaims identify the administrator behind an impersonation token.
+// TokenVersion is the administrator's, so revoking their sessions also
+// ends their impersonations.
+type ActorClaims struct {
+	UserID       string `json:"user_id"`
+	Username     string `json:"username"`
+	TokenVersion int    `json:"ver"`
+}
+
+func JWTMiddleware(keys *jwtkeys.KeySet, db *gorm.DB) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		authHeader := c.Get("Authorization")
 		if authHeader == "" {
@@ -32,11 +53,12 @@ func JWTMiddleware() fiber.Handler {
 		}
 
 		tokenString := tokenParts[1]
+		if strings.HasPrefix(tokenString, PATPrefix) {
+			return authenticatePAT(c, db, tokenString)
+		}
 
 		// Parse token
-		token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(getJWTSecret()), nil
-		})
+		token, err := keys.Parse(tokenString, &JWTClaims{})
 
 		if err != nil || !token.Valid {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -45,23 +67,53 @@ func JWTMiddleware() fiber.Handler {
 		}
 
 		// Extract claims
-		if claims, ok := token.Claims.(*JWTClaims); ok {
-			c.Locals("user_id", claims.UserID)
-			c.Locals("username", claims.Username)
-		} else {
+		claims, ok := token.Claims.(*JWTClaims)
+		if !ok || claims.Purpose != "" {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error": "Invalid token claims",
 			})
 		}
 
-		return c.Next()
-	}
-}
+		// Reject tokens revoked by a password change or issued to deleted users
+		var user models.User
+		err = db.WithContext(c.UserContext()).Select("token_version", "status").First(&user, "id = ?", claims.UserID).Error
+		if err == gorm.ErrRecordNotFound || (err == nil && user.TokenVersion != claims.TokenVersion) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "Token has been revoked",
+			})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"error": "Failed to validate token",
+			})
+		}
+
+		switch user.Status {
+		case models.UserStatusSuspended:
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Account is suspended",
+			})
+		case models.UserStatusDeactivated:
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "Account is deactivated",
+			})
+		}
 
-func getJWTSecret() string {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "your-secret-key" // Default secret for development
+		// Tokens issued before sessions were tracked carry no session ID and
+		// stay valid until they expire
+		if claims.ID != "" {
+			if ok, err := checkSession(c, db, claims.ID); !ok {
+				return err
+			}
+		}
+
+		c.Locals("user_id", claims.UserID)
+		c.Locals("username", claims.Username)
+		c.Locals("auth_method", AuthMethodSession)
+
+		if claims.Actor != nil {
+			return impersonate(c, db, claims.Actor)
+		}
+		return c.Next()
 	}
-	return secret
 }
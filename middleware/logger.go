@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"log/slog"
+	"time"
+
+	"todo-apps/logging"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequestLoggerMiddleware writes one structured access log line per request
+// using the request-scoped logger.
+func RequestLoggerMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			if fiberErr, ok := err.(*fiber.Error); ok {
+				status = fiberErr.Code
+			}
+		}
+
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		attrs := []any{
+			"method", c.Method(),
+			"path", c.Path(),
+			"route", c.Route().Path,
+			"status", status,
+			"duration", time.Since(start),
+			"ip", c.IP(),
+		}
+		if err != nil {
+			attrs = append(attrs, "error", err)
+		}
+		logging.FromContext(c.UserContext()).Log(c.UserContext(), level, "request completed", attrs...)
+
+		return err
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"todo-apps/metrics"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// MetricsMiddleware records request counts and latency labelled by the
+// matched route template (e.g. /api/tasks/:id) rather than the raw path.
+func MetricsMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			var fiberErr *fiber.Error
+			if errors.As(err, &fiberErr) {
+				status = fiberErr.Code
+			}
+		}
+
+		route := c.Route().Path
+		if status == fiber.StatusNotFound && route == "/" {
+			route = "unmatched"
+		}
+
+		labels := []string{c.Method(), route, strconv.Itoa(status)}
+		metrics.HTTPRequests.WithLabelValues(labels...).Inc()
+		metrics.HTTPDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"regexp"
+
+	"todo-apps/logging"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID restricts incoming IDs so clients can't inject arbitrary
+// content into our logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestIDMiddleware honours an incoming X-Request-ID or generates one,
+// echoes it on the response and injects a logger carrying it (and the trace
+// ID when tracing is enabled) into the request context.
+func RequestIDMiddleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		requestID := c.Get(RequestIDHeader)
+		if !validRequestID.MatchString(requestID) {
+			requestID = uuid.NewString()
+		}
+		c.Set(RequestIDHeader, requestID)
+		c.Locals("request_id", requestID)
+
+		ctx := c.UserContext()
+		logger := logging.FromContext(ctx).With("request_id", requestID)
+		if spanContext := trace.SpanContextFromContext(ctx); spanContext.HasTraceID() {
+			logger = logger.With("trace_id", spanContext.TraceID().String())
+		}
+		c.SetUserContext(logging.WithLogger(ctx, logger))
+
+		return c.Next()
+	}
+}
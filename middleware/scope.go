@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Personal access token scopes. Each resource has a read scope for GET
+// requests and a write scope for everything else; session tokens carry no
+// scope restriction.
+var AllScopes = []string{
+	"users:read", "users:write",
+	"tasks:read", "tasks:write",
+	"positions:read", "positions:write",
+	"user_positions:read", "user_positions:write",
+	"me:read", "me:write",
+	"admin", "scim",
+}
+
+func IsValidScope(scope string) bool {
+	return slices.Contains(AllScopes, scope)
+}
+
+// HasScope reports whether the authenticated request may use scope.
+func HasScope(c *fiber.Ctx, scope string) bool {
+	scopes, restricted := c.Locals("scopes").([]string)
+	return !restricted || slices.Contains(scopes, scope)
+}
+
+// RequireScope restricts a route group for scoped credentials, requiring
+// resource:read for safe methods and resource:write otherwise.
+func RequireScope(resource string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		scope := resource + ":write"
+		if c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead {
+			scope = resource + ":read"
+		}
+		return requireScope(c, scope)
+	}
+}
+
+// RequireExactScope restricts a route to credentials holding scope.
+func RequireExactScope(scope string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return requireScope(c, scope)
+	}
+}
+
+// SessionOnly rejects personal access tokens and impersonation, for routes
+// that manage the account itself such as passwords, 2FA and tokens.
+func SessionOnly() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Locals("auth_method") {
+		case AuthMethodPAT:
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "This endpoint requires an interactive login",
+			})
+		case AuthMethodImpersonation:
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "This endpoint is not available while impersonating",
+			})
+		}
+		return c.Next()
+	}
+}
+
+func requireScope(c *fiber.Ctx, scope string) error {
+	if !HasScope(c, scope) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"error":          "Token lacks the required scope",
+			"required_scope": scope,
+		})
+	}
+	return c.Next()
+}
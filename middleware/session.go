@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"time"
+
+	"todo-apps/logging"
+	"todo-apps/models"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// checkSession rejects a token whose session has ended and records the
+// session's activity, writing last_seen_at at most once per
+// lastUsedResolution.
+func checkSession(c *fiber.Ctx, db *gorm.DB, sessionID string) (bool, error) {
+	db = db.WithContext(c.UserContext())
+
+	var session models.Session
+	err := db.Select("id", "last_seen_at", "expires_at", "ended_at").First(&session, "id = ?", sessionID).Error
+	now := time.Now()
+	if err == gorm.ErrRecordNotFound || (err == nil && (session.EndedAt != nil || !now.Before(session.ExpiresAt))) {
+		return false, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "Session has ended",
+		})
+	}
+	if err != nil {
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "Failed to validate token",
+		})
+	}
+
+	if now.Sub(session.LastSeenAt) > lastUsedResolution {
+		if err := db.Model(&session).UpdateColumn("last_seen_at", now).Error; err != nil {
+			logging.FromContext(c.UserContext()).Warn("Failed to update session last seen", "session_id", session.ID, "error", err)
+		}
+	}
+
+	c.Locals("session_id", session.ID.String())
+	return true, nil
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// TimeoutMiddleware attaches a deadline to the request's user context. Handlers
+// pass that context to gorm and MongoDB, so slow statements are cancelled
+// instead of holding a pooled connection indefinitely.
+func TimeoutMiddleware(timeout time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if timeout <= 0 {
+			return c.Next()
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), timeout)
+		defer cancel()
+		c.SetUserContext(ctx)
+
+		err := c.Next()
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fiber.ErrRequestTimeout
+		}
+		return err
+	}
+}
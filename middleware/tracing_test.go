@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingMiddlewareContinuesIncomingTrace(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	provider := sdktrace.NewTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { provider.Shutdown(t.Context()) })
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	const parentID = "00f067aa0ba902b7"
+
+	var got trace.SpanContext
+	app := fiber.New()
+	app.Use(TracingMiddleware())
+	app.Get("/", func(c *fiber.Ctx) error {
+		got = trace.SpanContextFromContext(c.UserContext())
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	for _, header := range []string{"traceparent", "Traceparent", "TRACEPARENT"} {
+		t.Run(header, func(t *testing.T) {
+			got = trace.SpanContext{}
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set(header, "00-"+traceID+"-"+parentID+"-01")
+			if _, err := app.Test(req, -1); err != nil {
+				t.Fatal(err)
+			}
+			if got.TraceID().String() != traceID {
+				t.Errorf("trace ID = %s, want %s", got.TraceID(), traceID)
+			}
+			if got.SpanID().String() == parentID {
+				t.Error("handler span is the remote parent, want a child span")
+			}
+		})
+	}
+
+	t.Run("no header", func(t *testing.T) {
+		got = trace.SpanContext{}
+		if _, err := app.Test(httptest.NewRequest("GET", "/", nil), -1); err != nil {
+			t.Fatal(err)
+		}
+		if !got.IsValid() || got.TraceID().String() == traceID {
+			t.Errorf("trace ID = %s, want a new trace", got.TraceID())
+		}
+	})
+}
@@ -6,14 +6,27 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// AuditLog is one audit entry. Entries form a hash chain: Seq numbers them
+// from 1, PrevHash is the Hash of the previous entry and Hash covers this
+// entry's fields with user IDs pseudonymized and Meta reduced to MetaDigest,
+// so erasing a user can pseudonymize IDs and redact Meta without breaking
+// the chain. Entries written before the chain existed have no Seq.
+// ImpersonatorID is set when an administrator acted as UserID.
 type AuditLog struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-	UserID    string             `bson:"user_id" json:"user_id"`
-	Action    string             `bson:"action" json:"action"` // CREATE, UPDATE, DELETE
-	Entity    string             `bson:"entity" json:"entity"` // users, tasks, positions, user_positions
-	EntityID  string             `bson:"entity_id" json:"entity_id"`
-	Timestamp time.Time          `bson:"timestamp" json:"timestamp"`
-	Meta      AuditMeta          `bson:"meta" json:"meta"`
+	ID             primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Seq            int64              `bson:"seq,omitempty" json:"seq,omitempty"`
+	UserID         string             `bson:"user_id" json:"user_id"`
+	ImpersonatorID string             `bson:"impersonator_id,omitempty" json:"impersonator_id,omitempty"`
+	Action         string             `bson:"action" json:"action"` // CREATE, UPDATE, DELETE
+	Entity         string             `bson:"entity" json:"entity"` // users, tasks, positions, user_positions
+	EntityID       string             `bson:"entity_id" json:"entity_id"`
+	Timestamp      time.Time          `bson:"timestamp" json:"timestamp"`
+	Meta           AuditMeta          `bson:"meta" json:"meta"`
+	MetaDigest     string             `bson:"meta_digest,omitempty" json:"meta_digest,omitempty"`
+	// Redacted is set once Meta has been removed by an erasure.
+	Redacted bool   `bson:"redacted,omitempty" json:"redacted,omitempty"`
+	PrevHash string `bson:"prev_hash,omitempty" json:"prev_hash,omitempty"`
+	Hash     string `bson:"hash,omitempty" json:"hash,omitempty"`
 }
 
 type AuditMeta struct {
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SchemaVersion is the schema version this build expects. Bump it whenever a
+// model is added or changed so readiness checks can detect a stale database.
+const SchemaVersion = 10
+
+type SchemaMigration struct {
+	Version   int       `json:"version" gorm:"primary_key;autoIncrement:false"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// Migrate auto-migrates every model and records SchemaVersion.
+func Migrate(db *gorm.DB) error {
+	err := db.AutoMigrate(
+		&SchemaMigration{},
+		&User{},
+		&Task{},
+		&Position{},
+		&UserPosition{},
+		&PasswordHistory{},
+		&PasswordResetToken{},
+		&RecoveryCode{},
+		&PersonalAccessToken{},
+		&UserIdentity{},
+		&VerificationToken{},
+		&Session{},
+	)
+	if err != nil {
+		return err
+	}
+
+	return db.Where(SchemaMigration{Version: SchemaVersion}).
+		Attrs(SchemaMigration{AppliedAt: time.Now()}).
+		FirstOrCreate(&SchemaMigration{}).Error
+}
+
+// CurrentSchemaVersion returns the highest schema version applied to db.
+func CurrentSchemaVersion(db *gorm.DB) (int, error) {
+	var version int
+	err := db.Model(&SchemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
@@ -7,11 +7,48 @@ import (
 	"gorm.io/gorm"
 )
 
+// User account statuses. Suspended users cannot log in and their existing
+// tokens stop working. Pending users were invited or registered but haven't
+// accepted the invitation or verified their email address yet.
+const (
+	UserStatusActive    = "active"
+	UserStatusSuspended = "suspended"
+	UserStatusPending   = "pending"
+	// UserStatusDeactivated replaces deletion for users who leave; their
+	// history stays attached to the account.
+	UserStatusDeactivated = "deactivated"
+)
+
 type User struct {
 	ID       uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
 	Name     string    `json:"name" gorm:"not null"`
 	Username string    `json:"username" gorm:"unique;not null"`
-	Password string    `json:"password,omitempty" gorm:"column:password;not null"`
+	// Email is stored normalized (trimmed, lower case) so the unique index
+	// is case-insensitive. It is optional for accounts created before it
+	// existed.
+	Email           *string    `json:"email" gorm:"uniqueIndex"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// Password holds the hash and is never serialized; handlers respond with
+	// view models and accept plaintext passwords through request structs.
+	Password string `json:"-" gorm:"column:password;not null"`
+	// TokenVersion is embedded in issued JWTs; incrementing it revokes them.
+	TokenVersion int `json:"-" gorm:"not null;default:0"`
+	// Two-factor authentication. TOTPSecret is set at enrollment and only
+	// takes effect once TwoFactorEnabled is confirmed with a valid code.
+	TwoFactorEnabled bool   `json:"two_factor_enabled" gorm:"not null;default:false"`
+	TOTPSecret       string `json:"-" gorm:"column:totp_secret"`
+	TOTPLastCounter  int64  `json:"-" gorm:"column:totp_last_counter;not null;default:0"`
+	// Display settings. Timezone is an IANA name and Locale a BCP 47 tag.
+	Timezone    string     `json:"timezone" gorm:"not null;default:'UTC'"`
+	Locale      string     `json:"locale" gorm:"not null;default:'en'"`
+	AvatarURL   string     `json:"avatar_url"`
+	Preferences JSONB      `json:"preferences" gorm:"type:jsonb;not null;default:'{}'"`
+	Status      string     `json:"status" gorm:"not null;default:'active';index"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	// DeactivatedAt is set while Status is deactivated.
+	DeactivatedAt *time.Time `json:"deactivated_at"`
 }
 
 type Task struct {
@@ -25,6 +62,10 @@ type Task struct {
 type Position struct {
 	ID   uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
 	Name string    `json:"name" gorm:"unique;not null"`
+	// Require2FA forces holders of this position to use two-factor login.
+	// Only admins may change it.
+	Require2FA    bool           `json:"require_2fa" gorm:"column:require_2fa;not null;default:false"`
+	UserPositions []UserPosition `json:"user_positions,omitempty" gorm:"foreignKey:PositionID"`
 }
 
 type UserPosition struct {
@@ -40,6 +81,18 @@ func (u *User) BeforeCreate(tx *gorm.DB) error {
 	if u.ID == uuid.Nil {
 		u.ID = uuid.New()
 	}
+	if u.Status == "" {
+		u.Status = UserStatusActive
+	}
+	if u.Timezone == "" {
+		u.Timezone = "UTC"
+	}
+	if u.Locale == "" {
+		u.Locale = "en"
+	}
+	if u.Preferences == nil {
+		u.Preferences = JSONB{}
+	}
 	return nil
 }
 
@@ -63,3 +116,146 @@ func (up *UserPosition) BeforeCreate(tx *gorm.DB) error {
 	}
 	return nil
 }
+
+// PasswordHistory keeps previous password hashes so they can't be reused.
+type PasswordHistory struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
+	Hash      string    `json:"-" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (ph *PasswordHistory) BeforeCreate(tx *gorm.DB) error {
+	if ph.ID == uuid.Nil {
+		ph.ID = uuid.New()
+	}
+	return nil
+}
+
+// PasswordResetToken is a single-use reset link. Only the SHA-256 hash of the
+// token is stored.
+type PasswordResetToken struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primary_key"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (t *PasswordResetToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// RecoveryCode is a one-time 2FA backup code, stored hashed.
+type RecoveryCode struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primary_key"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	CodeHash  string     `json:"-" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (rc *RecoveryCode) BeforeCreate(tx *gorm.DB) error {
+	if rc.ID == uuid.Nil {
+		rc.ID = uuid.New()
+	}
+	return nil
+}
+
+// PersonalAccessToken is a named, scoped API credential for automation.
+// Only the SHA-256 hash of the token is stored; Prefix identifies it in
+// listings.
+type PersonalAccessToken struct {
+	ID         uuid.UUID  `json:"id" gorm:"type:uuid;primary_key"`
+	UserID     uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	Name       string     `json:"name" gorm:"not null"`
+	Prefix     string     `json:"prefix" gorm:"not null"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex;not null"`
+	Scopes     string     `json:"-" gorm:"not null"` // space-separated
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"not null"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+func (t *PersonalAccessToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// UserIdentity links a user to an account at an external identity provider,
+// keyed by the provider's issuer and subject.
+type UserIdentity struct {
+	ID        uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
+	UserID    uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
+	Issuer    string    `json:"issuer" gorm:"not null;uniqueIndex:idx_user_identities_issuer_subject"`
+	Subject   string    `json:"subject" gorm:"not null;uniqueIndex:idx_user_identities_issuer_subject"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (ui *UserIdentity) BeforeCreate(tx *gorm.DB) error {
+	if ui.ID == uuid.Nil {
+		ui.ID = uuid.New()
+	}
+	return nil
+}
+
+// Verification token purposes.
+const (
+	TokenPurposeInvite      = "invite"
+	TokenPurposeVerifyEmail = "verify_email"
+)
+
+// VerificationToken is a single-use link emailed to a user, either to accept
+// an invitation or to verify an email address. Only the SHA-256 hash of the
+// token is stored. Email is the address the link was sent to; the token is
+// void once the user's address changes.
+type VerificationToken struct {
+	ID        uuid.UUID  `json:"id" gorm:"type:uuid;primary_key"`
+	UserID    uuid.UUID  `json:"user_id" gorm:"type:uuid;not null;index"`
+	Purpose   string     `json:"purpose" gorm:"not null"`
+	Email     string     `json:"email" gorm:"not null"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (t *VerificationToken) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+// Session is one login on one device. Its ID is the jti of the JWT issued
+// for it, so ending the session rejects that token. A session is also over
+// once the user's token version moves past TokenVersion, for example after
+// a password change.
+type Session struct {
+	ID           uuid.UUID `json:"id" gorm:"type:uuid;primary_key"`
+	UserID       uuid.UUID `json:"user_id" gorm:"type:uuid;not null;index"`
+	TokenVersion int       `json:"-" gorm:"not null"`
+	// ImpersonatorID is the administrator acting as the user, if any.
+	ImpersonatorID *uuid.UUID `json:"impersonator_id" gorm:"type:uuid"`
+	Device         string     `json:"device" gorm:"not null"`
+	UserAgent      string     `json:"user_agent" gorm:"not null"`
+	IP             string     `json:"ip" gorm:"column:ip;not null"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastSeenAt     time.Time  `json:"last_seen_at" gorm:"not null"`
+	ExpiresAt      time.Time  `json:"expires_at" gorm:"not null"`
+	EndedAt        *time.Time `json:"ended_at"`
+}
+
+func (s *Session) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
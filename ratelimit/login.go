@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+type LoginLimiterConfig struct {
+	Window           time.Duration
+	IPLimit          int
+	UsernameLimit    int
+	FailureWindow    time.Duration
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	DelayStep        time.Duration
+	MaxDelay         time.Duration
+}
+
+// LoginLimiter throttles login attempts per client IP and per username,
+// slows down repeated failures and temporarily locks accounts that keep
+// failing.
+type LoginLimiter struct {
+	store Store
+	cfg   LoginLimiterConfig
+}
+
+// Decision is the outcome of LoginLimiter.Allow.
+type Decision struct {
+	Allowed    bool
+	Locked     bool
+	RetryAfter time.Duration
+	// Delay is applied before answering so failures become progressively
+	// more expensive to brute force.
+	Delay time.Duration
+}
+
+func NewLoginLimiter(store Store, cfg LoginLimiterConfig) *LoginLimiter {
+	return &LoginLimiter{store: store, cfg: cfg}
+}
+
+// Allow records an attempt and decides whether it may proceed.
+func (l *LoginLimiter) Allow(ctx context.Context, ip, username string) (Decision, error) {
+	username = normalizeUsername(username)
+
+	lockTTL, err := l.store.LockTTL(ctx, failuresKey(username))
+	if err != nil {
+		return Decision{}, err
+	}
+	if lockTTL > 0 {
+		return Decision{Locked: true, RetryAfter: lockTTL}, nil
+	}
+
+	if decision, err := l.throttle(ctx, "login", ip, username); err != nil || !decision.Allowed {
+		return decision, err
+	}
+
+	failures, err := l.store.Count(ctx, failuresKey(username), l.cfg.FailureWindow)
+	if err != nil {
+		return Decision{}, err
+	}
+	return Decision{Allowed: true, Delay: l.delay(failures)}, nil
+}
+
+// AllowReset records a password reset request and decides whether it may
+// proceed. Reset requests share the login limits but are counted apart, so
+// requesting links for someone cannot lock them out of logging in.
+func (l *LoginLimiter) AllowReset(ctx context.Context, ip, username string) (Decision, error) {
+	return l.throttle(ctx, "reset", ip, normalizeUsername(username))
+}
+
+// throttle counts a request against the per-IP and per-username limits of
+// the given kind.
+func (l *LoginLimiter) throttle(ctx context.Context, kind, ip, username string) (Decision, error) {
+	for _, limit := range []struct {
+		key   string
+		limit int
+	}{
+		{kind + ":ip:" + ip, l.cfg.IPLimit},
+		{kind + ":user:" + username, l.cfg.UsernameLimit},
+	} {
+		if limit.limit <= 0 {
+			continue
+		}
+		count, oldest, err := l.store.Hit(ctx, limit.key, l.cfg.Window)
+		if err != nil {
+			return Decision{}, err
+		}
+		if count > limit.limit {
+			return Decision{RetryAfter: time.Until(oldest.Add(l.cfg.Window))}, nil
+		}
+	}
+	return Decision{Allowed: true}, nil
+}
+
+// RecordFailure counts a failed password check and locks the username once
+// the threshold is reached.
+func (l *LoginLimiter) RecordFailure(ctx context.Context, username string) error {
+	key := failuresKey(normalizeUsername(username))
+	count, _, err := l.store.Hit(ctx, key, l.cfg.FailureWindow)
+	if err != nil {
+		return err
+	}
+	if l.cfg.LockoutThreshold > 0 && count >= l.cfg.LockoutThreshold {
+		return l.store.Lock(ctx, key, l.cfg.LockoutDuration)
+	}
+	return nil
+}
+
+// RecordSuccess clears the failure history for username.
+func (l *LoginLimiter) RecordSuccess(ctx context.Context, username string) error {
+	return l.store.Reset(ctx, failuresKey(normalizeUsername(username)))
+}
+
+// Unlock lifts a lockout and clears the failure history for username.
+func (l *LoginLimiter) Unlock(ctx context.Context, username string) error {
+	return l.RecordSuccess(ctx, username)
+}
+
+func (l *LoginLimiter) delay(failures int) time.Duration {
+	if failures <= 0 || l.cfg.DelayStep <= 0 {
+		return 0
+	}
+	return min(time.Duration(failures)*l.cfg.DelayStep, l.cfg.MaxDelay)
+}
+
+func failuresKey(username string) string {
+	return "login:fail:" + username
+}
+
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often MemoryStore drops keys nobody touches again,
+// such as the counters of a one-off IP address.
+const sweepInterval = time.Minute
+
+// MemoryStore is an in-process Store. Counters are not shared between
+// replicas, so use RedisStore when running more than one instance.
+type MemoryStore struct {
+	mu     sync.Mutex
+	events map[string][]time.Time
+	locks  map[string]time.Time
+	// windows holds the window each key was last counted with, so the
+	// sweep knows when its events have expired.
+	windows map[string]time.Duration
+}
+
+func NewMemoryStore() *MemoryStore {
+	s := &MemoryStore{
+		events:  map[string][]time.Time{},
+		locks:   map[string]time.Time{},
+		windows: map[string]time.Duration{},
+	}
+	go func() {
+		for now := range time.Tick(sweepInterval) {
+			s.sweep(now)
+		}
+	}()
+	return s
+}
+
+func (s *MemoryStore) Hit(ctx context.Context, key string, window time.Duration) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	events := append(s.prune(key, now, window), now)
+	s.events[key] = events
+	s.windows[key] = window
+	return len(events), events[0], nil
+}
+
+func (s *MemoryStore) Count(ctx context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.prune(key, time.Now(), window)), nil
+}
+
+func (s *MemoryStore) Lock(ctx context.Context, key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.locks[key] = time.Now().Add(ttl)
+	return nil
+}
+
+func (s *MemoryStore) LockTTL(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.locks[key]
+	if !ok {
+		return 0, nil
+	}
+	remaining := time.Until(until)
+	if remaining <= 0 {
+		delete(s.locks, key)
+		return 0, nil
+	}
+	return remaining, nil
+}
+
+func (s *MemoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.events, key)
+	delete(s.windows, key)
+	delete(s.locks, key)
+	return nil
+}
+
+// sweep drops expired events and locks of every key.
+func (s *MemoryStore) sweep(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key := range s.events {
+		s.prune(key, now, s.windows[key])
+	}
+	for key, until := range s.locks {
+		if !until.After(now) {
+			delete(s.locks, key)
+		}
+	}
+}
+
+// prune drops events older than window and must be called with mu held.
+func (s *MemoryStore) prune(key string, now time.Time, window time.Duration) []time.Time {
+	events := s.events[key]
+	cutoff := now.Add(-window)
+	i := 0
+	for i < len(events) && !events[i].After(cutoff) {
+		i++
+	}
+	events = events[i:]
+	if len(events) == 0 {
+		delete(s.events, key)
+		delete(s.windows, key)
+		return nil
+	}
+	s.events[key] = events
+	return events
+}
@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisStore keeps counters in sorted sets so every replica shares them. It
+// works against any server speaking the Redis protocol.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+func NewRedisStore(client *redis.Client, prefix string) *RedisStore {
+	return &RedisStore{client: client, prefix: prefix}
+}
+
+func (s *RedisStore) Hit(ctx context.Context, key string, window time.Duration) (int, time.Time, error) {
+	now := time.Now()
+	key = s.eventsKey(key)
+
+	pipe := s.client.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.Add(-window).UnixNano(), 10))
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.UnixNano()), Member: uuid.NewString()})
+	count := pipe.ZCard(ctx, key)
+	oldest := pipe.ZRangeWithScores(ctx, key, 0, 0)
+	pipe.PExpire(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, time.Time{}, err
+	}
+
+	oldestAt := now
+	if first := oldest.Val(); len(first) > 0 {
+		oldestAt = time.Unix(0, int64(first[0].Score))
+	}
+	return int(count.Val()), oldestAt, nil
+}
+
+func (s *RedisStore) Count(ctx context.Context, key string, window time.Duration) (int, error) {
+	min := strconv.FormatInt(time.Now().Add(-window).UnixNano(), 10)
+	count, err := s.client.ZCount(ctx, s.eventsKey(key), "("+min, "+inf").Result()
+	return int(count), err
+}
+
+func (s *RedisStore) Lock(ctx context.Context, key string, ttl time.Duration) error {
+	return s.client.Set(ctx, s.lockKey(key), 1, ttl).Err()
+}
+
+func (s *RedisStore) LockTTL(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := s.client.PTTL(ctx, s.lockKey(key)).Result()
+	if err != nil || ttl < 0 {
+		// Negative values mean the key is missing or has no expiry
+		return 0, err
+	}
+	return ttl, nil
+}
+
+func (s *RedisStore) Reset(ctx context.Context, key string) error {
+	return s.client.Del(ctx, s.eventsKey(key), s.lockKey(key)).Err()
+}
+
+func (s *RedisStore) eventsKey(key string) string {
+	return s.prefix + key
+}
+
+func (s *RedisStore) lockKey(key string) string {
+	return s.prefix + "lock:" + key
+}
@@ -0,0 +1,23 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Store keeps sliding-window counters and temporary locks. Implementations
+// must be safe for concurrent use.
+type Store interface {
+	// Hit records an event for key and returns how many events fall within
+	// the trailing window, including this one, and the time of the oldest.
+	Hit(ctx context.Context, key string, window time.Duration) (count int, oldest time.Time, err error)
+	// Count returns the number of events for key within the trailing window
+	// without recording a new one.
+	Count(ctx context.Context, key string, window time.Duration) (int, error)
+	// Lock marks key as locked for ttl.
+	Lock(ctx context.Context, key string, ttl time.Duration) error
+	// LockTTL returns the remaining lock time for key, or zero if unlocked.
+	LockTTL(ctx context.Context, key string) (time.Duration, error)
+	// Reset clears both the counter and any lock held on key.
+	Reset(ctx context.Context, key string) error
+}
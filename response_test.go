@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"todo-apps/config"
+	"todo-apps/jwtkeys"
+	"todo-apps/models"
+	"todo-apps/utils"
+
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// hashPatterns match the password hash encodings the service produces.
+var hashPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`\$2[abxy]?\$\d{2}\$[./A-Za-z0-9]{53}`),
+	regexp.MustCompile(`\$argon2(id|i|d)\$`),
+}
+
+// responseScanner drives the real router against a SQLite database and
+// fails the test if any response contains a password hash or another stored
+// secret.
+type responseScanner struct {
+	t     *testing.T
+	app   *fiber.App
+	db    *gorm.DB
+	token string
+}
+
+func newResponseScanner(t *testing.T) *responseScanner {
+	t.Helper()
+	t.Setenv("DB_HOST", "localhost")
+	t.Setenv("DB_USER", "test")
+	t.Setenv("DB_NAME", "test")
+	t.Setenv("LOG_LEVEL", "error")
+	t.Setenv("ARGON2_MEMORY_KIB", "1024")
+	t.Setenv("ARGON2_ITERATIONS", "1")
+	t.Setenv("MONGO_URI", "mongodb://127.0.0.1:1")
+	t.Setenv("MONGO_CONNECT_RETRIES", "0")
+	t.Setenv("MONGO_CONNECT_TIMEOUT", "100ms")
+	t.Setenv("MONGO_SERVER_SELECTION_TIMEOUT", "50ms")
+	t.Setenv("REGISTRATION_VERIFY_EMAIL", "false")
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")), &gorm.Config{
+		Logger: logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Database, cfg.ReadDatabase = db, db
+	cfg.JWT.KeySet = jwtkeys.NewHMAC(cfg.JWT.Secret)
+
+	mongodb := config.NewMongoDB(cfg.Mongo, false)
+	t.Cleanup(func() { mongodb.Disconnect() })
+
+	app, err := newApp(cfg, mongodb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &responseScanner{t: t, app: app, db: db}
+}
+
+// do sends a request, scans the response and decodes it into out when set.
+func (s *responseScanner) do(method, path string, body interface{}, out interface{}) int {
+	s.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			s.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, reader)
+	req.Header.Set("Content-Type", "application/json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.app.Test(req, -1)
+	if err != nil {
+		s.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+
+	s.scan(method+" "+path, string(data))
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			s.t.Fatalf("%s %s: decode %q: %v", method, path, data, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func (s *responseScanner) scan(request, body string) {
+	s.t.Helper()
+
+	for _, pattern := range hashPatterns {
+		if match := pattern.FindString(body); match != "" {
+			s.t.Errorf("%s leaked a password hash: %s", request, match)
+		}
+	}
+
+	// Also look for the exact stored secrets, whatever their encoding
+	var users []models.User
+	s.db.Find(&users)
+	for _, user := range users {
+		for _, secret := range []string{user.Password, user.TOTPSecret} {
+			if secret != "" && strings.Contains(body, secret) {
+				s.t.Errorf("%s leaked a stored secret of user %s", request, user.Username)
+			}
+		}
+	}
+	var tokens []models.PersonalAccessToken
+	s.db.Find(&tokens)
+	for _, token := range tokens {
+		if strings.Contains(body, token.TokenHash) {
+			s.t.Errorf("%s leaked the hash of token %s", request, token.Name)
+		}
+	}
+}
+
+func (s *responseScanner) expect(status int, method, path string, body interface{}, out interface{}) {
+	s.t.Helper()
+	if got := s.do(method, path, body, out); got != status {
+		s.t.Fatalf("%s %s: status %d, want %d", method, path, got, status)
+	}
+}
+
+type dataResponse struct {
+	Data struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+func TestResponsesNeverContainPasswordHashes(t *testing.T) {
+	s := newResponseScanner(t)
+	const password = "Correct-horse-42"
+
+	// One user registered through the API (argon2id) and one legacy user
+	// with a bcrypt hash
+	s.expect(fiber.StatusCreated, "POST", "/auth/register", map[string]string{
+		"name": "Alice", "username": "alice", "password": password,
+	}, nil)
+	legacyHash, err := (&utils.BcryptHasher{Cost: 4}).Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob := models.User{Name: "Bob", Username: "bob", Password: legacyHash, TOTPSecret: "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"}
+	if err := s.db.Create(&bob).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	s.expect(fiber.StatusOK, "POST", "/auth/login", map[string]string{
+		"username": "alice", "password": password,
+	}, &login)
+	s.token = login.Token
+
+	// Positions can only be written by admins
+	var alice models.User
+	s.db.Where("username = ?", "alice").First(&alice)
+	admin := models.Position{Name: "Admin"}
+	if err := s.db.Create(&admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.Create(&models.UserPosition{UserID: alice.ID, PositionID: admin.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Create one of everything so list endpoints and preloads have data
+	var position dataResponse
+	s.expect(fiber.StatusCreated, "POST", "/api/positions", map[string]string{"name": "Engineer"}, &position)
+	s.expect(fiber.StatusCreated, "POST", "/api/user-positions", map[string]string{
+		"user_id": bob.ID.String(), "position_id": position.Data.ID,
+	}, nil)
+	s.expect(fiber.StatusCreated, "POST", "/api/tasks", map[string]string{
+		"user_id": bob.ID.String(), "todo": "Review",
+	}, nil)
+	s.expect(fiber.StatusOK, "PUT", "/api/users/"+bob.ID.String(), map[string]string{"name": "Robert"}, nil)
+	s.expect(fiber.StatusOK, "PATCH", "/api/me", map[string]string{"name": "Alice A."}, nil)
+	s.expect(fiber.StatusCreated, "POST", "/api/me/tokens", map[string]interface{}{
+		"name": "ci", "scopes": []string{"tasks:read"},
+	}, nil)
+
+	// Every GET route, with path parameters pointing at the legacy user
+	ids := strings.NewReplacer(":id", bob.ID.String())
+	statuses := map[string]int{}
+	for _, route := range s.app.GetRoutes(true) {
+		if route.Method != fiber.MethodGet {
+			continue
+		}
+		path := ids.Replace(route.Path)
+		statuses[path] = s.do("GET", path, nil, nil)
+	}
+
+	// The endpoints that preload users must have actually returned data
+	for _, path := range []string{"/api/users/", "/api/tasks/", "/api/positions/", "/api/user-positions/", "/api/me/"} {
+		if statuses[path] != fiber.StatusOK {
+			t.Errorf("GET %s: status %d, want 200", path, statuses[path])
+		}
+	}
+}
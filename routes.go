@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+
+	"todo-apps/config"
+	"todo-apps/handlers"
+	"todo-apps/metrics"
+	"todo-apps/middleware"
+	"todo-apps/ratelimit"
+	"todo-apps/services"
+	"todo-apps/utils"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+)
+
+// newApp builds the services and handlers and registers every route.
+// Connections, migrations and signing keys must already be set up in cfg.
+func newApp(cfg *config.Config, mongodb *config.MongoDB) (*fiber.App, error) {
+	// Initialize services
+	auditService := services.NewAuditService(mongodb, cfg.Audit)
+
+	utils.SetPasswordHasher(newPasswordHasher(cfg.Password))
+	passwordService, err := services.NewPasswordService(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("initialize password policy: %w", err)
+	}
+
+	notifier, err := services.NewNotifier(cfg.Notifier)
+	if err != nil {
+		return nil, fmt.Errorf("initialize notifier: %w", err)
+	}
+
+	onboardingService := services.NewOnboardingService(cfg, notifier)
+	deactivationService := services.NewDeactivationService(cfg, auditService)
+	importService := services.NewImportService(cfg, passwordService, onboardingService, auditService)
+
+	// Initialize login rate limiting
+	var limiterStore ratelimit.Store = ratelimit.NewMemoryStore()
+	if cfg.RateLimit.Store == "redis" {
+		limiterStore = ratelimit.NewRedisStore(config.NewRedis(cfg.Redis), "todo-apps:")
+	}
+	loginLimiter := ratelimit.NewLoginLimiter(limiterStore, ratelimit.LoginLimiterConfig{
+		Window:           cfg.RateLimit.Window,
+		IPLimit:          cfg.RateLimit.IPLimit,
+		UsernameLimit:    cfg.RateLimit.UsernameLimit,
+		FailureWindow:    cfg.RateLimit.FailureWindow,
+		LockoutThreshold: cfg.RateLimit.LockoutThreshold,
+		LockoutDuration:  cfg.RateLimit.LockoutDuration,
+		DelayStep:        cfg.RateLimit.DelayStep,
+		MaxDelay:         cfg.RateLimit.MaxDelay,
+	})
+
+	// Initialize handlers
+	authHandler := handlers.NewAuthHandler(cfg, loginLimiter, passwordService, onboardingService)
+	userHandler := handlers.NewUserHandler(cfg, auditService, passwordService, deactivationService)
+	taskHandler := handlers.NewTaskHandler(cfg, auditService)
+	positionHandler := handlers.NewPositionHandler(cfg, auditService)
+	userPositionHandler := handlers.NewUserPositionHandler(cfg, auditService)
+	healthHandler := handlers.NewHealthHandler(cfg, mongodb)
+	adminHandler := handlers.NewAdminHandler(cfg, loginLimiter, auditService)
+	passwordHandler := handlers.NewPasswordHandler(cfg, loginLimiter, passwordService, notifier, auditService)
+	twoFactorHandler := handlers.NewTwoFactorHandler(cfg, loginLimiter, auditService)
+	accessTokenHandler := handlers.NewAccessTokenHandler(cfg, auditService)
+	jwksHandler := handlers.NewJWKSHandler(cfg)
+	meHandler := handlers.NewMeHandler(cfg, auditService)
+	onboardingHandler := handlers.NewOnboardingHandler(cfg, passwordService, onboardingService, auditService)
+	importHandler := handlers.NewImportHandler(cfg, importService)
+	privacyHandler := handlers.NewPrivacyHandler(cfg, auditService)
+	impersonationHandler := handlers.NewImpersonationHandler(cfg, auditService)
+	sessionHandler := handlers.NewSessionHandler(cfg, auditService)
+	scimHandler := handlers.NewSCIMHandler(cfg, passwordService, auditService, deactivationService)
+	oidcHandler := handlers.NewOIDCHandler(cfg, services.NewOIDCService(cfg), auditService)
+
+	// Initialize Fiber app
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			code := fiber.StatusInternalServerError
+			if e, ok := err.(*fiber.Error); ok {
+				code = e.Code
+			}
+			return c.Status(code).JSON(fiber.Map{
+				"error": err.Error(),
+			})
+		},
+	})
+
+	// Health and metrics routes are registered before the middleware so probes don't flood access logs
+	app.Get("/healthz", healthHandler.Liveness)
+	app.Get("/readyz", healthHandler.Readiness)
+	app.Get("/metrics", metrics.Handler())
+
+	// Middleware
+	app.Use(middleware.TracingMiddleware())
+	app.Use(middleware.RequestIDMiddleware())
+	app.Use(middleware.TimeoutMiddleware(cfg.RequestTimeout))
+	app.Use(middleware.MetricsMiddleware())
+	app.Use(middleware.RequestLoggerMiddleware())
+	app.Use(recover.New())
+	app.Use(cors.New(cors.Config{
+		ExposeHeaders: middleware.ImpersonationHeader,
+	}))
+
+	// Public routes
+	app.Get("/.well-known/jwks.json", jwksHandler.GetKeys)
+
+	auth := app.Group("/auth")
+	auth.Post("/login", authHandler.Login)
+	auth.Post("/register", authHandler.Register)
+	auth.Post("/invitations/accept", onboardingHandler.AcceptInvitation)
+	auth.Post("/email/verify", onboardingHandler.VerifyEmail)
+	auth.Post("/email/verify/resend", onboardingHandler.ResendVerification)
+	auth.Post("/password/forgot", passwordHandler.ForgotPassword)
+	auth.Post("/password/reset", passwordHandler.ResetPassword)
+	auth.Post("/2fa/verify", twoFactorHandler.Verify)
+	auth.Post("/2fa/enroll", twoFactorHandler.EnrollWithChallenge)
+	auth.Post("/2fa/enroll/confirm", twoFactorHandler.ConfirmWithChallenge)
+	auth.Get("/oidc/login", oidcHandler.Login)
+	auth.Get("/oidc/callback", oidcHandler.Callback)
+
+	// Protected routes
+	api := app.Group("/api")
+	api.Use(middleware.JWTMiddleware(cfg.JWT.KeySet, cfg.Database))
+
+	// Current user routes. Credential management is never available to
+	// personal access tokens.
+	me := api.Group("/me")
+	me.Get("/", middleware.RequireScope("me"), meHandler.GetProfile)
+	me.Patch("/", middleware.RequireScope("me"), meHandler.UpdateProfile)
+	me.Get("/tasks", middleware.RequireScope("me"), meHandler.GetTasks)
+	me.Get("/positions", middleware.RequireScope("me"), meHandler.GetPositions)
+	me.Get("/activity", middleware.RequireScope("me"), meHandler.GetActivity)
+	me.Get("/export", middleware.RequireScope("me"), privacyHandler.ExportMe)
+	me.Post("/password", middleware.SessionOnly(), passwordHandler.ChangePassword)
+	me.Post("/2fa/enroll", middleware.SessionOnly(), twoFactorHandler.Enroll)
+	me.Post("/2fa/confirm", middleware.SessionOnly(), twoFactorHandler.Confirm)
+	me.Delete("/2fa", middleware.SessionOnly(), twoFactorHandler.Disable)
+	me.Get("/sessions", middleware.SessionOnly(), sessionHandler.GetMySessions)
+	me.Delete("/sessions/:id", middleware.SessionOnly(), sessionHandler.EndMySession)
+	me.Get("/tokens", middleware.SessionOnly(), accessTokenHandler.GetTokens)
+	me.Post("/tokens", middleware.SessionOnly(), accessTokenHandler.CreateToken)
+	me.Delete("/tokens/:id", middleware.SessionOnly(), accessTokenHandler.RevokeToken)
+
+	// User routes. Accounts are managed by admins; everyone else edits
+	// their own profile through /api/me.
+	adminOnly := middleware.AdminOnly(cfg.Database, cfg.AdminPositions)
+	users := api.Group("/users", middleware.RequireScope("users"))
+	users.Get("/", userHandler.GetUsers)
+	users.Post("/", adminOnly, userHandler.CreateUser)
+	users.Put("/:id", adminOnly, userHandler.UpdateUser)
+	users.Delete("/:id", adminOnly, userHandler.DeleteUser)
+	users.Post("/:id/deactivate", adminOnly, userHandler.DeactivateUser)
+
+	// Task routes
+	tasks := api.Group("/tasks", middleware.RequireScope("tasks"))
+	tasks.Get("/", taskHandler.GetTasks)
+	tasks.Post("/", taskHandler.CreateTask)
+	tasks.Put("/:id", taskHandler.UpdateTask)
+	tasks.Delete("/:id", taskHandler.DeleteTask)
+
+	// Position routes. Positions grant admin rights and can require 2FA, so
+	// only admins may change them or who holds them.
+	positions := api.Group("/positions", middleware.RequireScope("positions"))
+	positions.Get("/", positionHandler.GetPositions)
+	positions.Post("/", adminOnly, positionHandler.CreatePosition)
+	positions.Put("/:id", adminOnly, positionHandler.UpdatePosition)
+	positions.Delete("/:id", adminOnly, positionHandler.DeletePosition)
+
+	// User Position routes
+	userPositions := api.Group("/user-positions", middleware.RequireScope("user_positions"))
+	userPositions.Get("/", userPositionHandler.GetUserPositions)
+	userPositions.Post("/", adminOnly, userPositionHandler.CreateUserPosition)
+	userPositions.Delete("/:id", adminOnly, userPositionHandler.DeleteUserPosition)
+
+	// Admin routes
+	admin := api.Group("/admin", middleware.RequireExactScope("admin"), adminOnly)
+	admin.Post("/users/:id/unlock", adminHandler.UnlockUser)
+	admin.Put("/users/:id/status", adminHandler.SetUserStatus)
+	admin.Post("/users/import", importHandler.ImportUsers)
+	admin.Get("/users/:id/export", privacyHandler.ExportUser)
+	admin.Post("/users/:id/erase", privacyHandler.EraseUser)
+	admin.Get("/users/:id/sessions", sessionHandler.GetUserSessions)
+	admin.Delete("/users/:id/sessions/:session_id", sessionHandler.EndUserSession)
+	admin.Post("/users/:id/impersonate", middleware.SessionOnly(), impersonationHandler.Impersonate)
+	admin.Get("/audit/verify", adminHandler.VerifyAuditLog)
+	admin.Post("/invitations", onboardingHandler.Invite)
+	admin.Post("/invitations/:id/resend", onboardingHandler.ResendInvitation)
+	admin.Put("/positions/:id/require-2fa", adminHandler.SetPositionTwoFactor)
+
+	// SCIM provisioning for identity providers and HR systems. Discovery is
+	// public; resources require an administrator's token with the scim scope.
+	scimRoutes := app.Group("/scim/v2")
+	scimRoutes.Get("/ServiceProviderConfig", scimHandler.GetServiceProviderConfig)
+	scimRoutes.Get("/ResourceTypes", scimHandler.GetResourceTypes)
+	scimRoutes.Use(middleware.JWTMiddleware(cfg.JWT.KeySet, cfg.Database), middleware.RequireExactScope("scim"), middleware.AdminOnly(cfg.Database, cfg.AdminPositions))
+	scimRoutes.Get("/Users", scimHandler.GetUsers)
+	scimRoutes.Post("/Users", scimHandler.CreateUser)
+	scimRoutes.Get("/Users/:id", scimHandler.GetUser)
+	scimRoutes.Put("/Users/:id", scimHandler.ReplaceUser)
+	scimRoutes.Patch("/Users/:id", scimHandler.PatchUser)
+	scimRoutes.Delete("/Users/:id", scimHandler.DeleteUser)
+	scimRoutes.Get("/Groups", scimHandler.GetGroups)
+	scimRoutes.Post("/Groups", scimHandler.CreateGroup)
+	scimRoutes.Get("/Groups/:id", scimHandler.GetGroup)
+	scimRoutes.Put("/Groups/:id", scimHandler.ReplaceGroup)
+	scimRoutes.Patch("/Groups/:id", scimHandler.PatchGroup)
+	scimRoutes.Delete("/Groups/:id", scimHandler.DeleteGroup)
+
+	app.Get("/ping", func(c *fiber.Ctx) error {
+		return c.JSON(fiber.Map{
+			"status":  "ok",
+			"message": "server is running",
+		})
+	})
+
+	return app, nil
+}
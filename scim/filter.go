@@ -0,0 +1,472 @@
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Filter is a parsed filter expression (RFC 7644 section 3.4.2.2).
+type Filter interface {
+	isFilter()
+}
+
+// Comparison compares an attribute with a value. Value is a string, float64,
+// bool or nil and is unused for the "pr" (present) operator.
+type Comparison struct {
+	Attr  string
+	Op    string
+	Value interface{}
+}
+
+// Logical combines two filters with "and" or "or".
+type Logical struct {
+	Op          string
+	Left, Right Filter
+}
+
+// Not negates a filter.
+type Not struct {
+	Filter Filter
+}
+
+func (Comparison) isFilter() {}
+func (Logical) isFilter()    {}
+func (Not) isFilter()        {}
+
+var operators = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true, "pr": true,
+}
+
+// ParseFilter parses a filter expression. Attribute names are returned in
+// lower case with any schema URN prefix removed, and attributes inside a
+// value path such as emails[type eq "work"] are qualified as emails.type.
+func ParseFilter(input string) (Filter, error) {
+	tokens, err := lex(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	filter, err := p.parseOr("")
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, invalidFilter("unexpected %q", p.peek().text)
+	}
+	return filter, nil
+}
+
+// NormalizeAttr lower-cases an attribute path and strips its schema URN.
+func NormalizeAttr(attr string) string {
+	attr = strings.ToLower(attr)
+	if strings.HasPrefix(attr, "urn:") {
+		attr = attr[strings.LastIndex(attr, ":")+1:]
+	}
+	return attr
+}
+
+func invalidFilter(format string, args ...interface{}) *Error {
+	return &Error{Status: 400, ScimType: "invalidFilter", Detail: "Invalid filter: " + fmt.Sprintf(format, args...)}
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func lex(input string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(input); {
+		switch ch := input[i]; {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case ch == '(':
+			tokens = append(tokens, token{tokenLParen, "("})
+			i++
+		case ch == ')':
+			tokens = append(tokens, token{tokenRParen, ")"})
+			i++
+		case ch == '[':
+			tokens = append(tokens, token{tokenLBracket, "["})
+			i++
+		case ch == ']':
+			tokens = append(tokens, token{tokenRBracket, "]"})
+			i++
+		case ch == '"':
+			// Strings use JSON escaping
+			end := i + 1
+			for end < len(input) && input[end] != '"' {
+				if input[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(input) {
+				return nil, invalidFilter("unterminated string")
+			}
+			var value string
+			if err := json.Unmarshal([]byte(input[i:end+1]), &value); err != nil {
+				return nil, invalidFilter("malformed string %s", input[i:end+1])
+			}
+			tokens = append(tokens, token{tokenString, value})
+			i = end + 1
+		default:
+			end := i
+			for end < len(input) && !strings.ContainsRune(" \t\n\r()[]\"", rune(input[end])) {
+				end++
+			}
+			tokens = append(tokens, token{tokenWord, input[i:end]})
+			i = end
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) peek() token {
+	if p.done() {
+		return token{kind: -1}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() (token, error) {
+	if p.done() {
+		return token{}, invalidFilter("unexpected end of filter")
+	}
+	t := p.tokens[p.pos]
+	p.pos++
+	return t, nil
+}
+
+func (p *parser) keyword(word string) bool {
+	t := p.peek()
+	if t.kind == tokenWord && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind tokenKind, text string) error {
+	t, err := p.next()
+	if err != nil {
+		return err
+	}
+	if t.kind != kind {
+		return invalidFilter("expected %q but found %q", text, t.text)
+	}
+	return nil
+}
+
+func (p *parser) parseOr(prefix string) (Filter, error) {
+	left, err := p.parseAnd(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd(prefix)
+		if err != nil {
+			return nil, err
+		}
+		left = Logical{Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd(prefix string) (Filter, error) {
+	left, err := p.parseUnary(prefix)
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary(prefix)
+		if err != nil {
+			return nil, err
+		}
+		left = Logical{Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary(prefix string) (Filter, error) {
+	if p.keyword("not") {
+		if err := p.expect(tokenLParen, "("); err != nil {
+			return nil, err
+		}
+		inner, err := p.parseGroup(prefix)
+		if err != nil {
+			return nil, err
+		}
+		return Not{Filter: inner}, nil
+	}
+	if p.peek().kind == tokenLParen {
+		p.pos++
+		return p.parseGroup(prefix)
+	}
+
+	t, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if t.kind != tokenWord {
+		return nil, invalidFilter("expected an attribute but found %q", t.text)
+	}
+	attr := prefix + NormalizeAttr(t.text)
+
+	// Value path: attr[filter on its sub-attributes]
+	if p.peek().kind == tokenLBracket {
+		if prefix != "" {
+			return nil, invalidFilter("value paths cannot be nested")
+		}
+		p.pos++
+		inner, err := p.parseOr(attr + ".")
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(tokenRBracket, "]"); err != nil {
+			return nil, err
+		}
+		return inner, nil
+	}
+
+	opToken, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	op := strings.ToLower(opToken.text)
+	if opToken.kind != tokenWord || !operators[op] {
+		return nil, invalidFilter("unknown operator %q", opToken.text)
+	}
+	if op == "pr" {
+		return Comparison{Attr: attr, Op: op}, nil
+	}
+
+	valueToken, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	value, err := parseValue(valueToken)
+	if err != nil {
+		return nil, err
+	}
+	return Comparison{Attr: attr, Op: op, Value: value}, nil
+}
+
+func (p *parser) parseGroup(prefix string) (Filter, error) {
+	inner, err := p.parseOr(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(tokenRParen, ")"); err != nil {
+		return nil, err
+	}
+	return inner, nil
+}
+
+func parseValue(t token) (interface{}, error) {
+	if t.kind == tokenString {
+		return t.text, nil
+	}
+	if t.kind != tokenWord {
+		return nil, invalidFilter("expected a value but found %q", t.text)
+	}
+	switch strings.ToLower(t.text) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	number, err := strconv.ParseFloat(t.text, 64)
+	if err != nil {
+		return nil, invalidFilter("invalid value %q", t.text)
+	}
+	return number, nil
+}
+
+// Kind selects how an attribute is compared in SQL.
+type Kind int
+
+const (
+	// String compares case-insensitively.
+	String Kind = iota
+	CaseExactString
+	UUID
+	Boolean
+	DateTime
+	// Reference is a condition with one placeholder for a referenced
+	// resource ID, such as a group membership. It supports eq only.
+	Reference
+)
+
+// Column maps an attribute to a SQL expression.
+type Column struct {
+	Expr string
+	Kind Kind
+}
+
+// ToSQL translates filter into a SQL condition and its arguments. columns is
+// keyed by normalized attribute name; other attributes are rejected.
+func ToSQL(filter Filter, columns map[string]Column) (string, []interface{}, error) {
+	switch f := filter.(type) {
+	case Logical:
+		left, leftArgs, err := ToSQL(f.Left, columns)
+		if err != nil {
+			return "", nil, err
+		}
+		right, rightArgs, err := ToSQL(f.Right, columns)
+		if err != nil {
+			return "", nil, err
+		}
+		return "(" + left + " " + strings.ToUpper(f.Op) + " " + right + ")", append(leftArgs, rightArgs...), nil
+	case Not:
+		inner, args, err := ToSQL(f.Filter, columns)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + inner + ")", args, nil
+	case Comparison:
+		column, ok := columns[f.Attr]
+		if !ok {
+			return "", nil, invalidFilter("unsupported attribute %q", f.Attr)
+		}
+		return compareSQL(column, f)
+	}
+	return "", nil, invalidFilter("unsupported expression")
+}
+
+var sqlOperators = map[string]string{
+	"eq": "=", "ne": "<>", "gt": ">", "ge": ">=", "lt": "<", "le": "<=",
+}
+
+func compareSQL(column Column, f Comparison) (string, []interface{}, error) {
+	if f.Op == "pr" {
+		switch column.Kind {
+		case String, CaseExactString:
+			return "(" + column.Expr + " IS NOT NULL AND " + column.Expr + " <> '')", nil, nil
+		case Boolean, UUID:
+			return "1 = 1", nil, nil
+		case Reference:
+			return "", nil, invalidFilter("%s does not support pr", f.Attr)
+		}
+		return column.Expr + " IS NOT NULL", nil, nil
+	}
+
+	switch column.Kind {
+	case Boolean:
+		value, ok := f.Value.(bool)
+		if !ok || (f.Op != "eq" && f.Op != "ne") {
+			return "", nil, invalidFilter("%s only supports eq and ne with true or false", f.Attr)
+		}
+		return column.Expr + " " + sqlOperators[f.Op] + " ?", []interface{}{value}, nil
+	case UUID, Reference:
+		value, ok := f.Value.(string)
+		if !ok || (f.Op != "eq" && (f.Op != "ne" || column.Kind == Reference)) {
+			return "", nil, invalidFilter("%s only supports eq with a string", f.Attr)
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			// No resource has a malformed ID
+			if f.Op == "ne" {
+				return "1 = 1", nil, nil
+			}
+			return "1 = 0", nil, nil
+		}
+		if column.Kind == Reference {
+			return column.Expr, []interface{}{id}, nil
+		}
+		return column.Expr + " " + sqlOperators[f.Op] + " ?", []interface{}{id}, nil
+	case DateTime:
+		value, ok := f.Value.(string)
+		if !ok {
+			return "", nil, invalidFilter("%s must be compared with a timestamp", f.Attr)
+		}
+		t, err := time.Parse(time.RFC3339, value)
+		if err != nil || sqlOperators[f.Op] == "" {
+			return "", nil, invalidFilter("%s must be compared with an RFC 3339 timestamp using eq, ne, gt, ge, lt or le", f.Attr)
+		}
+		return column.Expr + " " + sqlOperators[f.Op] + " ?", []interface{}{t}, nil
+	}
+
+	value, ok := f.Value.(string)
+	if !ok {
+		return "", nil, invalidFilter("%s must be compared with a string", f.Attr)
+	}
+	expr, placeholder := column.Expr, "?"
+	if column.Kind == String {
+		expr, placeholder = "LOWER("+column.Expr+")", "LOWER(?)"
+	}
+
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
+	switch f.Op {
+	case "co":
+		return expr + " LIKE " + placeholder + ` ESCAPE '\'`, []interface{}{"%" + escaped + "%"}, nil
+	case "sw":
+		return expr + " LIKE " + placeholder + ` ESCAPE '\'`, []interface{}{escaped + "%"}, nil
+	case "ew":
+		return expr + " LIKE " + placeholder + ` ESCAPE '\'`, []interface{}{"%" + escaped}, nil
+	}
+	return expr + " " + sqlOperators[f.Op] + " " + placeholder, []interface{}{value}, nil
+}
+
+// Match evaluates filter against a flat set of attribute values, as used by
+// PATCH paths such as members[value eq "..."]. String comparisons are
+// case-insensitive.
+func Match(filter Filter, attrs map[string]string) bool {
+	switch f := filter.(type) {
+	case Logical:
+		if f.Op == "and" {
+			return Match(f.Left, attrs) && Match(f.Right, attrs)
+		}
+		return Match(f.Left, attrs) || Match(f.Right, attrs)
+	case Not:
+		return !Match(f.Filter, attrs)
+	case Comparison:
+		actual, present := attrs[f.Attr]
+		if f.Op == "pr" {
+			return present && actual != ""
+		}
+		actual = strings.ToLower(actual)
+		expected := strings.ToLower(fmt.Sprint(f.Value))
+		switch f.Op {
+		case "eq":
+			return present && actual == expected
+		case "ne":
+			return !present || actual != expected
+		case "co":
+			return present && strings.Contains(actual, expected)
+		case "sw":
+			return present && strings.HasPrefix(actual, expected)
+		case "ew":
+			return present && strings.HasSuffix(actual, expected)
+		}
+	}
+	return false
+}
@@ -0,0 +1,284 @@
+package scim
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Filter
+	}{
+		{
+			input: `userName eq "bjensen"`,
+			want:  Comparison{Attr: "username", Op: "eq", Value: "bjensen"},
+		},
+		{
+			input: `urn:ietf:params:scim:schemas:core:2.0:User:userName SW "J"`,
+			want:  Comparison{Attr: "username", Op: "sw", Value: "J"},
+		},
+		{
+			input: `title pr`,
+			want:  Comparison{Attr: "title", Op: "pr"},
+		},
+		{
+			input: `active eq true and meta.version eq null or loginCount gt 3.5`,
+			want: Logical{Op: "or",
+				Left: Logical{Op: "and",
+					Left:  Comparison{Attr: "active", Op: "eq", Value: true},
+					Right: Comparison{Attr: "meta.version", Op: "eq", Value: nil},
+				},
+				Right: Comparison{Attr: "logincount", Op: "gt", Value: 3.5},
+			},
+		},
+		{
+			// and binds tighter than or
+			input: `a eq "1" or b eq "2" and c eq "3"`,
+			want: Logical{Op: "or",
+				Left: Comparison{Attr: "a", Op: "eq", Value: "1"},
+				Right: Logical{Op: "and",
+					Left:  Comparison{Attr: "b", Op: "eq", Value: "2"},
+					Right: Comparison{Attr: "c", Op: "eq", Value: "3"},
+				},
+			},
+		},
+		{
+			input: `(a eq "1" or b eq "2") and c eq "3"`,
+			want: Logical{Op: "and",
+				Left: Logical{Op: "or",
+					Left:  Comparison{Attr: "a", Op: "eq", Value: "1"},
+					Right: Comparison{Attr: "b", Op: "eq", Value: "2"},
+				},
+				Right: Comparison{Attr: "c", Op: "eq", Value: "3"},
+			},
+		},
+		{
+			input: `NOT (a eq "1") and b pr`,
+			want: Logical{Op: "and",
+				Left:  Not{Filter: Comparison{Attr: "a", Op: "eq", Value: "1"}},
+				Right: Comparison{Attr: "b", Op: "pr"},
+			},
+		},
+		{
+			input: `emails[type eq "work" and value co "@example.com"]`,
+			want: Logical{Op: "and",
+				Left:  Comparison{Attr: "emails.type", Op: "eq", Value: "work"},
+				Right: Comparison{Attr: "emails.value", Op: "co", Value: "@example.com"},
+			},
+		},
+		{
+			input: `userName eq "say \"hi\"!"`,
+			want:  Comparison{Attr: "username", Op: "eq", Value: `say "hi"!`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseFilter(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, input := range []string{
+		``,
+		`userName`,
+		`userName eq`,
+		`userName like "x"`,
+		`userName eq "unterminated`,
+		`userName eq bjensen`,
+		`(userName eq "x"`,
+		`userName eq "x")`,
+		`not userName eq "x"`,
+		`emails[type eq "work"`,
+		`emails[type[value eq "x"] eq "y"]`,
+		`userName eq "x" and`,
+		`eq "x"`,
+	} {
+		t.Run(input, func(t *testing.T) {
+			_, err := ParseFilter(input)
+			scimErr, ok := err.(*Error)
+			if !ok || scimErr.ScimType != "invalidFilter" || scimErr.Status != 400 {
+				t.Errorf("error = %v, want invalidFilter", err)
+			}
+		})
+	}
+}
+
+func TestToSQL(t *testing.T) {
+	id := uuid.MustParse("0b5a9f36-8a4b-4d8e-9d4e-0f2b4b1b6c3d")
+	columns := map[string]Column{
+		"username":     {Expr: "users.username", Kind: String},
+		"externalid":   {Expr: "users.external_id", Kind: CaseExactString},
+		"id":           {Expr: "users.id", Kind: UUID},
+		"active":       {Expr: "users.active", Kind: Boolean},
+		"meta.created": {Expr: "users.created_at", Kind: DateTime},
+		"groups.value": {Expr: "EXISTS (SELECT 1 FROM memberships WHERE group_id = ?)", Kind: Reference},
+	}
+
+	tests := []struct {
+		input    string
+		wantSQL  string
+		wantArgs []interface{}
+	}{
+		{
+			input:    `userName eq "Bjensen"`,
+			wantSQL:  `LOWER(users.username) = LOWER(?)`,
+			wantArgs: []interface{}{"Bjensen"},
+		},
+		{
+			input:    `externalId eq "Abc"`,
+			wantSQL:  `users.external_id = ?`,
+			wantArgs: []interface{}{"Abc"},
+		},
+		{
+			// LIKE wildcards in the value match literally
+			input:    `userName co "50%_off\\"`,
+			wantSQL:  `LOWER(users.username) LIKE LOWER(?) ESCAPE '\'`,
+			wantArgs: []interface{}{`%50\%\_off\\%`},
+		},
+		{
+			input:    `userName sw "a_"`,
+			wantSQL:  `LOWER(users.username) LIKE LOWER(?) ESCAPE '\'`,
+			wantArgs: []interface{}{`a\_%`},
+		},
+		{
+			input:    `externalId ew "%"`,
+			wantSQL:  `users.external_id LIKE ? ESCAPE '\'`,
+			wantArgs: []interface{}{`%\%`},
+		},
+		{
+			input:   `userName pr`,
+			wantSQL: `(users.username IS NOT NULL AND users.username <> '')`,
+		},
+		{
+			input:   `meta.created pr`,
+			wantSQL: `users.created_at IS NOT NULL`,
+		},
+		{
+			input:    `active eq false`,
+			wantSQL:  `users.active = ?`,
+			wantArgs: []interface{}{false},
+		},
+		{
+			input:    `id eq "` + id.String() + `"`,
+			wantSQL:  `users.id = ?`,
+			wantArgs: []interface{}{id},
+		},
+		{
+			input:   `id eq "not-a-uuid"`,
+			wantSQL: `1 = 0`,
+		},
+		{
+			input:   `id ne "not-a-uuid"`,
+			wantSQL: `1 = 1`,
+		},
+		{
+			input:    `groups[value eq "` + id.String() + `"]`,
+			wantSQL:  `EXISTS (SELECT 1 FROM memberships WHERE group_id = ?)`,
+			wantArgs: []interface{}{id},
+		},
+		{
+			input:   `groups.value eq "nope"`,
+			wantSQL: `1 = 0`,
+		},
+		{
+			input:    `not (userName pr) or active eq true and id eq "x"`,
+			wantSQL:  `(NOT ((users.username IS NOT NULL AND users.username <> '')) OR (users.active = ? AND 1 = 0))`,
+			wantArgs: []interface{}{true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			filter, err := ParseFilter(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sql, args, err := ToSQL(filter, columns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sql != tt.wantSQL {
+				t.Errorf("sql = %s\nwant  %s", sql, tt.wantSQL)
+			}
+			if len(args) != 0 || len(tt.wantArgs) != 0 {
+				if !reflect.DeepEqual(args, tt.wantArgs) {
+					t.Errorf("args = %#v, want %#v", args, tt.wantArgs)
+				}
+			}
+		})
+	}
+}
+
+func TestToSQLErrors(t *testing.T) {
+	columns := map[string]Column{
+		"username":     {Expr: "users.username", Kind: String},
+		"id":           {Expr: "users.id", Kind: UUID},
+		"active":       {Expr: "users.active", Kind: Boolean},
+		"meta.created": {Expr: "users.created_at", Kind: DateTime},
+		"groups":       {Expr: "EXISTS (?)", Kind: Reference},
+	}
+	for _, input := range []string{
+		`title eq "x"`,
+		`userName eq 3`,
+		`active eq "true"`,
+		`active gt true`,
+		`id gt "x"`,
+		`groups ne "x"`,
+		`groups pr`,
+		`meta.created gt "yesterday"`,
+		`meta.created co "2024"`,
+		`userName eq "x" and title pr`,
+	} {
+		t.Run(input, func(t *testing.T) {
+			filter, err := ParseFilter(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := ToSQL(filter, columns); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	attrs := map[string]string{"value": "Alice@Example.com", "type": "work"}
+	tests := []struct {
+		input string
+		want  bool
+	}{
+		{`value eq "alice@example.com"`, true},
+		{`value ne "alice@example.com"`, false},
+		{`value co "example"`, true},
+		{`value sw "bob"`, false},
+		{`value ew ".COM"`, true},
+		{`type pr`, true},
+		{`display pr`, false},
+		{`display ne "x"`, true},
+		{`type eq "home" or value sw "alice"`, true},
+		{`type eq "home" and value sw "alice"`, false},
+		{`not (type eq "home")`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			filter, err := ParseFilter(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := Match(filter, attrs); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,223 @@
+// Package scim implements the protocol pieces of SCIM 2.0 (RFC 7643 and
+// RFC 7644) that don't depend on the application's models: filters, PATCH
+// paths, errors and discovery documents.
+package scim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ContentType is the media type of SCIM requests and responses.
+const ContentType = "application/scim+json"
+
+const (
+	SchemaUser                  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SchemaGroup                 = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SchemaListResponse          = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SchemaPatchOp               = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SchemaError                 = "urn:ietf:params:scim:api:messages:2.0:Error"
+	SchemaServiceProviderConfig = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	SchemaResourceType          = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+)
+
+// Paging limits for list requests.
+const (
+	DefaultCount = 100
+	MaxCount     = 200
+)
+
+// Error is a SCIM error response. It is also returned as a Go error by the
+// parsers in this package.
+type Error struct {
+	Status   int
+	ScimType string
+	Detail   string
+}
+
+func (e *Error) Error() string {
+	return e.Detail
+}
+
+// MarshalJSON renders the error in the SCIM wire format, where status is a
+// string.
+func (e *Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Schemas  []string `json:"schemas"`
+		Status   string   `json:"status"`
+		ScimType string   `json:"scimType,omitempty"`
+		Detail   string   `json:"detail,omitempty"`
+	}{[]string{SchemaError}, fmt.Sprint(e.Status), e.ScimType, e.Detail})
+}
+
+// Errorf builds an Error with a formatted detail message.
+func Errorf(status int, scimType, format string, args ...interface{}) *Error {
+	return &Error{Status: status, ScimType: scimType, Detail: fmt.Sprintf(format, args...)}
+}
+
+type Meta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location"`
+}
+
+type ListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int64       `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+// NewListResponse wraps one page of resources. startIndex is 1-based.
+func NewListResponse(resources interface{}, count int, total int64, startIndex int) ListResponse {
+	return ListResponse{
+		Schemas:      []string{SchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: count,
+		Resources:    resources,
+	}
+}
+
+type PatchRequest struct {
+	Schemas    []string         `json:"schemas"`
+	Operations []PatchOperation `json:"Operations"`
+}
+
+// PatchOperation is one PATCH operation. Op is normalized to lower case by
+// ParsePatch since some clients send "Replace" or "Add".
+type PatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ParsePatch decodes and checks a PATCH request body.
+func ParsePatch(body []byte) (PatchRequest, error) {
+	var req PatchRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return req, Errorf(400, "invalidSyntax", "Request body is not a valid PatchOp message")
+	}
+	if len(req.Operations) == 0 {
+		return req, Errorf(400, "invalidSyntax", "Operations must not be empty")
+	}
+	for i := range req.Operations {
+		op := &req.Operations[i]
+		op.Op = strings.ToLower(op.Op)
+		if op.Op != "add" && op.Op != "replace" && op.Op != "remove" {
+			return req, Errorf(400, "invalidSyntax", "Unknown operation %q", op.Op)
+		}
+		if op.Op == "remove" && op.Path == "" {
+			return req, Errorf(400, "noTarget", "Remove operations require a path")
+		}
+	}
+	return req, nil
+}
+
+// Path is a parsed PATCH path: attr, attr.sub, attr[filter] or
+// attr[filter].sub. Attr and Sub are normalized to lower case.
+type Path struct {
+	Attr   string
+	Filter Filter
+	Sub    string
+}
+
+// ParsePath parses a PATCH operation path.
+func ParsePath(path string) (Path, error) {
+	var parsed Path
+	head, rest, bracketed := strings.Cut(path, "[")
+	head = NormalizeAttr(head)
+	if bracketed {
+		end := strings.LastIndex(rest, "]")
+		if end < 0 {
+			return parsed, Errorf(400, "invalidPath", "Invalid path %q", path)
+		}
+		filter, err := ParseFilter(rest[:end])
+		if err != nil {
+			return parsed, Errorf(400, "invalidPath", "Invalid path %q", path)
+		}
+		parsed.Filter = filter
+		if sub := rest[end+1:]; sub != "" {
+			if !strings.HasPrefix(sub, ".") {
+				return parsed, Errorf(400, "invalidPath", "Invalid path %q", path)
+			}
+			parsed.Sub = strings.ToLower(sub[1:])
+		}
+		parsed.Attr = head
+	} else {
+		parsed.Attr, parsed.Sub, _ = strings.Cut(head, ".")
+	}
+	if parsed.Attr == "" {
+		return parsed, Errorf(400, "invalidPath", "Invalid path %q", path)
+	}
+	return parsed, nil
+}
+
+// Bool decodes a boolean value. Some clients send "True" or "False" as
+// strings. null is rejected rather than read as false.
+func Bool(raw json.RawMessage) (bool, error) {
+	var value bool
+	if err := json.Unmarshal(raw, &value); err == nil && string(bytes.TrimSpace(raw)) != "null" {
+		return value, nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		switch strings.ToLower(text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		}
+	}
+	return false, Errorf(400, "invalidValue", "Expected a boolean but got %s", raw)
+}
+
+// ServiceProviderConfig describes the supported features for discovery.
+func ServiceProviderConfig(baseURL string) map[string]interface{} {
+	return map[string]interface{}{
+		"schemas":          []string{SchemaServiceProviderConfig},
+		"documentationUri": "https://datatracker.ietf.org/doc/html/rfc7644",
+		"patch":            map[string]bool{"supported": true},
+		"bulk":             map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":           map[string]interface{}{"supported": true, "maxResults": MaxCount},
+		"changePassword":   map[string]bool{"supported": true},
+		"sort":             map[string]bool{"supported": false},
+		"etag":             map[string]bool{"supported": false},
+		"authenticationSchemes": []map[string]interface{}{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer token",
+			"description": "A personal access token with the scim scope, held by an administrator",
+			"primary":     true,
+		}},
+		"meta": map[string]string{
+			"resourceType": "ServiceProviderConfig",
+			"location":     baseURL + "/ServiceProviderConfig",
+		},
+	}
+}
+
+// ResourceTypes lists the User and Group resource types.
+func ResourceTypes(baseURL string) []map[string]interface{} {
+	resourceType := func(id, endpoint, schema string) map[string]interface{} {
+		return map[string]interface{}{
+			"schemas":  []string{SchemaResourceType},
+			"id":       id,
+			"name":     id,
+			"endpoint": endpoint,
+			"schema":   schema,
+			"meta": map[string]string{
+				"resourceType": "ResourceType",
+				"location":     baseURL + "/ResourceTypes/" + id,
+			},
+		}
+	}
+	return []map[string]interface{}{
+		resourceType("User", "/Users", SchemaUser),
+		resourceType("Group", "/Groups", SchemaGroup),
+	}
+}
@@ -0,0 +1,109 @@
+package scim
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Path
+	}{
+		{"userName", Path{Attr: "username"}},
+		{"name.givenName", Path{Attr: "name", Sub: "givenname"}},
+		{"urn:ietf:params:scim:schemas:core:2.0:User:displayName", Path{Attr: "displayname"}},
+		{
+			`members[value eq "2819c223"]`,
+			Path{Attr: "members", Filter: Comparison{Attr: "value", Op: "eq", Value: "2819c223"}},
+		},
+		{
+			`emails[type eq "work"].Value`,
+			Path{Attr: "emails", Filter: Comparison{Attr: "type", Op: "eq", Value: "work"}, Sub: "value"},
+		},
+		{
+			// Brackets inside the filter's strings don't end the path
+			`emails[value eq "a]b"].display`,
+			Path{Attr: "emails", Filter: Comparison{Attr: "value", Op: "eq", Value: "a]b"}, Sub: "display"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParsePath(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePathErrors(t *testing.T) {
+	for _, input := range []string{
+		``,
+		`.givenName`,
+		`members[value eq "x"`,
+		`members[value eq]`,
+		`members[value eq "x"]display`,
+		`[value eq "x"]`,
+	} {
+		t.Run(input, func(t *testing.T) {
+			_, err := ParsePath(input)
+			scimErr, ok := err.(*Error)
+			if !ok || scimErr.ScimType != "invalidPath" {
+				t.Errorf("error = %v, want invalidPath", err)
+			}
+		})
+	}
+}
+
+func TestParsePatch(t *testing.T) {
+	req, err := ParsePatch([]byte(`{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "Replace", "path": "active", "value": false},
+			{"op": "remove", "path": "emails[type eq \"work\"]"}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Operations) != 2 || req.Operations[0].Op != "replace" || req.Operations[1].Op != "remove" {
+		t.Errorf("operations = %+v", req.Operations)
+	}
+
+	for name, tt := range map[string]struct {
+		body     string
+		scimType string
+	}{
+		"malformed":         {`{"Operations": `, "invalidSyntax"},
+		"no operations":     {`{"Operations": []}`, "invalidSyntax"},
+		"unknown operation": {`{"Operations": [{"op": "move", "path": "active"}]}`, "invalidSyntax"},
+		"remove everything": {`{"Operations": [{"op": "remove"}]}`, "noTarget"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParsePatch([]byte(tt.body))
+			scimErr, ok := err.(*Error)
+			if !ok || scimErr.ScimType != tt.scimType {
+				t.Errorf("error = %v, want %s", err, tt.scimType)
+			}
+		})
+	}
+}
+
+func TestBool(t *testing.T) {
+	for raw, want := range map[string]bool{`true`: true, `false`: false, `"True"`: true, `"FALSE"`: false} {
+		got, err := Bool(json.RawMessage(raw))
+		if err != nil || got != want {
+			t.Errorf("Bool(%s) = %v, %v; want %v", raw, got, err, want)
+		}
+	}
+	for _, raw := range []string{`1`, `"yes"`, `null`} {
+		if _, err := Bool(json.RawMessage(raw)); err == nil {
+			t.Errorf("Bool(%s) succeeded, want an error", raw)
+		}
+	}
+}
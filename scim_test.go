@@ -0,0 +1,199 @@
+package main
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"todo-apps/handlers"
+	"todo-apps/models"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+type scimList struct {
+	TotalResults int64               `json:"totalResults"`
+	Resources    []handlers.SCIMUser `json:"Resources"`
+}
+
+// newSCIMClient returns a scanner authenticated with an administrator's
+// scim-scoped personal access token, as an identity provider would be.
+func newSCIMClient(t *testing.T) *responseScanner {
+	t.Helper()
+	s := newResponseScanner(t)
+	const password = "Correct-horse-42"
+
+	s.expect(fiber.StatusCreated, "POST", "/auth/register", map[string]string{
+		"name": "Alice", "username": "alice", "password": password,
+	}, nil)
+	var login struct {
+		Token string `json:"token"`
+	}
+	s.expect(fiber.StatusOK, "POST", "/auth/login", map[string]string{
+		"username": "alice", "password": password,
+	}, &login)
+	var alice models.User
+	s.db.First(&alice, "username = ?", "alice")
+	admin := models.Position{Name: "Admin"}
+	s.db.Create(&admin)
+	s.db.Create(&models.UserPosition{UserID: alice.ID, PositionID: admin.ID})
+
+	s.token = login.Token
+	var pat struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	s.expect(fiber.StatusCreated, "POST", "/api/me/tokens", map[string]interface{}{
+		"name": "idp", "scopes": []string{"scim"},
+	}, &pat)
+	s.token = pat.Data.Token
+	return s
+}
+
+// TestSCIMFilterAndPatch drives the SCIM endpoints the way an identity
+// provider does: create, look up by filter, patch and manage membership.
+func TestSCIMFilterAndPatch(t *testing.T) {
+	s := newSCIMClient(t)
+
+	var user handlers.SCIMUser
+	s.expect(fiber.StatusCreated, "POST", "/scim/v2/Users", map[string]interface{}{
+		"userName": "bjensen",
+		"name":     map[string]string{"givenName": "Barbara", "familyName": "Jensen"},
+		"emails":   []map[string]interface{}{{"value": "bjensen@example.com", "primary": true}},
+	}, &user)
+	if user.DisplayName != "Barbara Jensen" || !user.Active {
+		t.Fatalf("created user = %+v", user)
+	}
+
+	filterUsers := func(filter string) scimList {
+		t.Helper()
+		var list scimList
+		s.expect(fiber.StatusOK, "GET", "/scim/v2/Users?filter="+url.QueryEscape(filter), nil, &list)
+		return list
+	}
+	for filter, want := range map[string]int64{
+		`userName eq "BJENSEN"`:                              1,
+		`emails[value ew "@example.com"] and active eq true`: 1,
+		`userName sw "bj" and not (userName eq "bjensen")`:   0,
+		`userName co "%"`:                                    0,
+		`userName co "_"`:                                    0,
+		`id eq "not-a-uuid"`:                                 0,
+		`id eq "` + user.ID + `"`:                            1,
+	} {
+		if got := filterUsers(filter).TotalResults; got != want {
+			t.Errorf("filter %s: %d results, want %d", filter, got, want)
+		}
+	}
+	if got := s.do("GET", "/scim/v2/Users?filter="+url.QueryEscape(`userName eq`), nil, nil); got != fiber.StatusBadRequest {
+		t.Errorf("invalid filter: status %d, want 400", got)
+	}
+
+	// Name parts and active as sent by Okta and Entra ID
+	s.expect(fiber.StatusOK, "PATCH", "/scim/v2/Users/"+user.ID, map[string]interface{}{
+		"schemas": []string{"urn:ietf:params:scim:api:messages:2.0:PatchOp"},
+		"Operations": []map[string]interface{}{
+			{"op": "Replace", "path": "name.givenName", "value": "Babs"},
+			{"op": "replace", "value": map[string]interface{}{"active": "False"}},
+		},
+	}, &user)
+	if user.DisplayName != "Babs Jensen" || user.Active {
+		t.Fatalf("patched user = %+v", user)
+	}
+	if got := filterUsers(`active eq false and displayName sw "babs"`).TotalResults; got != 1 {
+		t.Errorf("patched user not found by filter: %d results", got)
+	}
+	if got := s.do("PATCH", "/scim/v2/Users/"+user.ID, map[string]interface{}{
+		"Operations": []map[string]interface{}{{"op": "remove", "path": "userName"}},
+	}, nil); got != fiber.StatusBadRequest {
+		t.Errorf("removing userName: status %d, want 400", got)
+	}
+
+	// Group membership, then removal through a filtered path
+	var group handlers.SCIMGroup
+	s.expect(fiber.StatusCreated, "POST", "/scim/v2/Groups", map[string]interface{}{
+		"displayName": "Engineers",
+		"members":     []map[string]string{{"value": user.ID}},
+	}, &group)
+	if got := filterUsers(`groups[value eq "` + group.ID + `"]`).TotalResults; got != 1 {
+		t.Errorf("group members: %d results, want 1", got)
+	}
+	var patched handlers.SCIMGroup
+	s.expect(fiber.StatusOK, "PATCH", "/scim/v2/Groups/"+group.ID, map[string]interface{}{
+		"Operations": []map[string]interface{}{
+			{"op": "remove", "path": `members[value eq "` + user.ID + `"]`},
+		},
+	}, &patched)
+	if len(patched.Members) != 0 {
+		t.Errorf("members after removal = %+v", patched.Members)
+	}
+	if got := filterUsers(`groups.value eq "` + group.ID + `"`).TotalResults; got != 0 {
+		t.Errorf("group members after removal: %d results, want 0", got)
+	}
+}
+
+// TestSCIMDeleteDeactivates checks that DELETE keeps the user and their
+// tasks but hides them from SCIM, as RFC 7644 requires of deleted users.
+func TestSCIMDeleteDeactivates(t *testing.T) {
+	s := newSCIMClient(t)
+
+	var user handlers.SCIMUser
+	s.expect(fiber.StatusCreated, "POST", "/scim/v2/Users", map[string]interface{}{
+		"userName": "bjensen", "displayName": "Barbara Jensen",
+	}, &user)
+	var group handlers.SCIMGroup
+	s.expect(fiber.StatusCreated, "POST", "/scim/v2/Groups", map[string]interface{}{
+		"displayName": "Engineers", "members": []map[string]string{{"value": user.ID}},
+	}, &group)
+	task := models.Task{UserID: uuid.MustParse(user.ID), Todo: "Review", EndDate: time.Now().Add(time.Hour)}
+	if err := s.db.Create(&task).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	s.expect(fiber.StatusNoContent, "DELETE", "/scim/v2/Users/"+user.ID, nil, nil)
+
+	var stored models.User
+	if err := s.db.First(&stored, "id = ?", user.ID).Error; err != nil {
+		t.Fatalf("user row was deleted: %v", err)
+	}
+	if stored.Status != models.UserStatusDeactivated || stored.DeactivatedAt == nil {
+		t.Errorf("status = %s, deactivated_at = %v", stored.Status, stored.DeactivatedAt)
+	}
+	var tasks int64
+	s.db.Model(&models.Task{}).Where("user_id = ?", user.ID).Count(&tasks)
+	if tasks != 1 {
+		t.Errorf("user has %d tasks, want 1", tasks)
+	}
+
+	for _, req := range []struct {
+		method, path string
+		body         interface{}
+	}{
+		{"GET", "/scim/v2/Users/" + user.ID, nil},
+		{"PUT", "/scim/v2/Users/" + user.ID, map[string]string{"userName": "bjensen"}},
+		{"PATCH", "/scim/v2/Users/" + user.ID, map[string]interface{}{
+			"Operations": []map[string]interface{}{{"op": "replace", "path": "active", "value": true}},
+		}},
+		{"DELETE", "/scim/v2/Users/" + user.ID, nil},
+	} {
+		if got := s.do(req.method, req.path, req.body, nil); got != fiber.StatusNotFound {
+			t.Errorf("%s after delete: status %d, want 404", req.method, got)
+		}
+	}
+	var list scimList
+	s.expect(fiber.StatusOK, "GET", "/scim/v2/Users?filter="+url.QueryEscape(`userName eq "bjensen"`), nil, &list)
+	if list.TotalResults != 0 {
+		t.Errorf("deleted user listed: %+v", list.Resources)
+	}
+	var fetched handlers.SCIMGroup
+	s.expect(fiber.StatusOK, "GET", "/scim/v2/Groups/"+group.ID, nil, &fetched)
+	if len(fetched.Members) != 0 {
+		t.Errorf("deleted user is still a member: %+v", fetched.Members)
+	}
+	if got := s.do("PATCH", "/scim/v2/Groups/"+group.ID, map[string]interface{}{
+		"Operations": []map[string]interface{}{{"op": "add", "path": "members", "value": []map[string]string{{"value": user.ID}}}},
+	}, nil); got != fiber.StatusBadRequest {
+		t.Errorf("adding a deleted user to a group: status %d, want 400", got)
+	}
+}
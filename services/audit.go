@@ -2,49 +2,251 @@ package services
 
 import (
 	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"todo-apps/config"
+	"todo-apps/impersonation"
+	"todo-apps/logging"
+	"todo-apps/metrics"
 	"todo-apps/models"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// ErrNoPseudonymKey is returned by Pseudonymize when no pseudonym key is
+// configured, since pseudonyms made without one can be reversed.
+var ErrNoPseudonymKey = errors.New("audit pseudonym key is not configured")
+
+// chainRetries bounds how often an append is retried when another
+// instance claimed the same sequence number.
+const chainRetries = 5
+
 type AuditService struct {
 	collection *mongo.Collection
+	chain      auditChain
+	// mu serializes appends from this process; the unique index on seq
+	// serializes them across instances.
+	mu      sync.Mutex
+	indexed atomic.Bool
 }
 
-func NewAuditService(mongodb *config.MongoDB) *AuditService {
+func NewAuditService(mongodb *config.MongoDB, cfg config.AuditConfig) *AuditService {
 	return &AuditService{
 		collection: mongodb.Database.Collection("audit_logs"),
+		chain:      auditChain{key: []byte(cfg.PseudonymKey)},
 	}
 }
 
-func (s *AuditService) LogAction(userID, action, entity, entityID string, before, after interface{}) error {
+func (s *AuditService) LogAction(ctx context.Context, userID, action, entity, entityID string, before, after interface{}) error {
 	auditLog := models.AuditLog{
-		UserID:    userID,
-		Action:    action,
-		Entity:    entity,
-		EntityID:  entityID,
-		Timestamp: time.Now(),
+		UserID:         userID,
+		ImpersonatorID: impersonation.FromContext(ctx),
+		Action:         action,
+		Entity:         entity,
+		EntityID:       entityID,
+		// MongoDB stores milliseconds; the hash must match what is read back
+		Timestamp: time.Now().UTC().Truncate(time.Millisecond),
 		Meta: models.AuditMeta{
-			Before: before,
-			After:  after,
+			Before: normalizeMeta(before),
+			After:  normalizeMeta(after),
 		},
 	}
+	auditLog.MetaDigest = metaDigest(auditLog.Meta)
+
+	start := time.Now()
+	err := s.append(ctx, auditLog)
+	metrics.AuditInsertDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.AuditInsertFailures.Inc()
+		logging.FromContext(ctx).Error("Failed to write audit log",
+			"error", err, "action", action, "entity", entity, "entity_id", entityID)
+	}
+	return err
+}
+
+func (s *AuditService) LogCreate(ctx context.Context, userID, entity, entityID string, data interface{}) error {
+	return s.LogAction(ctx, userID, "CREATE", entity, entityID, nil, data)
+}
+
+func (s *AuditService) LogUpdate(ctx context.Context, userID, entity, entityID string, before, after interface{}) error {
+	return s.LogAction(ctx, userID, "UPDATE", entity, entityID, before, after)
+}
+
+func (s *AuditService) LogDelete(ctx context.Context, userID, entity, entityID string, data interface{}) error {
+	return s.LogAction(ctx, userID, "DELETE", entity, entityID, data, nil)
+}
+
+// append links entry to the end of the chain and inserts it.
+func (s *AuditService) append(ctx context.Context, entry models.AuditLog) error {
+	if !s.indexed.Load() {
+		// Entries from before the chain have no seq and are left out
+		_, err := s.collection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.D{{Key: "seq", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"seq": bson.M{"$exists": true}}),
+		})
+		if err != nil {
+			return err
+		}
+		s.indexed.Store(true)
+	}
 
-	_, err := s.collection.InsertOne(context.TODO(), auditLog)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < chainRetries; attempt++ {
+		var last models.AuditLog
+		err = s.collection.FindOne(ctx, bson.M{"seq": bson.M{"$exists": true}},
+			options.FindOne().SetSort(bson.D{{Key: "seq", Value: -1}}).SetProjection(bson.M{"seq": 1, "hash": 1})).
+			Decode(&last)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+
+		entry.Seq = last.Seq + 1
+		entry.PrevHash = last.Hash
+		entry.Hash = s.chain.hash(entry)
+		_, err = s.collection.InsertOne(ctx, entry)
+		if !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
 	return err
 }
 
-func (s *AuditService) LogCreate(userID, entity, entityID string, data interface{}) error {
-	return s.LogAction(userID, "CREATE", entity, entityID, nil, data)
+// AuditVerification is the result of checking the audit chain.
+type AuditVerification struct {
+	Valid bool `json:"valid"`
+	// Checked counts chained entries; Unchained counts entries written
+	// before the chain existed, which can't be verified.
+	Checked   int64  `json:"checked"`
+	Unchained int64  `json:"unchained"`
+	BrokenAt  int64  `json:"broken_at,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// Verify walks the audit chain and reports the first entry that is
+// missing, out of order or doesn't match its hash.
+func (s *AuditService) Verify(ctx context.Context) (*AuditVerification, error) {
+	result := &AuditVerification{Valid: true}
+
+	unchained, err := s.collection.CountDocuments(ctx, bson.M{"seq": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, err
+	}
+	result.Unchained = unchained
+
+	cursor, err := s.collection.Find(ctx, bson.M{"seq": bson.M{"$exists": true}},
+		options.Find().SetSort(bson.D{{Key: "seq", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	verifier := chainVerifier{chain: s.chain}
+	for cursor.Next(ctx) {
+		var entry models.AuditLog
+		if err := cursor.Decode(&entry); err != nil {
+			return nil, err
+		}
+		if err := verifier.check(entry); err != nil {
+			result.Valid = false
+			result.BrokenAt = verifier.last.Seq + 1
+			result.Reason = err.Error()
+			return result, nil
+		}
+		result.Checked++
+	}
+	return result, cursor.Err()
+}
+
+// Pseudonym returns the pseudonym that replaces userID when the user is
+// erased.
+func (s *AuditService) Pseudonym(userID string) string {
+	return s.chain.pseudonym(userID)
+}
+
+// PseudonymizeResult counts the entries changed by Pseudonymize.
+type PseudonymizeResult struct {
+	Pseudonymized int64 `json:"pseudonymized"`
+	Redacted      int64 `json:"redacted"`
+}
+
+// Pseudonymize replaces userID with its pseudonym wherever it appears as
+// actor, impersonator or entity, and redacts the details of entries about
+// the user. The chain stays verifiable. It is idempotent, so a failed
+// erasure can be retried.
+func (s *AuditService) Pseudonymize(ctx context.Context, userID string) (*PseudonymizeResult, error) {
+	if len(s.chain.key) == 0 {
+		return nil, ErrNoPseudonymKey
+	}
+	pseudonym := s.chain.pseudonym(userID)
+	result := &PseudonymizeResult{}
+
+	redacted, err := s.collection.UpdateMany(ctx, bson.M{"$or": bson.A{
+		bson.M{"entity_id": userID},
+		bson.M{"meta.before.user_id": userID},
+		bson.M{"meta.after.user_id": userID},
+	}}, bson.M{"$set": bson.M{"meta": bson.M{}, "redacted": true}})
+	if err != nil {
+		return nil, err
+	}
+	result.Redacted = redacted.ModifiedCount
+
+	for _, field := range []string{"user_id", "impersonator_id", "entity_id"} {
+		updated, err := s.collection.UpdateMany(ctx, bson.M{field: userID}, bson.M{"$set": bson.M{field: pseudonym}})
+		if err != nil {
+			return nil, err
+		}
+		result.Pseudonymized += updated.ModifiedCount
+	}
+	return result, nil
 }
 
-func (s *AuditService) LogUpdate(userID, entity, entityID string, before, after interface{}) error {
-	return s.LogAction(userID, "UPDATE", entity, entityID, before, after)
+// ListConcerning returns every audit entry recorded by userID, including
+// while impersonating, or about the user, oldest first.
+func (s *AuditService) ListConcerning(ctx context.Context, userID string) ([]models.AuditLog, error) {
+	cursor, err := s.collection.Find(ctx, bson.M{"$or": bson.A{
+		bson.M{"user_id": userID},
+		bson.M{"impersonator_id": userID},
+		bson.M{"entity_id": userID},
+		bson.M{"meta.before.user_id": userID},
+		bson.M{"meta.after.user_id": userID},
+	}}, options.Find().SetSort(bson.D{{Key: "timestamp", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	logs := []models.AuditLog{}
+	if err := cursor.All(ctx, &logs); err != nil {
+		return nil, err
+	}
+	return logs, nil
 }
 
-func (s *AuditService) LogDelete(userID, entity, entityID string, data interface{}) error {
-	return s.LogAction(userID, "DELETE", entity, entityID, data, nil)
+// ListByUser returns up to limit audit entries recorded for actions by
+// userID, newest first. A non-zero before pages back from that time.
+func (s *AuditService) ListByUser(ctx context.Context, userID string, before time.Time, limit int64) ([]models.AuditLog, error) {
+	filter := bson.M{"user_id": userID}
+	if !before.IsZero() {
+		filter["timestamp"] = bson.M{"$lt": before}
+	}
+
+	cursor, err := s.collection.Find(ctx, filter,
+		options.Find().SetSort(bson.D{{Key: "timestamp", Value: -1}}).SetLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	logs := []models.AuditLog{}
+	if err := cursor.All(ctx, &logs); err != nil {
+		return nil, err
+	}
+	return logs, nil
 }
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"todo-apps/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PseudonymPrefix marks user IDs that an erasure replaced in the audit log.
+const PseudonymPrefix = "pseudonym:"
+
+// auditChain computes and checks the hash chain over audit entries. IDs are
+// hashed in their pseudonymized form, so an entry hashes the same before
+// and after its IDs are replaced by pseudonyms. The key must not change
+// once entries exist; an empty key still gives stable, but guessable,
+// pseudonyms.
+type auditChain struct {
+	key []byte
+}
+
+// pseudonym returns the stable pseudonym of id. Pseudonyms map to
+// themselves.
+func (c auditChain) pseudonym(id string) string {
+	if id == "" || strings.HasPrefix(id, PseudonymPrefix) {
+		return id
+	}
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(id))
+	return PseudonymPrefix + hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// hash returns the chain hash of entry, which must have Seq, PrevHash and
+// MetaDigest set.
+// ImpersonatorID is omitted when empty so entries written before
+// impersonation existed keep their hashes.
+func (c auditChain) hash(entry models.AuditLog) string {
+	data, _ := json.Marshal(struct {
+		Seq            int64  `json:"seq"`
+		PrevHash       string `json:"prev_hash"`
+		UserID         string `json:"user_id"`
+		ImpersonatorID string `json:"impersonator_id,omitempty"`
+		Action         string `json:"action"`
+		Entity         string `json:"entity"`
+		EntityID       string `json:"entity_id"`
+		Timestamp      int64  `json:"timestamp"`
+		MetaDigest     string `json:"meta_digest"`
+	}{
+		Seq:            entry.Seq,
+		PrevHash:       entry.PrevHash,
+		UserID:         c.pseudonym(entry.UserID),
+		ImpersonatorID: c.pseudonym(entry.ImpersonatorID),
+		Action:         entry.Action,
+		Entity:         entry.Entity,
+		EntityID:       c.pseudonym(entry.EntityID),
+		Timestamp:      entry.Timestamp.UnixMilli(),
+		MetaDigest:     entry.MetaDigest,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// chainVerifier checks entries fed to it in Seq order.
+type chainVerifier struct {
+	chain auditChain
+	last  models.AuditLog
+}
+
+func (v *chainVerifier) check(entry models.AuditLog) error {
+	if entry.Seq != v.last.Seq+1 {
+		return fmt.Errorf("expected entry %d but found %d", v.last.Seq+1, entry.Seq)
+	}
+	if entry.PrevHash != v.last.Hash {
+		return fmt.Errorf("entry %d does not link to entry %d", entry.Seq, v.last.Seq)
+	}
+	if entry.Hash != v.chain.hash(entry) {
+		return fmt.Errorf("entry %d has been modified", entry.Seq)
+	}
+	// Redacted isn't hashed since erasure sets it later, so a redacted
+	// entry must have no details left rather than details to check
+	if entry.Redacted {
+		if entry.Meta.Before != nil || entry.Meta.After != nil {
+			return fmt.Errorf("redacted entry %d has details", entry.Seq)
+		}
+	} else if entry.MetaDigest != metaDigest(entry.Meta) {
+		return fmt.Errorf("details of entry %d have been modified", entry.Seq)
+	}
+	v.last = entry
+	return nil
+}
+
+// metaDigest hashes the before and after documents of an entry in a form
+// that survives a round trip through BSON.
+func metaDigest(meta models.AuditMeta) string {
+	data, _ := json.Marshal(map[string]interface{}{
+		"before": normalizeMeta(PlainBSON(meta.Before)),
+		"after":  normalizeMeta(PlainBSON(meta.After)),
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeMeta converts value to the plain JSON types it is stored as, so
+// its digest is the same when it is read back. Empty documents become nil
+// since BSON omits them.
+func normalizeMeta(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil
+	}
+	switch v := normalized.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+	}
+	return normalized
+}
+
+// PlainBSON converts decoded BSON documents and arrays, at any depth, into
+// plain maps and slices.
+func PlainBSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case primitive.D:
+		doc := make(map[string]interface{}, len(v))
+		for _, elem := range v {
+			doc[elem.Key] = PlainBSON(elem.Value)
+		}
+		return doc
+	case primitive.M:
+		return plainMap(v)
+	case map[string]interface{}:
+		return plainMap(v)
+	case primitive.A:
+		items := make([]interface{}, len(v))
+		for i, elem := range v {
+			items[i] = PlainBSON(elem)
+		}
+		return items
+	}
+	return value
+}
+
+func plainMap(m map[string]interface{}) map[string]interface{} {
+	doc := make(map[string]interface{}, len(m))
+	for key, elem := range m {
+		doc[key] = PlainBSON(elem)
+	}
+	return doc
+}
@@ -0,0 +1,286 @@
+package services
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"todo-apps/config"
+	"todo-apps/models"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	alice = "5bedfd2f-c66f-4992-9310-fbe080fc92e0"
+	bob   = "2bc65b13-e97a-4200-91b7-b8a0a4ce69d9"
+)
+
+// newTestChain links entries the way AuditService.LogAction and append do
+// and returns them as read back from MongoDB.
+func newTestChain(t *testing.T, chain auditChain, entries []models.AuditLog) []models.AuditLog {
+	t.Helper()
+	start := time.Date(2026, 1, 2, 3, 4, 5, 678_000_000, time.UTC)
+	var last models.AuditLog
+	for i := range entries {
+		entry := &entries[i]
+		entry.Timestamp = start.Add(time.Duration(i) * time.Second)
+		entry.Meta = models.AuditMeta{Before: normalizeMeta(entry.Meta.Before), After: normalizeMeta(entry.Meta.After)}
+		entry.MetaDigest = metaDigest(entry.Meta)
+		entry.Seq = last.Seq + 1
+		entry.PrevHash = last.Hash
+		entry.Hash = chain.hash(*entry)
+		last = *entry
+		*entry = roundTrip(t, *entry)
+	}
+	return entries
+}
+
+func roundTrip(t *testing.T, entry models.AuditLog) models.AuditLog {
+	t.Helper()
+	data, err := bson.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded models.AuditLog
+	if err := bson.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+// verify checks entries in order and returns the first error.
+func verify(chain auditChain, entries []models.AuditLog) error {
+	verifier := chainVerifier{chain: chain}
+	for _, entry := range entries {
+		if err := verifier.check(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pseudonymizeEntries applies the same updates as AuditService.Pseudonymize.
+func pseudonymizeEntries(t *testing.T, chain auditChain, entries []models.AuditLog, userID string) {
+	t.Helper()
+	metaUser := func(doc interface{}) string {
+		m, _ := PlainBSON(doc).(map[string]interface{})
+		id, _ := m["user_id"].(string)
+		return id
+	}
+	for i := range entries {
+		entry := &entries[i]
+		if entry.EntityID == userID || metaUser(entry.Meta.Before) == userID || metaUser(entry.Meta.After) == userID {
+			entry.Meta = models.AuditMeta{}
+			entry.Redacted = true
+		}
+		for _, field := range []*string{&entry.UserID, &entry.ImpersonatorID, &entry.EntityID} {
+			if *field == userID {
+				*field = chain.pseudonym(userID)
+			}
+		}
+		*entry = roundTrip(t, *entry)
+	}
+}
+
+func sampleEntries() []models.AuditLog {
+	return []models.AuditLog{
+		{UserID: alice, Action: "CREATE", Entity: "users", EntityID: bob, Meta: models.AuditMeta{
+			After: map[string]interface{}{"username": "bob", "positions": []string{"Engineer"}, "age": 42, "settings": map[string]interface{}{}},
+		}},
+		{UserID: bob, ImpersonatorID: alice, Action: "UPDATE", Entity: "tasks", EntityID: uuid.NewString(), Meta: models.AuditMeta{
+			Before: map[string]interface{}{"user_id": bob, "todo": "Review"},
+			After:  map[string]interface{}{"user_id": alice, "todo": "Review", "done": true},
+		}},
+		{UserID: alice, Action: "LOGIN", Entity: "users", EntityID: alice},
+		{UserID: alice, Action: "DELETE", Entity: "positions", EntityID: uuid.NewString(), Meta: models.AuditMeta{
+			Before: map[string]interface{}{"name": "Engineer", "created_at": time.Date(2025, 5, 6, 7, 8, 9, 0, time.UTC)},
+		}},
+	}
+}
+
+func TestAuditChainVerifiesAfterRoundTrip(t *testing.T) {
+	chain := auditChain{key: []byte("test-key")}
+	entries := newTestChain(t, chain, sampleEntries())
+	if err := verify(chain, entries); err != nil {
+		t.Fatal(err)
+	}
+	if entries[0].Meta.After == nil {
+		t.Fatal("meta was lost in the round trip")
+	}
+}
+
+func TestAuditChainDetectsTampering(t *testing.T) {
+	chain := auditChain{key: []byte("test-key")}
+	tests := []struct {
+		name   string
+		tamper func(entries []models.AuditLog) []models.AuditLog
+		want   string
+	}{
+		{"action", func(e []models.AuditLog) []models.AuditLog { e[1].Action = "READ"; return e }, "entry 2 has been modified"},
+		{"actor", func(e []models.AuditLog) []models.AuditLog { e[2].UserID = bob; return e }, "entry 3 has been modified"},
+		{"impersonator removed", func(e []models.AuditLog) []models.AuditLog { e[1].ImpersonatorID = ""; return e }, "entry 2 has been modified"},
+		{"timestamp", func(e []models.AuditLog) []models.AuditLog {
+			e[0].Timestamp = e[0].Timestamp.Add(time.Millisecond)
+			return e
+		}, "entry 1 has been modified"},
+		{"details", func(e []models.AuditLog) []models.AuditLog {
+			e[1].Meta.After = bson.D{{Key: "user_id", Value: bob}}
+			return e
+		}, "details of entry 2 have been modified"},
+		{"redacted with rewritten details", func(e []models.AuditLog) []models.AuditLog {
+			e[1].Redacted = true
+			e[1].Meta.After = bson.D{{Key: "user_id", Value: bob}}
+			return e
+		}, "redacted entry 2 has details"},
+		{"redacted keeping details", func(e []models.AuditLog) []models.AuditLog { e[3].Redacted = true; return e }, "redacted entry 4 has details"},
+		{"redacted with an empty document", func(e []models.AuditLog) []models.AuditLog {
+			e[0].Redacted = true
+			e[0].Meta = models.AuditMeta{After: bson.D{}}
+			return e
+		}, "redacted entry 1 has details"},
+		{"deleted", func(e []models.AuditLog) []models.AuditLog { return append(e[:1], e[2:]...) }, "expected entry 2 but found 3"},
+		{"reordered", func(e []models.AuditLog) []models.AuditLog { e[1], e[2] = e[2], e[1]; return e }, "expected entry 2 but found 3"},
+		{"relinked", func(e []models.AuditLog) []models.AuditLog {
+			e[2].PrevHash = e[0].Hash
+			return e
+		}, "entry 3 does not link to entry 2"},
+		{"rehashed without the key", func(e []models.AuditLog) []models.AuditLog {
+			e[3].Action = "CREATE"
+			e[3].Hash = auditChain{}.hash(e[3])
+			return e
+		}, "entry 4 has been modified"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := tt.tamper(newTestChain(t, chain, sampleEntries()))
+			err := verify(chain, entries)
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuditChainSurvivesPseudonymization(t *testing.T) {
+	chain := auditChain{key: []byte("test-key")}
+	entries := newTestChain(t, chain, sampleEntries())
+	pseudonym := chain.pseudonym(bob)
+
+	pseudonymizeEntries(t, chain, entries, bob)
+	if err := verify(chain, entries); err != nil {
+		t.Fatalf("chain broken by pseudonymization: %v", err)
+	}
+
+	// Entries about bob lose their details; the rest keep them
+	for i, want := range []bool{true, true, false, false} {
+		if entries[i].Redacted != want {
+			t.Errorf("entry %d redacted = %v, want %v", i+1, entries[i].Redacted, want)
+		}
+		if want && (entries[i].Meta.Before != nil || entries[i].Meta.After != nil) {
+			t.Errorf("entry %d kept details after redaction", i+1)
+		}
+	}
+	if entries[0].EntityID != pseudonym || entries[1].UserID != pseudonym || entries[1].ImpersonatorID != alice {
+		t.Errorf("IDs not pseudonymized: %+v %+v", entries[0], entries[1])
+	}
+	if entries[3].Meta.Before == nil {
+		t.Error("an unrelated entry lost its details")
+	}
+
+	// Erasing a second user, or retrying, keeps the chain valid
+	pseudonymizeEntries(t, chain, entries, alice)
+	pseudonymizeEntries(t, chain, entries, bob)
+	if err := verify(chain, entries); err != nil {
+		t.Fatalf("chain broken by a second pseudonymization: %v", err)
+	}
+	for _, entry := range entries {
+		for _, id := range []string{entry.UserID, entry.ImpersonatorID, entry.EntityID} {
+			if id == alice || id == bob {
+				t.Errorf("entry %d still names an erased user", entry.Seq)
+			}
+		}
+	}
+}
+
+func TestAuditPseudonym(t *testing.T) {
+	chain := auditChain{key: []byte("test-key")}
+	pseudonym := chain.pseudonym(bob)
+	if !strings.HasPrefix(pseudonym, PseudonymPrefix) || len(pseudonym) != len(PseudonymPrefix)+32 {
+		t.Errorf("pseudonym = %q", pseudonym)
+	}
+	if chain.pseudonym(bob) != pseudonym || chain.pseudonym(pseudonym) != pseudonym || chain.pseudonym("") != "" {
+		t.Error("pseudonym is not stable")
+	}
+	if chain.pseudonym(alice) == pseudonym {
+		t.Error("different users share a pseudonym")
+	}
+	if (auditChain{key: []byte("other-key")}).pseudonym(bob) == pseudonym {
+		t.Error("pseudonym does not depend on the key")
+	}
+}
+
+// TestAuditServicePseudonymize runs Pseudonymize and Verify against a real
+// MongoDB when MONGO_TEST_URI is set.
+func TestAuditServicePseudonymize(t *testing.T) {
+	uri := os.Getenv("MONGO_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGO_TEST_URI is not set")
+	}
+	ctx := context.Background()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Disconnect(ctx) })
+	database := client.Database("audit_test_" + strings.ReplaceAll(uuid.NewString(), "-", ""))
+	t.Cleanup(func() { database.Drop(ctx) })
+
+	if _, err := (&AuditService{}).Pseudonymize(ctx, bob); err != ErrNoPseudonymKey {
+		t.Fatalf("Pseudonymize without a key: %v", err)
+	}
+
+	service := NewAuditService(&config.MongoDB{Client: client, Database: database}, config.AuditConfig{PseudonymKey: "test-key"})
+	for _, entry := range sampleEntries() {
+		if err := service.LogAction(ctx, entry.UserID, entry.Action, entry.Entity, entry.EntityID, entry.Meta.Before, entry.Meta.After); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := service.Pseudonymize(ctx, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Redacted != 2 || result.Pseudonymized != 2 {
+		t.Errorf("result = %+v", result)
+	}
+	verification, err := service.Verify(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verification.Valid || verification.Checked != 4 {
+		t.Fatalf("verification = %+v", verification)
+	}
+	if logs, err := service.ListConcerning(ctx, bob); err != nil || len(logs) != 0 {
+		t.Errorf("entries still naming bob: %d, %v", len(logs), err)
+	}
+
+	// Marking an entry redacted does not allow rewriting its details
+	_, err = database.Collection("audit_logs").UpdateOne(ctx, bson.M{"seq": 4},
+		bson.M{"$set": bson.M{"redacted": true, "meta.before.name": "Manager"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	verification, err = service.Verify(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verification.Valid || verification.BrokenAt != 4 {
+		t.Errorf("tampering not detected: %+v", verification)
+	}
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"todo-apps/config"
+	"todo-apps/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUserNotFound      = errors.New("user not found")
+	ErrUserDeactivated   = errors.New("user is already deactivated")
+	ErrInvalidReassignee = errors.New("tasks can only be reassigned to another active user")
+	ErrReassignToSelf    = errors.New("tasks can't be reassigned to the user being deactivated")
+)
+
+// DeactivationOptions selects what happens to a deactivated user's work and
+// access besides the status change.
+type DeactivationOptions struct {
+	// ReassignTo receives the user's open tasks, those ending now or later.
+	// Without it the tasks stay with the deactivated user.
+	ReassignTo   *uuid.UUID
+	EndPositions bool
+	RevokeTokens bool
+}
+
+type ReassignedTask struct {
+	ID   uuid.UUID `json:"id"`
+	Todo string    `json:"todo"`
+}
+
+type EndedPosition struct {
+	ID         uuid.UUID `json:"id"`
+	PositionID uuid.UUID `json:"position_id"`
+	Name       string    `json:"name"`
+}
+
+// DeactivationReport summarizes what a deactivation changed.
+type DeactivationReport struct {
+	UserID          uuid.UUID        `json:"user_id"`
+	PreviousStatus  string           `json:"previous_status"`
+	DeactivatedAt   time.Time        `json:"deactivated_at"`
+	ReassignedTo    *uuid.UUID       `json:"reassigned_to,omitempty"`
+	TasksReassigned []ReassignedTask `json:"tasks_reassigned"`
+	OpenTasksKept   int              `json:"open_tasks_kept"`
+	PositionsEnded  []EndedPosition  `json:"positions_ended"`
+	TokensRevoked   int              `json:"tokens_revoked"`
+	SessionsRevoked bool             `json:"sessions_revoked"`
+}
+
+// DeactivationService retires users without deleting them, so their tasks,
+// assignments and audit history keep a valid owner.
+type DeactivationService struct {
+	db           *gorm.DB
+	auditService *AuditService
+}
+
+func NewDeactivationService(cfg *config.Config, auditService *AuditService) *DeactivationService {
+	return &DeactivationService{
+		db:           cfg.Database,
+		auditService: auditService,
+	}
+}
+
+// Deactivate marks the user deactivated and applies opts in one
+// transaction, then audits every change as actorID.
+func (s *DeactivationService) Deactivate(ctx context.Context, actorID string, userID uuid.UUID, opts DeactivationOptions) (*DeactivationReport, error) {
+	db := s.db.WithContext(ctx)
+	now := time.Now()
+	report := &DeactivationReport{
+		UserID:          userID,
+		DeactivatedAt:   now,
+		ReassignedTo:    opts.ReassignTo,
+		TasksReassigned: []ReassignedTask{},
+		PositionsEnded:  []EndedPosition{},
+	}
+
+	var revokedTokens []uuid.UUID
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Select("id", "status").First(&user, "id = ?", userID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return ErrUserNotFound
+			}
+			return err
+		}
+		report.PreviousStatus = user.Status
+
+		// The status condition makes concurrent deactivations of the same
+		// user fail instead of both applying
+		updates := map[string]interface{}{"status": models.UserStatusDeactivated, "deactivated_at": now}
+		if opts.RevokeTokens {
+			updates["token_version"] = gorm.Expr("token_version + 1")
+			report.SessionsRevoked = true
+		}
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND status <> ?", userID, models.UserStatusDeactivated).
+			Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrUserDeactivated
+		}
+
+		var openTasks []models.Task
+		if err := tx.Where("user_id = ? AND end_date >= ?", userID, now).Order("start_date").Find(&openTasks).Error; err != nil {
+			return err
+		}
+		if opts.ReassignTo == nil {
+			report.OpenTasksKept = len(openTasks)
+		} else {
+			if *opts.ReassignTo == userID {
+				return ErrReassignToSelf
+			}
+			var assignee models.User
+			err := tx.Select("id").First(&assignee, "id = ? AND status = ?", *opts.ReassignTo, models.UserStatusActive).Error
+			if err == gorm.ErrRecordNotFound {
+				return ErrInvalidReassignee
+			}
+			if err != nil {
+				return err
+			}
+
+			ids := make([]uuid.UUID, len(openTasks))
+			for i, task := range openTasks {
+				ids[i] = task.ID
+				report.TasksReassigned = append(report.TasksReassigned, ReassignedTask{ID: task.ID, Todo: task.Todo})
+			}
+			if len(ids) > 0 {
+				if err := tx.Model(&models.Task{}).Where("id IN ?", ids).Update("user_id", assignee.ID).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		if opts.EndPositions {
+			var userPositions []models.UserPosition
+			if err := tx.Preload("Position").Where("user_id = ?", userID).Find(&userPositions).Error; err != nil {
+				return err
+			}
+			for _, userPosition := range userPositions {
+				if err := tx.Delete(&userPosition).Error; err != nil {
+					return err
+				}
+				report.PositionsEnded = append(report.PositionsEnded, EndedPosition{
+					ID:         userPosition.ID,
+					PositionID: userPosition.PositionID,
+					Name:       userPosition.Position.Name,
+				})
+			}
+		}
+
+		if opts.RevokeTokens {
+			err := tx.Model(&models.PersonalAccessToken{}).
+				Where("user_id = ? AND revoked_at IS NULL", userID).
+				Pluck("id", &revokedTokens).Error
+			if err != nil {
+				return err
+			}
+			if len(revokedTokens) > 0 {
+				if err := tx.Model(&models.PersonalAccessToken{}).Where("id IN ?", revokedTokens).Update("revoked_at", now).Error; err != nil {
+					return err
+				}
+			}
+			report.TokensRevoked = len(revokedTokens)
+
+			if err := tx.Model(&models.Session{}).Where("user_id = ? AND ended_at IS NULL", userID).Update("ended_at", now).Error; err != nil {
+				return err
+			}
+
+			// Pending reset and invitation links would otherwise still work
+			if err := tx.Model(&models.PasswordResetToken{}).Where("user_id = ? AND used_at IS NULL", userID).Update("used_at", now).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.VerificationToken{}).Where("user_id = ? AND used_at IS NULL", userID).Update("used_at", now).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Log audit
+	s.auditService.LogUpdate(ctx, actorID, "users", userID.String(),
+		map[string]interface{}{"status": report.PreviousStatus},
+		map[string]interface{}{"status": models.UserStatusDeactivated, "deactivated_at": now})
+	for _, task := range report.TasksReassigned {
+		s.auditService.LogUpdate(ctx, actorID, "tasks", task.ID.String(),
+			map[string]interface{}{"user_id": userID.String()},
+			map[string]interface{}{"user_id": opts.ReassignTo.String()})
+	}
+	for _, position := range report.PositionsEnded {
+		s.auditService.LogDelete(ctx, actorID, "user_positions", position.ID.String(), map[string]interface{}{
+			"id": position.ID.String(), "user_id": userID.String(), "position_id": position.PositionID.String(),
+		})
+	}
+	for _, id := range revokedTokens {
+		s.auditService.LogAction(ctx, actorID, "REVOKE", "personal_access_tokens", id.String(), nil, nil)
+	}
+
+	return report, nil
+}
@@ -0,0 +1,433 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"todo-apps/config"
+	"todo-apps/logging"
+	"todo-apps/models"
+	"todo-apps/utils"
+
+	"github.com/google/uuid"
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+// MaxImportRows bounds the size of one import.
+const MaxImportRows = 5000
+
+// Import row statuses.
+const (
+	ImportRowValid   = "valid"
+	ImportRowInvalid = "invalid"
+	ImportRowCreated = "created"
+)
+
+// importColumns are the recognized header names. Positions holds position
+// names separated by semicolons.
+var importColumns = map[string]bool{
+	"name": true, "username": true, "email": true, "password": true,
+	"timezone": true, "locale": true, "positions": true,
+}
+
+// ImportRow is one user read from an import file. Line is the 1-based line
+// or spreadsheet row it came from.
+type ImportRow struct {
+	Line      int
+	Name      string
+	Username  string
+	Email     string
+	Password  string
+	Timezone  string
+	Locale    string
+	Positions []string
+}
+
+type ImportRowResult struct {
+	Line     int                     `json:"line"`
+	Username string                  `json:"username"`
+	Status   string                  `json:"status"`
+	UserID   *uuid.UUID              `json:"user_id,omitempty"`
+	Invited  bool                    `json:"invited,omitempty"`
+	Errors   []utils.PolicyViolation `json:"errors,omitempty"`
+}
+
+// ImportReport describes the outcome of an import, row by row.
+type ImportReport struct {
+	DryRun  bool              `json:"dry_run"`
+	Total   int               `json:"total"`
+	Valid   int               `json:"valid"`
+	Invalid int               `json:"invalid"`
+	Created int               `json:"created"`
+	Rows    []ImportRowResult `json:"rows"`
+}
+
+// ImportService creates users and their position assignments in bulk.
+// Rows without a password are created pending and sent an invitation.
+type ImportService struct {
+	db                *gorm.DB
+	passwordService   *PasswordService
+	onboardingService *OnboardingService
+	auditService      *AuditService
+}
+
+func NewImportService(cfg *config.Config, passwordService *PasswordService, onboardingService *OnboardingService, auditService *AuditService) *ImportService {
+	return &ImportService{
+		db:                cfg.Database,
+		passwordService:   passwordService,
+		onboardingService: onboardingService,
+		auditService:      auditService,
+	}
+}
+
+// ParseImportFile reads rows from a .csv or .xlsx file. The first row must
+// be a header naming the columns; name and username are required.
+func ParseImportFile(filename string, data []byte) ([]ImportRow, error) {
+	var records [][]string
+	var lines []int
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		reader := csv.NewReader(bytes.NewReader(data))
+		reader.TrimLeadingSpace = true
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			line, _ := reader.FieldPos(0)
+			records = append(records, record)
+			lines = append(lines, line)
+		}
+	case ".xlsx":
+		file, err := excelize.OpenReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("read spreadsheet: %w", err)
+		}
+		defer file.Close()
+		sheets := file.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, errors.New("spreadsheet has no sheets")
+		}
+		records, err = file.GetRows(sheets[0])
+		if err != nil {
+			return nil, fmt.Errorf("read spreadsheet: %w", err)
+		}
+		for i := range records {
+			lines = append(lines, i+1)
+		}
+	default:
+		return nil, errors.New("unsupported file type, use .csv or .xlsx")
+	}
+
+	if len(records) == 0 {
+		return nil, errors.New("file is empty")
+	}
+
+	// Map header names to column indexes; Excel prefixes CSV exports with a BOM
+	header := map[string]int{}
+	for i, name := range records[0] {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if name == "" {
+			continue
+		}
+		if !importColumns[name] {
+			return nil, fmt.Errorf("unknown column %q", name)
+		}
+		if _, duplicate := header[name]; duplicate {
+			return nil, fmt.Errorf("duplicate column %q", name)
+		}
+		header[name] = i
+	}
+	for _, required := range []string{"name", "username"} {
+		if _, ok := header[required]; !ok {
+			return nil, fmt.Errorf("missing required column %q", required)
+		}
+	}
+
+	var rows []ImportRow
+	for i, record := range records[1:] {
+		cell := func(column string) string {
+			index, ok := header[column]
+			if !ok || index >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[index])
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		row := ImportRow{
+			Line:     lines[i+1],
+			Name:     cell("name"),
+			Username: cell("username"),
+			Email:    cell("email"),
+			Password: cell("password"),
+			Timezone: cell("timezone"),
+			Locale:   cell("locale"),
+		}
+		for _, position := range strings.Split(cell("positions"), ";") {
+			if position = strings.TrimSpace(position); position != "" {
+				row.Positions = append(row.Positions, position)
+			}
+		}
+		rows = append(rows, row)
+		if len(rows) > MaxImportRows {
+			return nil, fmt.Errorf("file has more than %d rows", MaxImportRows)
+		}
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("file has no data rows")
+	}
+	return rows, nil
+}
+
+// importPlan is a validated row ready to be created.
+type importPlan struct {
+	result    *ImportRowResult
+	user      models.User
+	password  string
+	positions []models.Position
+}
+
+// Import validates every row and, unless dryRun is set, creates the valid
+// rows in a single transaction. Invalid rows are reported and skipped.
+// actorID is recorded as the author of the audit entries.
+func (s *ImportService) Import(ctx context.Context, actorID string, rows []ImportRow, dryRun bool) (*ImportReport, error) {
+	db := s.db.WithContext(ctx)
+	report := &ImportReport{DryRun: dryRun, Total: len(rows), Rows: make([]ImportRowResult, len(rows))}
+
+	plans, err := s.validate(ctx, db, rows, report)
+	if err != nil {
+		return nil, err
+	}
+	report.Valid = len(plans)
+	report.Invalid = report.Total - report.Valid
+	if dryRun || len(plans) == 0 {
+		return report, nil
+	}
+
+	// Hash outside the transaction, it is deliberately slow
+	for i := range plans {
+		if plans[i].password == "" {
+			continue
+		}
+		hash, err := utils.HashPassword(plans[i].password)
+		if err != nil {
+			return nil, err
+		}
+		plans[i].user.Password = hash
+	}
+
+	type invitation struct {
+		token     string
+		expiresAt time.Time
+	}
+	var created []models.UserPosition
+	invitations := map[uuid.UUID]invitation{}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for i := range plans {
+			plan := &plans[i]
+			if err := tx.Create(&plan.user).Error; err != nil {
+				return err
+			}
+			if plan.user.Password != "" {
+				if err := s.passwordService.Record(tx, plan.user.ID, plan.user.Password); err != nil {
+					return err
+				}
+			} else {
+				token, expiresAt, err := s.onboardingService.Issue(tx, plan.user, models.TokenPurposeInvite)
+				if err != nil {
+					return err
+				}
+				invitations[plan.user.ID] = invitation{token, expiresAt}
+			}
+			for _, position := range plan.positions {
+				userPosition := models.UserPosition{UserID: plan.user.ID, PositionID: position.ID}
+				if err := tx.Create(&userPosition).Error; err != nil {
+					return err
+				}
+				created = append(created, userPosition)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range plans {
+		plan := &plans[i]
+		user := plan.user
+		plan.result.Status = ImportRowCreated
+		plan.result.UserID = &user.ID
+		report.Created++
+
+		if invite, invited := invitations[user.ID]; invited {
+			plan.result.Invited = true
+			if err := s.onboardingService.SendInvitation(ctx, user, invite.token, invite.expiresAt); err != nil {
+				logging.FromContext(ctx).Error("Failed to send invitation", "user_id", user.ID, "error", err)
+			}
+		}
+
+		email := ""
+		if user.Email != nil {
+			email = *user.Email
+		}
+		s.auditService.LogCreate(ctx, actorID, "users", user.ID.String(), map[string]interface{}{
+			"id": user.ID.String(), "name": user.Name, "username": user.Username, "email": email,
+			"timezone": user.Timezone, "locale": user.Locale, "status": user.Status, "source": "import",
+		})
+	}
+	for _, userPosition := range created {
+		s.auditService.LogCreate(ctx, actorID, "user_positions", userPosition.ID.String(), map[string]interface{}{
+			"id": userPosition.ID.String(), "user_id": userPosition.UserID.String(), "position_id": userPosition.PositionID.String(), "source": "import",
+		})
+	}
+	return report, nil
+}
+
+// validate checks each row against the policy, the database and the other
+// rows, fills in report.Rows and returns the valid rows.
+func (s *ImportService) validate(ctx context.Context, db *gorm.DB, rows []ImportRow, report *ImportReport) ([]importPlan, error) {
+	// Load everything the rows refer to in a few queries
+	var usernames, emails []string
+	for _, row := range rows {
+		usernames = append(usernames, row.Username)
+		if email, err := utils.NormalizeEmail(row.Email); err == nil {
+			emails = append(emails, email)
+		}
+	}
+	existingUsernames := map[string]bool{}
+	var found []string
+	if err := db.Model(&models.User{}).Where("username IN ?", usernames).Pluck("username", &found).Error; err != nil {
+		return nil, err
+	}
+	for _, username := range found {
+		existingUsernames[username] = true
+	}
+	existingEmails := map[string]bool{}
+	if len(emails) > 0 {
+		found = nil
+		if err := db.Model(&models.User{}).Where("email IN ?", emails).Pluck("email", &found).Error; err != nil {
+			return nil, err
+		}
+		for _, email := range found {
+			existingEmails[email] = true
+		}
+	}
+	var allPositions []models.Position
+	if err := db.Find(&allPositions).Error; err != nil {
+		return nil, err
+	}
+	positionsByName := map[string]models.Position{}
+	for _, position := range allPositions {
+		positionsByName[position.Name] = position
+	}
+
+	seenUsernames := map[string]int{}
+	seenEmails := map[string]int{}
+	var plans []importPlan
+	for i, row := range rows {
+		result := &report.Rows[i]
+		*result = ImportRowResult{Line: row.Line, Username: row.Username, Status: ImportRowValid}
+		violation := func(field, code, format string, args ...interface{}) {
+			result.Errors = append(result.Errors, utils.PolicyViolation{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+		}
+
+		user := models.User{Name: row.Name, Username: row.Username, Timezone: "UTC", Locale: "en", Status: models.UserStatusActive}
+		if row.Name == "" {
+			violation("name", "required", "Name is required")
+		}
+		switch {
+		case row.Username == "":
+			violation("username", "required", "Username is required")
+		case existingUsernames[row.Username]:
+			violation("username", "taken", "Username is already in use")
+		case seenUsernames[row.Username] > 0:
+			violation("username", "duplicate", "Username also appears on line %d", seenUsernames[row.Username])
+		default:
+			seenUsernames[row.Username] = row.Line
+		}
+
+		if row.Email != "" {
+			email, err := utils.NormalizeEmail(row.Email)
+			switch {
+			case err != nil:
+				violation("email", "invalid", "Email address is invalid")
+			case existingEmails[email]:
+				violation("email", "taken", "Email address is already in use")
+			case seenEmails[email] > 0:
+				violation("email", "duplicate", "Email address also appears on line %d", seenEmails[email])
+			default:
+				seenEmails[email] = row.Line
+				user.Email = &email
+			}
+		}
+
+		if row.Password != "" {
+			violations, err := s.passwordService.Validate(ctx, uuid.Nil, row.Password)
+			if err != nil {
+				return nil, err
+			}
+			result.Errors = append(result.Errors, violations...)
+		} else if row.Email == "" {
+			violation("password", "required", "A password or an email address to send an invitation to is required")
+		} else {
+			user.Status = models.UserStatusPending
+		}
+
+		if row.Timezone != "" {
+			if _, err := utils.ParseTimezone(row.Timezone); err != nil {
+				violation("timezone", "invalid", "Timezone must be an IANA name such as Europe/Berlin")
+			}
+			user.Timezone = row.Timezone
+		}
+		if row.Locale != "" {
+			locale, err := utils.NormalizeLocale(row.Locale)
+			if err != nil {
+				violation("locale", "invalid", "Locale must be a BCP 47 tag such as en-US")
+			}
+			user.Locale = locale
+		}
+
+		var positions []models.Position
+		for _, name := range row.Positions {
+			position, ok := positionsByName[name]
+			if !ok {
+				violation("positions", "unknown_position", "Position %q does not exist", name)
+				continue
+			}
+			if !containsPosition(positions, position.ID) {
+				positions = append(positions, position)
+			}
+		}
+
+		if len(result.Errors) > 0 {
+			result.Status = ImportRowInvalid
+			continue
+		}
+		plans = append(plans, importPlan{result: result, user: user, password: row.Password, positions: positions})
+	}
+	return plans, nil
+}
+
+func containsPosition(positions []models.Position, id uuid.UUID) bool {
+	for _, position := range positions {
+		if position.ID == id {
+			return true
+		}
+	}
+	return false
+}
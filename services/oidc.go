@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"todo-apps/config"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCIdentity is the verified result of an OpenID Connect login.
+type OIDCIdentity struct {
+	Issuer   string
+	Subject  string
+	Username string
+	Name     string
+	Groups   []string
+}
+
+// OIDCService runs the authorization-code + PKCE flow against the
+// configured issuer. Provider discovery is deferred until the first login so
+// an unreachable IdP doesn't prevent startup.
+type OIDCService struct {
+	cfg         config.OIDCConfig
+	redirectURL string
+
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+func NewOIDCService(cfg *config.Config) *OIDCService {
+	redirectURL := cfg.OIDC.RedirectURL
+	if redirectURL == "" {
+		redirectURL = strings.TrimSuffix(cfg.PublicURL, "/") + "/auth/oidc/callback"
+	}
+	return &OIDCService{cfg: cfg.OIDC, redirectURL: redirectURL}
+}
+
+func (s *OIDCService) discover(ctx context.Context) (*oidc.Provider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.provider == nil {
+		provider, err := oidc.NewProvider(ctx, s.cfg.IssuerURL)
+		if err != nil {
+			return nil, fmt.Errorf("discover OIDC provider: %w", err)
+		}
+		s.provider = provider
+	}
+	return s.provider, nil
+}
+
+func (s *OIDCService) oauth2Config(provider *oidc.Provider) *oauth2.Config {
+	return &oauth2.Config{
+		ClientID:     s.cfg.ClientID,
+		ClientSecret: s.cfg.ClientSecret,
+		RedirectURL:  s.redirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       s.cfg.Scopes,
+	}
+}
+
+// AuthCodeURL returns the provider URL to send the browser to. verifier is
+// the PKCE code verifier, which must be presented again in Exchange.
+func (s *OIDCService) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	provider, err := s.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	return s.oauth2Config(provider).AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Exchange redeems an authorization code and verifies the returned ID token,
+// including its nonce.
+func (s *OIDCService) Exchange(ctx context.Context, code, verifier, nonce string) (*OIDCIdentity, error) {
+	provider, err := s.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.oauth2Config(provider).Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchange authorization code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: s.cfg.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("verify id_token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("id_token nonce does not match")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("decode id_token claims: %w", err)
+	}
+
+	identity := &OIDCIdentity{
+		Issuer:  idToken.Issuer,
+		Subject: idToken.Subject,
+		Groups:  stringsClaim(claims[s.cfg.GroupsClaim]),
+	}
+	identity.Username, _ = claims[s.cfg.UsernameClaim].(string)
+	identity.Name, _ = claims["name"].(string)
+	if identity.Username == "" {
+		return nil, fmt.Errorf("id_token has no %s claim", s.cfg.UsernameClaim)
+	}
+	if identity.Name == "" {
+		identity.Name = identity.Username
+	}
+	return identity, nil
+}
+
+// Positions resolves identity groups to position names. managed lists every
+// position controlled by the IdP; granted is the subset the user should hold.
+func (s *OIDCService) Positions(groups []string) (managed, granted []string) {
+	member := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		member[group] = true
+	}
+	seen := make(map[string]bool)
+	for _, mapping := range s.cfg.GroupPositions {
+		group, position, _ := strings.Cut(mapping, "=")
+		if !seen[position] {
+			seen[position] = true
+			managed = append(managed, position)
+		}
+		if member[group] && !slices.Contains(granted, position) {
+			granted = append(granted, position)
+		}
+	}
+	return managed, granted
+}
+
+// stringsClaim accepts a claim that is either a list of strings or a single
+// string.
+func stringsClaim(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
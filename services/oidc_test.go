@@ -0,0 +1,268 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"todo-apps/config"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// mockProvider is a minimal OpenID Connect provider. It issues one code per
+// authorization request and checks the PKCE verifier at the token endpoint.
+type mockProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	claims jwt.MapClaims
+
+	mu    sync.Mutex
+	codes map[string]pendingCode
+}
+
+type pendingCode struct {
+	challenge string
+	nonce     string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &mockProvider{t: t, key: key, codes: make(map[string]pendingCode)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/jwks", p.jwks)
+	mux.HandleFunc("/token", p.token)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	p.claims = jwt.MapClaims{
+		"preferred_username": "jdoe",
+		"name":               "Jane Doe",
+		"groups":             []string{"engineering", "staff"},
+	}
+	return p
+}
+
+func (p *mockProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                p.server.URL,
+		"authorization_endpoint":                p.server.URL + "/authorize",
+		"token_endpoint":                        p.server.URL + "/token",
+		"jwks_uri":                              p.server.URL + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *mockProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize simulates the user approving the login at authURL and returns
+// the code the provider would redirect back with.
+func (p *mockProvider) authorize(authURL string) (code, state string) {
+	p.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		p.t.Fatalf("authorization URL lacks a PKCE challenge: %s", authURL)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	code = "code-" + q.Get("state")
+	p.codes[code] = pendingCode{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	return code, q.Get("state")
+}
+
+func (p *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p.mu.Lock()
+	pending, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != pending.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":   p.server.URL,
+		"sub":   "user-123",
+		"aud":   "todo-apps",
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": pending.nonce,
+	}
+	for k, v := range p.claims {
+		claims[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	idToken, err := token.SignedString(p.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+func newTestOIDCService(p *mockProvider) *OIDCService {
+	return NewOIDCService(&config.Config{
+		PublicURL: "http://app.test",
+		OIDC: config.OIDCConfig{
+			IssuerURL:      p.server.URL,
+			ClientID:       "todo-apps",
+			Scopes:         []string{"openid", "profile"},
+			UsernameClaim:  "preferred_username",
+			GroupsClaim:    "groups",
+			GroupPositions: []string{"engineering=Engineer", "admins=Admin"},
+		},
+	})
+}
+
+func TestOIDCLogin(t *testing.T) {
+	provider := newMockProvider(t)
+	svc := newTestOIDCService(provider)
+	ctx := context.Background()
+
+	authURL, err := svc.AuthCodeURL(ctx, "state-1", "nonce-1", "verifier-0123456789-0123456789-0123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(authURL)
+	if got := u.Query().Get("redirect_uri"); got != "http://app.test/auth/oidc/callback" {
+		t.Errorf("redirect_uri = %q", got)
+	}
+
+	code, state := provider.authorize(authURL)
+	if state != "state-1" {
+		t.Errorf("state = %q, want state-1", state)
+	}
+	identity, err := svc.Exchange(ctx, code, "verifier-0123456789-0123456789-0123456789", "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if identity.Issuer != provider.server.URL || identity.Subject != "user-123" {
+		t.Errorf("identity = %s/%s", identity.Issuer, identity.Subject)
+	}
+	if identity.Username != "jdoe" || identity.Name != "Jane Doe" {
+		t.Errorf("username/name = %q/%q", identity.Username, identity.Name)
+	}
+	if !slices.Equal(identity.Groups, []string{"engineering", "staff"}) {
+		t.Errorf("groups = %v", identity.Groups)
+	}
+}
+
+func TestOIDCExchangeRejectsWrongVerifier(t *testing.T) {
+	provider := newMockProvider(t)
+	svc := newTestOIDCService(provider)
+	ctx := context.Background()
+
+	authURL, err := svc.AuthCodeURL(ctx, "state", "nonce", "verifier-0123456789-0123456789-0123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := provider.authorize(authURL)
+
+	if _, err := svc.Exchange(ctx, code, "another-verifier-0123456789-0123456789", "nonce"); err == nil {
+		t.Fatal("expected exchange with the wrong PKCE verifier to fail")
+	}
+}
+
+func TestOIDCExchangeRejectsWrongNonce(t *testing.T) {
+	provider := newMockProvider(t)
+	svc := newTestOIDCService(provider)
+	ctx := context.Background()
+
+	authURL, err := svc.AuthCodeURL(ctx, "state", "nonce", "verifier-0123456789-0123456789-0123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := provider.authorize(authURL)
+
+	if _, err := svc.Exchange(ctx, code, "verifier-0123456789-0123456789-0123456789", "replayed"); err == nil {
+		t.Fatal("expected exchange with a mismatched nonce to fail")
+	}
+}
+
+func TestOIDCExchangeRequiresUsernameClaim(t *testing.T) {
+	provider := newMockProvider(t)
+	delete(provider.claims, "preferred_username")
+	svc := newTestOIDCService(provider)
+	ctx := context.Background()
+
+	authURL, err := svc.AuthCodeURL(ctx, "state", "nonce", "verifier-0123456789-0123456789-0123456789")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := provider.authorize(authURL)
+
+	if _, err := svc.Exchange(ctx, code, "verifier-0123456789-0123456789-0123456789", "nonce"); err == nil {
+		t.Fatal("expected an ID token without a username to be rejected")
+	}
+}
+
+func TestOIDCPositions(t *testing.T) {
+	svc := newTestOIDCService(newMockProvider(t))
+
+	managed, granted := svc.Positions([]string{"engineering", "staff"})
+	if !slices.Equal(managed, []string{"Engineer", "Admin"}) {
+		t.Errorf("managed = %v", managed)
+	}
+	if !slices.Equal(granted, []string{"Engineer"}) {
+		t.Errorf("granted = %v", granted)
+	}
+
+	if _, granted := svc.Positions(nil); len(granted) != 0 {
+		t.Errorf("granted without groups = %v", granted)
+	}
+}
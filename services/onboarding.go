@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"todo-apps/config"
+	"todo-apps/models"
+	"todo-apps/utils"
+
+	"gorm.io/gorm"
+)
+
+// ErrVerificationTokenInvalid is returned for unknown, expired or used
+// invitation and verification tokens.
+var ErrVerificationTokenInvalid = errors.New("token is invalid or expired")
+
+// OnboardingService issues the single-use links for invitations and email
+// verification and delivers them through the notifier.
+type OnboardingService struct {
+	notifier  Notifier
+	publicURL string
+	ttls      map[string]time.Duration
+}
+
+func NewOnboardingService(cfg *config.Config, notifier Notifier) *OnboardingService {
+	return &OnboardingService{
+		notifier:  notifier,
+		publicURL: cfg.PublicURL,
+		ttls: map[string]time.Duration{
+			models.TokenPurposeInvite:      cfg.Registration.InviteTTL,
+			models.TokenPurposeVerifyEmail: cfg.Registration.VerificationTTL,
+		},
+	}
+}
+
+// Issue creates a token for purpose addressed to the user's current email
+// and invalidates their earlier unused tokens for the same purpose. Call it
+// inside the transaction that stores the user.
+func (s *OnboardingService) Issue(tx *gorm.DB, user models.User, purpose string) (string, time.Time, error) {
+	if user.Email == nil {
+		return "", time.Time{}, errors.New("user has no email address")
+	}
+
+	token, tokenHash, err := utils.GenerateOpaqueToken()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	err = tx.Model(&models.VerificationToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, purpose).
+		Update("used_at", now).Error
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := now.Add(s.ttls[purpose])
+	err = tx.Create(&models.VerificationToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		Email:     *user.Email,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+	}).Error
+	return token, expiresAt, err
+}
+
+// Find returns the unused, unexpired token for purpose.
+func (s *OnboardingService) Find(db *gorm.DB, purpose, token string) (models.VerificationToken, error) {
+	var found models.VerificationToken
+	err := db.Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", utils.HashToken(token), purpose, time.Now()).
+		First(&found).Error
+	if err == gorm.ErrRecordNotFound {
+		err = ErrVerificationTokenInvalid
+	}
+	return found, err
+}
+
+// Claim marks token as used and makes sure it was sent to the user's
+// current email address. Call it inside the transaction that applies the
+// token's effect, so concurrent requests can't both use it.
+func (s *OnboardingService) Claim(tx *gorm.DB, token models.VerificationToken) error {
+	result := tx.Model(&models.VerificationToken{}).
+		Where("id = ? AND used_at IS NULL", token.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrVerificationTokenInvalid
+	}
+
+	var count int64
+	if err := tx.Model(&models.User{}).Where("id = ? AND email = ?", token.UserID, token.Email).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrVerificationTokenInvalid
+	}
+	return nil
+}
+
+// SendInvitation emails an invitation link to user.
+func (s *OnboardingService) SendInvitation(ctx context.Context, user models.User, token string, expiresAt time.Time) error {
+	link := fmt.Sprintf("%s/accept-invite?token=%s", s.publicURL, url.QueryEscape(token))
+	return s.notifier.Send(ctx, Message{
+		To:      *user.Email,
+		Subject: "You have been invited",
+		Body: fmt.Sprintf("An account with the username %s has been created for you. Use the link below to choose a password. It expires on %s and can only be used once.\n\n%s",
+			user.Username, expiresAt.UTC().Format(time.RFC1123), link),
+	})
+}
+
+// SendVerification emails an email verification link to user.
+func (s *OnboardingService) SendVerification(ctx context.Context, user models.User, token string, expiresAt time.Time) error {
+	link := fmt.Sprintf("%s/verify-email?token=%s", s.publicURL, url.QueryEscape(token))
+	return s.notifier.Send(ctx, Message{
+		To:      *user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Use the link below to verify your email address. It expires on %s and can only be used once.\n\n%s\n\nIf you did not sign up, you can ignore this message.",
+			expiresAt.UTC().Format(time.RFC1123), link),
+	})
+}
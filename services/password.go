@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+
+	"todo-apps/config"
+	"todo-apps/models"
+	"todo-apps/utils"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PasswordService enforces the password policy, including the rule against
+// reusing recent passwords.
+type PasswordService struct {
+	db          *gorm.DB
+	policy      *utils.PasswordPolicy
+	historySize int
+}
+
+func NewPasswordService(cfg *config.Config) (*PasswordService, error) {
+	policy := &utils.PasswordPolicy{
+		MinLength:     cfg.Password.MinLength,
+		RequireUpper:  cfg.Password.RequireUpper,
+		RequireLower:  cfg.Password.RequireLower,
+		RequireDigit:  cfg.Password.RequireDigit,
+		RequireSymbol: cfg.Password.RequireSymbol,
+		MaxBytes:      1024,
+	}
+	if cfg.Password.HashAlgorithm == "bcrypt" {
+		policy.MaxBytes = 72
+	}
+	if cfg.Password.BreachListFile != "" {
+		if err := policy.LoadBreachList(cfg.Password.BreachListFile); err != nil {
+			return nil, err
+		}
+	}
+
+	return &PasswordService{
+		db:          cfg.Database,
+		policy:      policy,
+		historySize: cfg.Password.HistorySize,
+	}, nil
+}
+
+// Validate returns every policy violation for password. Pass uuid.Nil as
+// userID for a user that doesn't exist yet.
+func (s *PasswordService) Validate(ctx context.Context, userID uuid.UUID, password string) ([]utils.PolicyViolation, error) {
+	violations := s.policy.Validate(password)
+	if userID == uuid.Nil || s.historySize <= 0 {
+		return violations, nil
+	}
+
+	reused, err := s.isReused(ctx, userID, password)
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		violations = append(violations, utils.PolicyViolation{
+			Field:   "password",
+			Code:    "reused",
+			Message: "Password must differ from your recent passwords",
+		})
+	}
+	return violations, nil
+}
+
+// Record adds hash to the user's history and drops entries beyond the
+// configured size. Call it with the transaction that stored the new hash.
+func (s *PasswordService) Record(tx *gorm.DB, userID uuid.UUID, hash string) error {
+	if s.historySize <= 0 {
+		return nil
+	}
+
+	if err := tx.Create(&models.PasswordHistory{UserID: userID, Hash: hash}).Error; err != nil {
+		return err
+	}
+
+	var stale []uuid.UUID
+	err := tx.Model(&models.PasswordHistory{}).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Offset(s.historySize).
+		Pluck("id", &stale).Error
+	if err != nil || len(stale) == 0 {
+		return err
+	}
+	return tx.Delete(&models.PasswordHistory{}, "id IN ?", stale).Error
+}
+
+// Change stores a new password hash, revokes every token issued to the user
+// and records the hash in the history. Call it inside a transaction.
+func (s *PasswordService) Change(tx *gorm.DB, userID uuid.UUID, hash string) error {
+	err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"password":      hash,
+		"token_version": gorm.Expr("token_version + 1"),
+	}).Error
+	if err != nil {
+		return err
+	}
+	return s.Record(tx, userID, hash)
+}
+
+func (s *PasswordService) isReused(ctx context.Context, userID uuid.UUID, password string) (bool, error) {
+	db := s.db.WithContext(ctx)
+
+	var hashes []string
+	err := db.Model(&models.PasswordHistory{}).
+		Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Limit(s.historySize).
+		Pluck("hash", &hashes).Error
+	if err != nil {
+		return false, err
+	}
+
+	// Users created before history tracking only have their current hash
+	var current models.User
+	if err := db.Select("password").First(&current, "id = ?", userID).Error; err == nil {
+		hashes = append(hashes, current.Password)
+	} else if err != gorm.ErrRecordNotFound {
+		return false, err
+	}
+
+	for _, hash := range hashes {
+		if valid, _ := utils.CheckPasswordHash(password, hash); valid {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -1,49 +1,106 @@
 package utils
 
 import (
-	"os"
+	"errors"
 	"time"
 
+	"todo-apps/jwtkeys"
 	"todo-apps/middleware"
+	"todo-apps/models"
 
 	"github.com/golang-jwt/jwt/v4"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// passwordHasher defaults to argon2id while still accepting bcrypt hashes
+// created before hash agility was introduced.
+var passwordHasher = NewPasswordHasher(
+	&Argon2idHasher{Memory: 64 * 1024, Iterations: 3, Parallelism: 2, SaltLength: 16, KeyLength: 32},
+	&BcryptHasher{Cost: 12},
+)
+
+// SetPasswordHasher replaces the hasher used by HashPassword and
+// CheckPasswordHash. Call it once during startup.
+func SetPasswordHasher(hasher *PasswordHasher) {
+	passwordHasher = hasher
+}
+
 func HashPassword(password string) (string, error) {
-	// Using bcrypt for password hashing with cost 12 (good balance of security and performance)
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 12)
-	return string(bytes), err
+	return passwordHasher.Hash(password)
+}
+
+// CheckPasswordHash reports whether password matches hash and whether the
+// hash uses an outdated algorithm or parameters and should be rehashed.
+func CheckPasswordHash(password, hash string) (valid bool, outdated bool) {
+	return passwordHasher.Check(password, hash)
 }
 
-func CheckPasswordHash(password, hash string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-	if err != nil {
-		// Log the error for debugging (remove in production)
-		// log.Printf("Password comparison failed: %v", err)
-		return false
+// GenerateJWT issues a session token for user. sessionID becomes the jti,
+// which JWTMiddleware checks against the sessions table.
+func GenerateJWT(keys *jwtkeys.KeySet, ttl time.Duration, user models.User, sessionID string) (string, error) {
+	claims := middleware.JWTClaims{
+		UserID:       user.ID.String(),
+		Username:     user.Username,
+		TokenVersion: user.TokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
 	}
-	return true
+
+	return keys.Sign(claims)
 }
 
-func GenerateJWT(userID, username string) (string, error) {
+// GenerateChallengeJWT issues a short-lived token restricted to purpose,
+// such as completing a two-factor login. JWTMiddleware rejects it.
+func GenerateChallengeJWT(keys *jwtkeys.KeySet, ttl time.Duration, user models.User, purpose string) (string, error) {
 	claims := middleware.JWTClaims{
-		UserID:   userID,
-		Username: username,
+		UserID:       user.ID.String(),
+		Username:     user.Username,
+		TokenVersion: user.TokenVersion,
+		Purpose:      purpose,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(getJWTSecret()))
+	return keys.Sign(claims)
 }
 
-func getJWTSecret() string {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "your-secret-key" // Default secret for development
+// ParseChallengeJWT validates a token issued by GenerateChallengeJWT for
+// purpose.
+func ParseChallengeJWT(keys *jwtkeys.KeySet, tokenString, purpose string) (*middleware.JWTClaims, error) {
+	claims := &middleware.JWTClaims{}
+	token, err := keys.Parse(tokenString, claims)
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid challenge token")
 	}
-	return secret
+	if claims.Purpose != purpose {
+		return nil, errors.New("challenge token has the wrong purpose")
+	}
+	return claims, nil
+}
+
+// GenerateImpersonationJWT issues a token that authenticates as subject on
+// behalf of actor. Both token versions are embedded, so revoking either
+// user's sessions invalidates it.
+func GenerateImpersonationJWT(keys *jwtkeys.KeySet, ttl time.Duration, actor, subject models.User, sessionID string) (string, error) {
+	claims := middleware.JWTClaims{
+		UserID:       subject.ID.String(),
+		Username:     subject.Username,
+		TokenVersion: subject.TokenVersion,
+		Actor: &middleware.ActorClaims{
+			UserID:       actor.ID.String(),
+			Username:     actor.Username,
+			TokenVersion: actor.TokenVersion,
+		},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        sessionID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return keys.Sign(claims)
 }
@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrPasswordTooLong is returned by bcrypt, which only uses the first 72
+// bytes of a password.
+var ErrPasswordTooLong = errors.New("password exceeds 72 bytes, the maximum supported by bcrypt")
+
+var errUnknownHashFormat = errors.New("unrecognized password hash format")
+
+// Hasher hashes passwords into PHC-style strings
+// ($id$params$salt$hash, or bcrypt's modular crypt format).
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Supports reports whether encoded was produced by this algorithm.
+	Supports(encoded string) bool
+	Verify(password, encoded string) (bool, error)
+	// NeedsRehash reports whether encoded uses parameters other than the
+	// hasher's current ones.
+	NeedsRehash(encoded string) bool
+}
+
+// Argon2idHasher implements Hasher with argon2id. Memory is in KiB.
+type Argon2idHasher struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, h.KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *Argon2idHasher) Supports(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return false, err
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	return subtle.ConstantTimeCompare(candidate, key) == 1, nil
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, salt, key, err := decodeArgon2id(encoded)
+	if err != nil {
+		return true
+	}
+	return params.Memory != h.Memory ||
+		params.Iterations != h.Iterations ||
+		params.Parallelism != h.Parallelism ||
+		uint32(len(salt)) != h.SaltLength ||
+		uint32(len(key)) != h.KeyLength
+}
+
+func decodeArgon2id(encoded string) (Argon2idHasher, []byte, []byte, error) {
+	var params Argon2idHasher
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return params, nil, nil, errUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2 parameters: %w", err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2 salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2 hash: %w", err)
+	}
+	return params, salt, key, nil
+}
+
+// BcryptHasher implements Hasher with bcrypt. Passwords longer than 72 bytes
+// are rejected rather than silently truncated.
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	if len(password) > 72 {
+		return "", ErrPasswordTooLong
+	}
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	return string(bytes), err
+}
+
+func (h *BcryptHasher) Supports(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (h *BcryptHasher) Verify(password, encoded string) (bool, error) {
+	if len(password) > 72 {
+		return false, nil
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost != h.Cost
+}
+
+// PasswordHasher hashes with a preferred algorithm and still verifies hashes
+// produced by the others, flagging them for rehash.
+type PasswordHasher struct {
+	preferred Hasher
+	all       []Hasher
+}
+
+func NewPasswordHasher(preferred Hasher, legacy ...Hasher) *PasswordHasher {
+	return &PasswordHasher{
+		preferred: preferred,
+		all:       append([]Hasher{preferred}, legacy...),
+	}
+}
+
+func (p *PasswordHasher) Hash(password string) (string, error) {
+	return p.preferred.Hash(password)
+}
+
+// Check verifies password against encoded. outdated is true when the
+// password matched but encoded should be replaced with a fresh hash.
+func (p *PasswordHasher) Check(password, encoded string) (valid bool, outdated bool) {
+	for _, hasher := range p.all {
+		if !hasher.Supports(encoded) {
+			continue
+		}
+		ok, err := hasher.Verify(password, encoded)
+		if err != nil || !ok {
+			return false, false
+		}
+		return true, hasher != p.preferred || p.preferred.NeedsRehash(encoded)
+	}
+	return false, false
+}
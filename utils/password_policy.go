@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// PolicyViolation describes one way a password fails the policy.
+type PolicyViolation struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type PasswordPolicy struct {
+	MinLength int
+	// MaxBytes caps the encoded length; bcrypt can't use more than 72 bytes.
+	MaxBytes      int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// breached holds upper-case SHA-1 hex digests of known breached passwords.
+	breached map[string]struct{}
+}
+
+var sha1Line = regexp.MustCompile(`^[0-9A-Fa-f]{40}(:\d+)?$`)
+
+// LoadBreachList reads an offline breached-password list. Each line is either
+// a plaintext password or a SHA-1 hex digest, optionally followed by
+// ":count" as in the Have I Been Pwned download format.
+func (p *PasswordPolicy) LoadBreachList(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open breach list: %w", err)
+	}
+	defer file.Close()
+
+	breached := map[string]struct{}{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if sha1Line.MatchString(line) {
+			breached[strings.ToUpper(line[:40])] = struct{}{}
+		} else {
+			breached[sha1Hex(line)] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read breach list: %w", err)
+	}
+
+	p.breached = breached
+	return nil
+}
+
+// Validate checks password against the length, character class and breach
+// list rules. Reuse is checked separately because it needs the user's
+// history.
+func (p *PasswordPolicy) Validate(password string) []PolicyViolation {
+	var violations []PolicyViolation
+
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, PolicyViolation{
+			Field:   "password",
+			Code:    "too_short",
+			Message: fmt.Sprintf("Password must be at least %d characters long", p.MinLength),
+		})
+	}
+
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		violations = append(violations, PolicyViolation{
+			Field:   "password",
+			Code:    "too_long",
+			Message: fmt.Sprintf("Password must be at most %d bytes long", p.MaxBytes),
+		})
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+
+	classes := []struct {
+		required bool
+		present  bool
+		code     string
+		message  string
+	}{
+		{p.RequireUpper, hasUpper, "missing_uppercase", "Password must contain an uppercase letter"},
+		{p.RequireLower, hasLower, "missing_lowercase", "Password must contain a lowercase letter"},
+		{p.RequireDigit, hasDigit, "missing_digit", "Password must contain a digit"},
+		{p.RequireSymbol, hasSymbol, "missing_symbol", "Password must contain a symbol"},
+	}
+	for _, class := range classes {
+		if class.required && !class.present {
+			violations = append(violations, PolicyViolation{Field: "password", Code: class.code, Message: class.message})
+		}
+	}
+
+	if _, found := p.breached[sha1Hex(password)]; found && password != "" {
+		violations = append(violations, PolicyViolation{
+			Field:   "password",
+			Code:    "breached",
+			Message: "Password appears in a list of breached passwords",
+		})
+	}
+
+	return violations
+}
+
+func sha1Hex(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"errors"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// NormalizeEmail trims and lower-cases address and checks that it is a bare
+// address without a display name.
+func NormalizeEmail(address string) (string, error) {
+	address = strings.ToLower(strings.TrimSpace(address))
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Address != address {
+		return "", errors.New("invalid email address")
+	}
+	return address, nil
+}
+
+// ParseTimezone returns the location for an IANA timezone name.
+func ParseTimezone(name string) (*time.Location, error) {
+	// time.LoadLocation treats "" and "Local" specially; neither is a
+	// meaningful user setting
+	if name == "" || name == "Local" {
+		return nil, errors.New("invalid timezone")
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, errors.New("invalid timezone")
+	}
+	return loc, nil
+}
+
+// NormalizeLocale returns the canonical form of a BCP 47 language tag.
+func NormalizeLocale(locale string) (string, error) {
+	tag, err := language.Parse(strings.TrimSpace(locale))
+	if err != nil {
+		return "", errors.New("invalid locale")
+	}
+	return tag.String(), nil
+}
+
+// ValidateAvatarURL accepts an empty string or an absolute http(s) URL.
+func ValidateAvatarURL(raw string) error {
+	if raw == "" {
+		return nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return errors.New("avatar URL must be an absolute http or https URL")
+	}
+	return nil
+}